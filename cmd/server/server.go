@@ -1,42 +1,154 @@
 package main
 
 import (
+	"crypto/rand"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"GoNews/pkg/api"
+	"GoNews/pkg/grpcapi"
 	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/boltdb"
+	"GoNews/pkg/storage/breaker"
+	"GoNews/pkg/storage/cache"
 	"GoNews/pkg/storage/memdb"
 	"GoNews/pkg/storage/mongo"
 	"GoNews/pkg/storage/postgres"
+	"GoNews/pkg/storage/retry"
+	"GoNews/pkg/storage/sqlite"
+	"GoNews/pkg/webhook"
 )
 
 // Сервер GoNews.
 type server struct {
 	db  storage.Interface
 	api *api.API
+
+	// Хранилища арендаторов. Если заданы, db не используется.
+	tenants storage.Tenants
+
+	// Правила проверки входящих публикаций.
+	rules api.Rules
 }
 
 func main() {
 	// Создаём объект сервера.
 	var (
-		srv    server
-		dbType string
+		srv      server
+		dbType   string
+		dataDir  string
+		dbFile   string
+		boltFile string
+		keysFile string
+		tokenTTL time.Duration
+		limits   api.RateLimits
+		exempt   string
+		origins  string
+		withCred bool
+		grpcAddr string
+		auth     *api.Auth
+		history  int
+		hooks    = webhook.DefaultConfig()
+		cacheCfg = cache.DefaultConfig()
+		debug    string
+		cacheCtl string
+		replicas string
+		ryw      time.Duration
+		attempts int
+		brkCfg   = breaker.DefaultConfig()
+		brk      *breaker.Store
+		multi    bool
+		tenancy  = api.Tenancy{Header: api.DefaultTenantHeader}
 	)
 
-	flag.StringVar(&dbType, "db", "memdb", "Specify database for the application. Available: memdb, postgres, mongo")
+	flag.StringVar(&dbType, "db", "memdb", "Specify database for the application. Available: memdb, postgres, mongo, sqlite, bolt")
+	flag.StringVar(&dataDir, "data", "", "Data directory for memdb. If empty, data is kept in memory only")
+	flag.StringVar(&dbFile, "sqlite-file", "gonews.db", "Database file for sqlite")
+	flag.StringVar(&boltFile, "bolt-file", "gonews.bolt", "Database file for bolt")
+	flag.StringVar(&keysFile, "keys", "", "JSON file with API keys. If empty, authentication is disabled")
+	flag.DurationVar(&tokenTTL, "token-ttl", time.Hour, "Lifetime of tokens issued by /token")
+	flag.Float64Var(&limits.Read.Rate, "read-rps", 20, "Read requests per second allowed for a client. 0 disables the limit")
+	flag.IntVar(&limits.Read.Burst, "read-burst", 40, "Burst of read requests allowed for a client")
+	flag.Float64Var(&limits.Write.Rate, "write-rps", 2, "Write requests per second allowed for a client. 0 disables the limit")
+	flag.IntVar(&limits.Write.Burst, "write-burst", 10, "Burst of write requests allowed for a client")
+	flag.StringVar(&exempt, "rate-exempt", "", "Comma-separated CIDR networks exempt from rate limits")
+	flag.Float64Var(&limits.Address.Rate, "ip-rps", 50, "Requests per second allowed from an IP address, checked before authentication. 0 disables the limit")
+	flag.IntVar(&limits.Address.Burst, "ip-burst", 100, "Burst of requests allowed from an IP address")
+	flag.BoolVar(&limits.TrustForwardedFor, "trust-proxy", false, "Take client addresses from X-Forwarded-For")
+	flag.IntVar(&limits.ProxyHops, "proxy-hops", 1, "Number of trusted proxies appending to X-Forwarded-For")
+	flag.StringVar(&origins, "cors-origins", "", "Comma-separated origins allowed to call the API from a browser. If empty, CORS is disabled")
+	flag.BoolVar(&withCred, "cors-credentials", false, "Allow browsers to send credentials with cross-origin requests")
+	flag.StringVar(&grpcAddr, "grpc", ":9090", "Address of the gRPC API. If empty, gRPC is disabled")
+	flag.IntVar(&history, "event-history", storage.DefaultBusHistory, "Number of recent post events kept for resuming streams")
+	flag.StringVar(&hooks.File, "webhooks-file", "", "JSON file with webhook subscriptions. If empty, subscriptions are kept in memory only")
+	flag.IntVar(&hooks.MaxAttempts, "webhook-attempts", hooks.MaxAttempts, "Delivery attempts before a webhook event becomes a dead letter")
+	flag.BoolVar(&hooks.AllowPrivate, "webhook-allow-private", false, "Allow webhooks to loopback, private and link-local addresses")
+	flag.DurationVar(&cacheCfg.TTL, "cache-ttl", cacheCfg.TTL, "Lifetime of cached posts and listings. 0 disables the cache")
+	flag.IntVar(&cacheCfg.MaxPosts, "cache-posts", cacheCfg.MaxPosts, "Number of cached posts")
+	flag.IntVar(&cacheCfg.MaxLists, "cache-lists", cacheCfg.MaxLists, "Number of cached post listings")
+	flag.StringVar(&debug, "debug-addr", "localhost:6060", "Address serving runtime statistics at /debug/vars. If empty, statistics are not served")
+	flag.StringVar(&cacheCtl, "cache-control", api.DefaultCacheControl, "Cache-Control header of post and feed responses")
+	flag.StringVar(&replicas, "pg-replicas", "", "Comma-separated host:port of postgres read replicas")
+	flag.DurationVar(&ryw, "read-your-writes", 5*time.Second, "How long reads go to the postgres primary after a write")
+	flag.IntVar(&attempts, "db-attempts", 4, "Attempts of a postgres or mongo operation failing with a transient error. 1 disables retries")
+	flag.IntVar(&brkCfg.Failures, "breaker-failures", brkCfg.Failures, "Consecutive postgres or mongo failures that open the circuit breaker. 0 disables the breaker")
+	flag.DurationVar(&brkCfg.OpenTimeout, "breaker-timeout", brkCfg.OpenTimeout, "How long the open circuit breaker fails requests before probing the database")
+	flag.BoolVar(&multi, "tenants", false, "Host several newsrooms, each with its own storage, managed through /tenants. Available with memdb, postgres and mongo")
+	flag.StringVar(&tenancy.Header, "tenant-header", tenancy.Header, "Request header naming the tenant. If empty, the header is not used")
+	flag.StringVar(&tenancy.Domain, "tenant-domain", "", "Domain whose subdomains name tenants, e.g. news.example.com. If empty, host names are not used")
 	flag.Parse()
 
+	srv.rules = api.DefaultRules()
+	if multi && dbType != "memdb" && dbType != "postgres" && dbType != "mongo" {
+		log.Fatalf("tenants are not available with %s", dbType)
+	}
+	// Арендаторами управляют операторы, а удаление арендатора
+	// уничтожает его данные.
+	if multi && keysFile == "" {
+		log.Fatal("tenants require authentication, set -keys")
+	}
+
 	switch dbType {
 	case "memdb":
 		// Создаём объекты баз данных.
 		//
-		// БД в памяти.
-		srv.db = memdb.New()
+		// Арендаторы с отдельными картами в памяти и подкаталогами
+		// в каталоге данных.
+		if multi {
+			t, err := memdb.NewTenants(memdb.Config{Dir: dataDir})
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer t.Close()
+
+			srv.tenants = t
+			break
+		}
+
+		// БД в памяти с примерами публикаций.
+		if dataDir == "" {
+			srv.db = memdb.NewSample()
+			break
+		}
+
+		// БД в памяти с журналом и снимками на диске.
+		db, err := memdb.Open(memdb.Config{Dir: dataDir})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		srv.db = db
+		log.Infof("memdb data directory: %s", dataDir)
 
 	case "postgres":
 		// Реляционная БД PostgreSQL.
@@ -46,8 +158,32 @@ func main() {
 			Host:     "localhost",
 			Port:     "5433",
 			DBName:   "gonews",
+
+			ReadYourWrites: ryw,
 		}
-		db, err := postgres.New(conf.ConString())
+		for _, addr := range strings.Split(replicas, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				conf.Replicas = append(conf.Replicas, addr)
+			}
+		}
+		// Арендаторы в отдельных схемах одной БД.
+		if multi {
+			t, err := postgres.OpenTenants(conf)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer t.Close()
+
+			err = t.Ping()
+			if err != nil {
+				log.Fatal(fmt.Errorf("%w: %v", storage.ErrDBNotResponding, err))
+			}
+
+			srv.tenants = withTenantRetry(t, attempts, postgres.Transient, postgres.Unsent)
+			log.Infof("connected to postgres: %s", conf)
+			break
+		}
+		db, err := postgres.Open(conf)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -58,7 +194,8 @@ func main() {
 			log.Fatal(fmt.Errorf("%w: %v", storage.ErrDBNotResponding, err))
 		}
 
-		srv.db = db
+		srv.db = withRetry(db, attempts, postgres.Transient, postgres.Unsent)
+		srv.db, brk = withBreaker(srv.db, brkCfg, postgres.Transient)
 		log.Infof("connected to postgres: %s", conf)
 
 	case "mongo":
@@ -68,6 +205,23 @@ func main() {
 			Port:   "27018",
 			DBName: "gonews",
 		}
+		// Арендаторы в отдельных БД одного сервера.
+		if multi {
+			t, err := mongo.NewTenants(conf)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer t.Close()
+
+			err = t.Ping()
+			if err != nil {
+				log.Fatal(fmt.Errorf("%w: %v", storage.ErrDBNotResponding, err))
+			}
+
+			srv.tenants = withTenantRetry(t, attempts, mongo.Transient, mongo.Unsent)
+			log.Infof("connected to mongo: %+v", conf)
+			break
+		}
 		db, err := mongo.New(conf)
 		if err != nil {
 			log.Fatal(err)
@@ -79,15 +233,157 @@ func main() {
 			log.Fatal(fmt.Errorf("%w: %v", storage.ErrDBNotResponding, err))
 		}
 
-		srv.db = db
+		srv.db = withRetry(db, attempts, mongo.Transient, mongo.Unsent)
+		srv.db, brk = withBreaker(srv.db, brkCfg, mongo.Transient)
 		log.Infof("connected to mongo: %+v", conf)
 
+	case "sqlite":
+		// Встраиваемая БД SQLite в одном файле.
+		db, err := sqlite.New(dbFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		srv.db = db
+		log.Infof("sqlite database file: %s", dbFile)
+
+	case "bolt":
+		// Встраиваемое хранилище ключ-значение bbolt в одном файле.
+		db, err := boltdb.New(boltFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		srv.db = db
+		log.Infof("bolt database file: %s", boltFile)
+
 	default:
 		log.Fatal("Invalid DB type specified")
 	}
 
+	// Авторы есть во всех хранилищах, поэтому AuthorID проверяется
+	// до попытки записи. Авторов арендатора API проверяет
+	// по хранилищу арендатора.
+	if srv.db != nil {
+		srv.rules.Authors = srv.db
+	}
+
+	// Кэш чтения публикаций. Изменения через API сразу удаляют
+	// затронутые записи, изменения в обход сервера видны через TTL.
+	if cacheCfg.TTL > 0 && srv.tenants != nil {
+		srv.tenants = storage.WrapTenants(srv.tenants, func(_ string, db storage.Interface) storage.Interface {
+			return cache.New(db, cacheCfg)
+		})
+	} else if cacheCfg.TTL > 0 {
+		c := cache.New(srv.db, cacheCfg)
+		expvar.Publish("cache", expvar.Func(func() interface{} { return c.Stats() }))
+		srv.db = c
+	}
+
+	opts := []api.Option{api.WithRules(srv.rules), api.WithCacheControl(cacheCtl)}
+	if srv.tenants != nil {
+		// События об изменениях публикаций общие для сервера,
+		// поэтому потоки и подписки webhook не разделяют арендаторов
+		// и недоступны вместе с ними.
+		tenancy.Tenants = srv.tenants
+		opts = append(opts, api.WithTenants(tenancy))
+		log.Warn("event streams, webhooks and gRPC are disabled for tenants")
+	} else {
+		// Хранилище сообщает об изменениях публикаций в шину событий,
+		// из которой их получают клиенты потоков.
+		bus := storage.NewBus(history)
+		if p, ok := srv.db.(storage.Publisher); ok {
+			p.SetBus(bus)
+		}
+
+		opts = append(opts, api.WithBus(bus))
+
+		// Внешние системы получают события через подписки webhook.
+		// Подписками управляют администраторы, поэтому без
+		// аутентификации webhooks недоступны.
+		if keysFile == "" {
+			log.Warn("webhooks are disabled without authentication")
+		} else {
+			dispatcher, err := webhook.New(hooks)
+			if err != nil {
+				log.Fatal(err)
+			}
+			dispatcher.Run(bus)
+			opts = append(opts, api.WithWebhooks(dispatcher))
+		}
+	}
+	if brk != nil {
+		opts = append(opts, api.WithHealth("storage", brk))
+	}
+
+	// Ограничение частоты запросов клиентов.
+	for _, cidr := range strings.Split(exempt, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		limits.ExemptNets = append(limits.ExemptNets, n)
+	}
+	opts = append(opts, api.WithRateLimits(limits))
+
+	// Доступ к API из браузера со сторонних источников.
+	if origins != "" {
+		cors := api.DefaultCORS(strings.Split(origins, ",")...)
+		cors.AllowCredentials = withCred
+		opts = append(opts, api.WithCORS(cors))
+	}
+
+	// Аутентификация по API-ключам и токенам.
+	if keysFile == "" {
+		log.Warn("authentication is disabled, anyone can modify posts")
+	} else {
+		keys, err := api.ReadKeys(keysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		auth = api.NewAuth(tokenSecret(), tokenTTL, keys...)
+		opts = append(opts, api.WithAuth(auth))
+		log.Infof("loaded %d API keys", len(keys))
+	}
+
+	// gRPC API работает с тем же хранилищем на отдельном порту.
+	if grpcAddr != "" && srv.tenants == nil {
+		grpcOpts := []grpcapi.Option{grpcapi.WithRules(srv.rules)}
+		if auth != nil {
+			grpcOpts = append(grpcOpts, grpcapi.WithAuth(auth))
+		}
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			err := grpcapi.New(srv.db, grpcOpts...).GRPC().Serve(lis)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}()
+		log.Infof("gRPC API listening on %s", grpcAddr)
+	}
+
+	// Статистика работы сервера в формате expvar.
+	if debug != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			err := http.ListenAndServe(debug, mux)
+			if err != nil {
+				log.Errorf("error serving statistics: %v", err)
+			}
+		}()
+	}
+
 	// Создаём объект API и регистрируем обработчики.
-	srv.api = api.New(srv.db)
+	srv.api = api.New(srv.db, opts...)
 
 	// Запускаем веб-сервер на порту 8080 на всех интерфейсах.
 	// Предаём серверу маршрутизатор запросов,
@@ -95,3 +391,59 @@ func main() {
 	// Маршрутизатор будет выбирать нужный обработчик.
 	http.ListenAndServe(":8080", srv.api.Router())
 }
+
+// withRetry повторяет операции хранилища при временных ошибках БД
+// и публикует статистику повторов.
+func withRetry(db storage.Interface, attempts int, transient, unsent func(error) bool) storage.Interface {
+	policy := retry.DefaultPolicy(transient, unsent)
+	policy.MaxAttempts = attempts
+	s := retry.New(db, policy)
+	expvar.Publish("retry", expvar.Func(func() interface{} { return s.Stats() }))
+	return s
+}
+
+// withTenantRetry повторяет операции хранилищ арендаторов
+// при временных ошибках БД. Статистика повторов не публикуется.
+func withTenantRetry(t storage.Tenants, attempts int, transient, unsent func(error) bool) storage.Tenants {
+	policy := retry.DefaultPolicy(transient, unsent)
+	policy.MaxAttempts = attempts
+	return storage.WrapTenants(t, func(_ string, db storage.Interface) storage.Interface {
+		return retry.New(db, policy)
+	})
+}
+
+// withBreaker размыкает цепь при серии ошибок БД, чтобы запросы
+// к недоступной БД сразу завершались ошибкой 503, и публикует
+// состояние выключателя. Неисправностью БД считаются временные ошибки
+// и ошибки соединения; повторы уже выполнены внутренним хранилищем.
+func withBreaker(db storage.Interface, conf breaker.Config, transient func(error) bool) (storage.Interface, *breaker.Store) {
+	if conf.Failures <= 0 {
+		return db, nil
+	}
+	conf.Failure = func(err error) bool {
+		return transient(err) || errors.Is(err, storage.ErrDBNotResponding) || errors.Is(err, storage.ErrConnectDB)
+	}
+	s := breaker.New(db, conf)
+	expvar.Publish("breaker", expvar.Func(func() interface{} {
+		status, _ := s.Health()
+		return status
+	}))
+	return s, s
+}
+
+// tokenSecret возвращает ключ подписи токенов из переменной окружения
+// GONEWS_TOKEN_SECRET. Если она не задана, ключ генерируется случайно,
+// и выпущенные токены перестают действовать после перезапуска.
+func tokenSecret() []byte {
+	if secret := os.Getenv("GONEWS_TOKEN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Warn("GONEWS_TOKEN_SECRET is not set, using a random token secret")
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return secret
+}
@@ -2,34 +2,120 @@ package api
 
 import (
 	"GoNews/pkg/storage"
-	"encoding/json"
+	"GoNews/pkg/webhook"
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	graphql "github.com/graph-gophers/graphql-go"
 )
 
 // Программный интерфейс сервера GoNews
 type API struct {
-	db     storage.Interface
-	router *mux.Router
+	db       storage.Interface
+	router   *mux.Router
+	rules    Rules
+	auth     *Auth
+	limiter  *rateLimiter
+	cors     *CORS
+	feed     FeedInfo
+	encoders encoders
+	openapi  []byte
+	graphql  *graphql.Schema
+	bus      *storage.Bus
+	webhooks *webhook.Dispatcher
+	health   []healthCheck
+	tenancy  *Tenancy
+
+	cacheControl string
 }
 
+// Option задаёт необязательный параметр API.
+type Option func(*API)
+
 // Конструктор объекта API
-func New(db storage.Interface) *API {
+func New(db storage.Interface, opts ...Option) *API {
 	api := API{
-		db: db,
+		db:    db,
+		rules: DefaultRules(),
+		feed:  DefaultFeedInfo(),
+
+		cacheControl: DefaultCacheControl,
+
+		encoders: defaultEncoders(),
+	}
+	for _, opt := range opts {
+		opt(&api)
 	}
 	api.router = mux.NewRouter()
+	api.buildOpenAPI()
+	api.buildGraphQL()
 	api.endpoints()
 	return &api
 }
 
 // Регистрация обработчиков API.
 func (api *API) endpoints() {
-	api.router.HandleFunc("/posts", api.postsHandler).Methods(http.MethodGet, http.MethodOptions)
-	api.router.HandleFunc("/posts", api.addPostHandler).Methods(http.MethodPost, http.MethodOptions)
-	api.router.HandleFunc("/posts", api.updatePostHandler).Methods(http.MethodPut, http.MethodOptions)
-	api.router.HandleFunc("/posts", api.deletePostHandler).Methods(http.MethodDelete, http.MethodOptions)
+	// CORS обрабатывается первым: предварительные запросы браузера
+	// не содержат учётных данных и не должны расходовать лимит.
+	if api.cors != nil {
+		api.router.Use(api.cors.middleware)
+	}
+	// Запросы с одного адреса ограничиваются до аутентификации,
+	// чтобы перебор учётных данных тоже расходовал лимит.
+	if api.limiter != nil {
+		api.router.Use(api.limiter.addressMiddleware)
+	}
+	if api.auth != nil {
+		api.router.Use(api.authMiddleware)
+		api.router.HandleFunc("/token", api.tokenHandler).Methods(http.MethodPost)
+	}
+	// Арендатор определяется после аутентификации,
+	// чтобы проверить, что клиент принадлежит ему.
+	if api.tenancy != nil {
+		api.router.Use(api.tenantMiddleware)
+		// Удаление арендатора уничтожает его данные, поэтому
+		// без аутентификации арендаторами управлять нельзя.
+		if api.auth != nil {
+			api.tenantEndpoints()
+		}
+	}
+	api.router.Use(api.callerMiddleware)
+	// Ограничение частоты следует за аутентификацией,
+	// чтобы учитывать запросы по клиенту, а не по адресу.
+	if api.limiter != nil {
+		api.router.Use(api.limiter.middleware)
+	}
+	api.router.HandleFunc("/posts", api.postsHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/posts", api.addPostHandler).Methods(http.MethodPost)
+	api.router.HandleFunc("/posts", api.updatePostHandler).Methods(http.MethodPut)
+	api.router.HandleFunc("/posts", api.deletePostHandler).Methods(http.MethodDelete)
+	api.router.HandleFunc("/posts/{id:[0-9]+}", api.postHandler).Methods(http.MethodGet)
+	api.commentEndpoints()
+	if api.bus != nil {
+		api.router.HandleFunc("/posts/stream", api.sseHandler).Methods(http.MethodGet)
+		api.router.HandleFunc("/posts/ws", api.wsHandler).Methods(http.MethodGet)
+	}
+	api.router.HandleFunc("/authors", api.authorsHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/authors", api.addAuthorHandler).Methods(http.MethodPost)
+	api.router.HandleFunc("/authors", api.deleteAuthorHandler).Methods(http.MethodDelete)
+	api.router.HandleFunc("/tags", api.tagsHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/tags", api.addTagHandler).Methods(http.MethodPost)
+	api.router.HandleFunc("/tags", api.deleteTagHandler).Methods(http.MethodDelete)
+	api.router.HandleFunc("/tags/cloud", api.tagCloudHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/feed.rss", api.rssHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/feed.atom", api.atomHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/openapi.json", api.openAPIHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/health", api.healthHandler).Methods(http.MethodGet)
+	api.router.HandleFunc(graphqlPath, api.graphqlHandler).Methods(http.MethodGet, http.MethodPost)
+	if api.webhooks != nil && api.auth != nil {
+		api.webhookEndpoints()
+	}
+
+	api.optionsEndpoints()
 }
 
 // Получение маршрутизатора запросов.
@@ -38,32 +124,133 @@ func (api *API) Router() *mux.Router {
 	return api.router
 }
 
-// Получение всех публикаций.
-func (api *API) postsHandler(w http.ResponseWriter, r *http.Request) {
-	posts, err := api.db.Posts()
+// dbFrom возвращает хранилище арендатора запроса,
+// а если арендаторов нет - общее хранилище.
+func (api *API) dbFrom(ctx context.Context) storage.Interface {
+	if t, ok := ctx.Value(tenantKey).(tenantStore); ok {
+		return storage.Bind(t.db, ctx)
+	}
+	return storage.Bind(api.db, ctx)
+}
+
+// callerMiddleware сообщает хранилищу, кто выполняет запрос:
+// клиент сразу видит свои изменения, даже если остальные
+// читают их с реплик позже.
+func (api *API) callerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := storage.WithCaller(r.Context(), api.caller(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// caller возвращает ключ клиента: автора, если клиент
+// аутентифицирован, а иначе его адрес.
+func (api *API) caller(r *http.Request) string {
+	if id, ok := IdentityFrom(r.Context()); ok {
+		return authorKey(id.Tenant, id.AuthorID)
+	}
+	if api.limiter != nil {
+		return "ip:" + api.limiter.clientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rulesFrom возвращает правила проверки для запроса. Авторы
+// у каждого арендатора свои, поэтому AuthorID проверяется
+// по хранилищу арендатора.
+func (api *API) rulesFrom(ctx context.Context) Rules {
+	rules := api.rules
+	if t, ok := ctx.Value(tenantKey).(tenantStore); ok {
+		rules.Authors = t.db
+	}
+	return rules
+}
+
+// store возвращает хранилище для обработки запроса. Если включена
+// аутентификация, изменения проходят проверку прав клиента.
+func (api *API) store(r *http.Request) storage.Interface {
+	db := api.dbFrom(r.Context())
+	if api.auth == nil {
+		return db
+	}
+	id, _ := IdentityFrom(r.Context())
+	return policy{Interface: db, id: id, ctx: r.Context()}
+}
+
+// writeError отправляет клиенту ошибку с подходящим кодом состояния.
+func writeError(w http.ResponseWriter, err error) {
+	var fe *ForbiddenError
+	switch {
+	case errors.As(err, &fe):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, storage.ErrInvalidTenant):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrEntryNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrEntryExists), errors.Is(err, storage.ErrEntryInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, storage.ErrDBNotResponding), errors.Is(err, storage.ErrConnectDB):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Получение всех публикаций. Параметры tag отбирают публикации
+// со всеми указанными метками, от новых к старым.
+func (api *API) postsHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		posts []storage.Post
+		err   error
+	)
+	if tags := storage.NormalizeTags(r.URL.Query()["tag"]); len(tags) > 0 {
+		posts, err = api.dbFrom(r.Context()).FilterPosts(storage.Filter{Tags: tags})
+	} else {
+		posts, err = api.dbFrom(r.Context()).Posts()
+	}
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	bytes, err := json.Marshal(posts)
+	api.respond(w, r, posts, api.lastModified(posts...))
+}
+
+// Получение публикации по ID.
+func (api *API) postHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Write(bytes)
+	p, err := api.dbFrom(r.Context()).Post(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	api.respond(w, r, p, api.lastModified(p))
 }
 
 // Добавление публикации.
 func (api *API) addPostHandler(w http.ResponseWriter, r *http.Request) {
-	var p storage.Post
-	err := json.NewDecoder(r.Body).Decode(&p)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	p, ok := api.decodePost(w, r)
+	if !ok {
 		return
 	}
-	err = api.db.AddPost(p)
+	// Автором публикации становится аутентифицированный клиент,
+	// а не тот, кто указан в теле запроса.
+	if id, ok := IdentityFrom(r.Context()); ok {
+		p.AuthorID = id.AuthorID
+	}
+	if invalid(w, api.rulesFrom(r.Context()).ValidateNew(p)) {
+		return
+	}
+	err := api.store(r).AddPost(p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -71,15 +258,13 @@ func (api *API) addPostHandler(w http.ResponseWriter, r *http.Request) {
 
 // Обновление публикации.
 func (api *API) updatePostHandler(w http.ResponseWriter, r *http.Request) {
-	var p storage.Post
-	err := json.NewDecoder(r.Body).Decode(&p)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	p, ok := api.decodePost(w, r)
+	if !ok || invalid(w, api.rulesFrom(r.Context()).ValidateUpdate(p)) {
 		return
 	}
-	err = api.db.UpdatePost(p)
+	err := api.store(r).UpdatePost(p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -87,15 +272,13 @@ func (api *API) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 
 // Удаление публикации.
 func (api *API) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	var p storage.Post
-	err := json.NewDecoder(r.Body).Decode(&p)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	p, ok := api.decodePost(w, r)
+	if !ok || invalid(w, api.rules.validateID(p)) {
 		return
 	}
-	err = api.db.DeletePost(p)
+	err := api.store(r).DeletePost(p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
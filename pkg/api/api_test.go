@@ -0,0 +1,428 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+// testDB returns a store with the test authors and posts.
+func testDB(t *testing.T) *memdb.Store {
+	t.Helper()
+	db := memdb.New()
+	for _, a := range storage.TestAuthors {
+		if err := db.AddAuthor(a); err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+	for _, tp := range storage.TestPosts {
+		if err := db.AddPost(tp); err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+	return db
+}
+
+// faultDB fails the methods listed in errs with the given errors
+// and passes other calls to the wrapped store.
+type faultDB struct {
+	*memdb.Store
+	errs map[string]error
+}
+
+func (db *faultDB) Posts() ([]storage.Post, error) {
+	if err := db.errs["Posts"]; err != nil {
+		return nil, err
+	}
+	return db.Store.Posts()
+}
+
+func (db *faultDB) Post(id int) (storage.Post, error) {
+	if err := db.errs["Post"]; err != nil {
+		return storage.Post{}, err
+	}
+	return db.Store.Post(id)
+}
+
+func (db *faultDB) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	if err := db.errs["FilterPosts"]; err != nil {
+		return nil, err
+	}
+	return db.Store.FilterPosts(f)
+}
+
+func (db *faultDB) AddPost(p storage.Post) error {
+	if err := db.errs["AddPost"]; err != nil {
+		return err
+	}
+	return db.Store.AddPost(p)
+}
+
+func (db *faultDB) UpdatePost(p storage.Post) error {
+	if err := db.errs["UpdatePost"]; err != nil {
+		return err
+	}
+	return db.Store.UpdatePost(p)
+}
+
+func (db *faultDB) DeletePost(p storage.Post) error {
+	if err := db.errs["DeletePost"]; err != nil {
+		return err
+	}
+	return db.Store.DeletePost(p)
+}
+
+func (db *faultDB) Authors() ([]storage.Author, error) {
+	if err := db.errs["Authors"]; err != nil {
+		return nil, err
+	}
+	return db.Store.Authors()
+}
+
+func (db *faultDB) Author(id int) (storage.Author, error) {
+	if err := db.errs["Author"]; err != nil {
+		return storage.Author{}, err
+	}
+	return db.Store.Author(id)
+}
+
+func (db *faultDB) AddAuthor(a storage.Author) error {
+	if err := db.errs["AddAuthor"]; err != nil {
+		return err
+	}
+	return db.Store.AddAuthor(a)
+}
+
+func (db *faultDB) DeleteAuthor(a storage.Author) error {
+	if err := db.errs["DeleteAuthor"]; err != nil {
+		return err
+	}
+	return db.Store.DeleteAuthor(a)
+}
+
+func (db *faultDB) Tags() ([]storage.Tag, error) {
+	if err := db.errs["Tags"]; err != nil {
+		return nil, err
+	}
+	return db.Store.Tags()
+}
+
+func (db *faultDB) AddTag(t storage.Tag) error {
+	if err := db.errs["AddTag"]; err != nil {
+		return err
+	}
+	return db.Store.AddTag(t)
+}
+
+func (db *faultDB) DeleteTag(t storage.Tag) error {
+	if err := db.errs["DeleteTag"]; err != nil {
+		return err
+	}
+	return db.Store.DeleteTag(t)
+}
+
+func (db *faultDB) Comments(postID int) ([]storage.Comment, error) {
+	if err := db.errs["Comments"]; err != nil {
+		return nil, err
+	}
+	return db.Store.Comments(postID)
+}
+
+func (db *faultDB) Comment(id int) (storage.Comment, error) {
+	if err := db.errs["Comment"]; err != nil {
+		return storage.Comment{}, err
+	}
+	return db.Store.Comment(id)
+}
+
+func (db *faultDB) AddComment(c storage.Comment) error {
+	if err := db.errs["AddComment"]; err != nil {
+		return err
+	}
+	return db.Store.AddComment(c)
+}
+
+func (db *faultDB) UpdateComment(c storage.Comment) error {
+	if err := db.errs["UpdateComment"]; err != nil {
+		return err
+	}
+	return db.Store.UpdateComment(c)
+}
+
+func (db *faultDB) DeleteComment(c storage.Comment) error {
+	if err := db.errs["DeleteComment"]; err != nil {
+		return err
+	}
+	return db.Store.DeleteComment(c)
+}
+
+func TestAPI_readPosts(t *testing.T) {
+	api := New(testDB(t))
+
+	rr := serveJSON(t, api, http.MethodGet, "/posts", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("expected Content-Type application/json, got %q", ct)
+	}
+	var posts []storage.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &posts); err != nil {
+		t.Fatalf("unexpected error decoding posts: %v", err)
+	}
+	if !reflect.DeepEqual(posts, storage.TestPosts) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts)
+	}
+
+	rr = serveJSON(t, api, http.MethodGet, "/posts/3", "")
+	var p storage.Post
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("unexpected error decoding post: %v", err)
+	}
+	if rr.Code != http.StatusOK || !reflect.DeepEqual(p, storage.TestPosts[2]) {
+		t.Errorf("expected post %+v with status %d, got %+v with status %d", storage.TestPosts[2], http.StatusOK, p, rr.Code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"missing post", http.MethodGet, "/posts/999", http.StatusNotFound},
+		{"non-numeric ID", http.MethodGet, "/posts/abc", http.StatusNotFound},
+		{"ID overflowing int", http.MethodGet, "/posts/99999999999999999999", http.StatusBadRequest},
+		{"unknown path", http.MethodGet, "/nothing", http.StatusNotFound},
+		{"unsupported method", http.MethodPatch, "/posts", http.StatusMethodNotAllowed},
+		{"unsupported method on post", http.MethodDelete, "/posts/1", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, tt.method, tt.target, "")
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+}
+
+func TestAPI_writePosts(t *testing.T) {
+	db := testDB(t)
+	api := New(db)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"create", http.MethodPost, `{"Title": "New post", "Content": "Text", "AuthorID": 2, "AuthorName": "Tom", "CreatedAt": 1644155400}`, http.StatusOK},
+		{"create without title", http.MethodPost, `{"Content": "Text", "AuthorID": 2}`, http.StatusUnprocessableEntity},
+		{"create with taken ID", http.MethodPost, `{"ID": 1, "Title": "T", "Content": "C", "AuthorID": 2}`, http.StatusConflict},
+		{"update", http.MethodPut, `{"ID": 2, "Title": "Updated", "Content": "Text", "AuthorID": 2, "AuthorName": "Tom", "CreatedAt": 1643809800, "PublishedAt": 1643809800}`, http.StatusOK},
+		{"update without ID", http.MethodPut, `{"Title": "Updated", "Content": "Text", "AuthorID": 2}`, http.StatusUnprocessableEntity},
+		{"update missing post", http.MethodPut, `{"ID": 999, "Title": "Updated", "Content": "Text", "AuthorID": 2}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, `{"ID": 1}`, http.StatusOK},
+		{"delete again", http.MethodDelete, `{"ID": 1}`, http.StatusNotFound},
+		{"delete without ID", http.MethodDelete, `{}`, http.StatusUnprocessableEntity},
+		{"malformed JSON", http.MethodPost, `{"Title": `, http.StatusBadRequest},
+		{"unknown field", http.MethodPut, `{"ID": 2, "Rating": 5}`, http.StatusBadRequest},
+		{"wrong field type", http.MethodDelete, `{"ID": "1"}`, http.StatusBadRequest},
+		{"empty body", http.MethodDelete, ``, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, tt.method, "/posts", tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+
+	posts, _ := db.Posts()
+	want := []storage.Post{storage.TestPosts[1], storage.TestPosts[2], storage.TestPosts[3], storage.TestPosts[4],
+		{ID: 6, Title: "New post", Content: "Text", AuthorID: 2, AuthorName: "Tom", CreatedAt: 1644155400}}
+	want[0].Title = "Updated"
+	want[0].Content = "Text"
+	if !reflect.DeepEqual(posts, want) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", want, posts)
+	}
+
+	// Validation errors name the fields.
+	rr := serveJSON(t, api, http.MethodPost, "/posts", `{"Content": "Text", "AuthorID": 0}`)
+	var resp validationErrors
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error decoding validation errors: %v", err)
+	}
+	if got := fields(resp.Errors); !reflect.DeepEqual(got, []string{"Title", "AuthorID"}) {
+		t.Errorf("expected errors in Title and AuthorID, got %v", got)
+	}
+}
+
+func TestAPI_authors(t *testing.T) {
+	db := testDB(t)
+	api := New(db)
+
+	rr := serveJSON(t, api, http.MethodGet, "/authors", "")
+	var authors []storage.Author
+	if err := json.Unmarshal(rr.Body.Bytes(), &authors); err != nil {
+		t.Fatalf("unexpected error decoding authors: %v", err)
+	}
+	if rr.Code != http.StatusOK || !reflect.DeepEqual(authors, storage.TestAuthors) {
+		t.Errorf("expected authors %+v with status %d, got %+v with status %d", storage.TestAuthors, http.StatusOK, authors, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %q", ct)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"create", http.MethodPost, `{"Name": "Ann"}`, http.StatusOK},
+		{"create with taken ID", http.MethodPost, `{"ID": 1, "Name": "Ann"}`, http.StatusConflict},
+		{"create without name", http.MethodPost, `{"Name": " "}`, http.StatusUnprocessableEntity},
+		{"create with long name", http.MethodPost, `{"Name": "` + strings.Repeat("a", 51) + `"}`, http.StatusUnprocessableEntity},
+		{"delete", http.MethodDelete, `{"ID": 4}`, http.StatusOK},
+		{"delete missing", http.MethodDelete, `{"ID": 4}`, http.StatusNotFound},
+		{"delete author of posts", http.MethodDelete, `{"ID": 1}`, http.StatusConflict},
+		{"delete without ID", http.MethodDelete, `{"Name": "Mark"}`, http.StatusUnprocessableEntity},
+		{"malformed JSON", http.MethodPost, `[]`, http.StatusBadRequest},
+		{"unsupported method", http.MethodPut, `{"ID": 1, "Name": "Mark"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, tt.method, "/authors", tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+
+	authors, _ = db.Authors()
+	if !reflect.DeepEqual(authors, storage.TestAuthors) {
+		t.Errorf("authors do not match expected authors. Expected: %+v, Got: %+v", storage.TestAuthors, authors)
+	}
+}
+
+func TestAPI_storageErrors(t *testing.T) {
+	errBroken := errors.New("disk failure")
+	post := `{"ID": 1, "Title": "T", "Content": "C", "AuthorID": 1}`
+
+	requests := []struct {
+		method string
+		target string
+		body   string
+		fails  string // the storage method handling the request
+	}{
+		{http.MethodGet, "/posts", "", "Posts"},
+		{http.MethodGet, "/posts/1", "", "Post"},
+		{http.MethodPost, "/posts", post, "AddPost"},
+		{http.MethodPut, "/posts", post, "UpdatePost"},
+		{http.MethodDelete, "/posts", post, "DeletePost"},
+		{http.MethodGet, "/authors", "", "Authors"},
+		{http.MethodPost, "/authors", `{"Name": "Ann"}`, "AddAuthor"},
+		{http.MethodDelete, "/authors", `{"ID": 1}`, "DeleteAuthor"},
+		{http.MethodGet, "/posts?tag=sport", "", "FilterPosts"},
+		{http.MethodGet, "/tags", "", "Tags"},
+		{http.MethodGet, "/tags/cloud", "", "Tags"},
+		{http.MethodPost, "/tags", `{"Name": "sport"}`, "AddTag"},
+		{http.MethodDelete, "/tags", `{"Name": "sport"}`, "DeleteTag"},
+		{http.MethodGet, "/posts/1/comments", "", "Comments"},
+		{http.MethodPost, "/posts/1/comments", `{"Content": "C", "AuthorID": 1}`, "AddComment"},
+		{http.MethodPut, "/posts/1/comments", `{"ID": 1, "Content": "C"}`, "Comment"},
+		{http.MethodDelete, "/posts/1/comments", `{"ID": 1}`, "Comment"},
+		{http.MethodGet, "/feed.rss", "", "FilterPosts"},
+		{http.MethodGet, "/feed.atom", "", "FilterPosts"},
+	}
+	errs := []struct {
+		err  error
+		want int
+	}{
+		{errBroken, http.StatusInternalServerError},
+		{storage.ErrDBNotResponding, http.StatusServiceUnavailable},
+		{storage.ErrConnectDB, http.StatusServiceUnavailable},
+		{storage.ErrEntryNotExist, http.StatusNotFound},
+		{storage.ErrEntryExists, http.StatusConflict},
+		{storage.ErrEntryInUse, http.StatusConflict},
+		{forbidden("not allowed"), http.StatusForbidden},
+	}
+	for _, req := range requests {
+		for _, e := range errs {
+			db := &faultDB{Store: testDB(t), errs: map[string]error{req.fails: e.err}}
+			rr := serveJSON(t, New(db), req.method, req.target, req.body)
+			if rr.Code != e.want {
+				t.Errorf("%s %s failing with %q: expected status %d, got %d", req.method, req.target, e.err, e.want, rr.Code)
+			}
+			// The error is reported to the client as text.
+			if !strings.Contains(rr.Body.String(), e.err.Error()) {
+				t.Errorf("%s %s failing with %q: expected the error in the body, got %q", req.method, req.target, e.err, rr.Body)
+			}
+		}
+	}
+}
+
+// boundDB records the requests the store is bound to.
+type boundDB struct {
+	*memdb.Store
+	ctxs *[]context.Context
+}
+
+func (db boundDB) Bind(ctx context.Context) storage.Interface {
+	*db.ctxs = append(*db.ctxs, ctx)
+	return db
+}
+
+func TestAPI_bindsRequest(t *testing.T) {
+	var ctxs []context.Context
+	api := New(boundDB{Store: testDB(t), ctxs: &ctxs})
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPut, "/posts", strings.NewReader(`{"ID": 1, "Title": "T", "Content": "C", "AuthorID": 1}`))
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req.WithContext(ctx))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+
+	// The storage sees the deadline and the caller of the request.
+	if len(ctxs) == 0 {
+		t.Fatal("expected the store to be bound to the request")
+	}
+	for _, c := range ctxs {
+		if d, ok := c.Deadline(); !ok || !d.Equal(deadline) {
+			t.Errorf("expected deadline %v, got %v", deadline, d)
+		}
+		if caller := storage.CallerFrom(c); caller != "ip:192.0.2.1" {
+			t.Errorf("expected caller %q, got %q", "ip:192.0.2.1", caller)
+		}
+	}
+}
+
+func TestAPI_options(t *testing.T) {
+	api := New(testDB(t))
+
+	tests := []struct {
+		target string
+		allow  string
+	}{
+		{"/posts", "DELETE, GET, OPTIONS, POST, PUT"},
+		{"/posts/1", "GET, OPTIONS"},
+		{"/authors", "DELETE, GET, OPTIONS, POST"},
+		{"/health", "GET, OPTIONS"},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, http.MethodOptions, tt.target, "")
+		if rr.Code != http.StatusNoContent || rr.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s: expected status %d with Allow %q, got %d with %q", tt.target, http.StatusNoContent, tt.allow, rr.Code, rr.Header().Get("Allow"))
+		}
+	}
+}
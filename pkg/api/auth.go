@@ -0,0 +1,281 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"GoNews/pkg/storage"
+)
+
+var (
+	ErrNoCredentials   = errors.New("missing credentials")
+	ErrInvalidAPIKey   = errors.New("invalid API key")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenExpired    = errors.New("token expired")
+	errUnsupportedAlgo = errors.New("unsupported token algorithm")
+)
+
+// Identity - аутентифицированный клиент API.
+type Identity struct {
+	AuthorID int    `json:"author_id"`
+	Role     string `json:"role"`
+	Tenant   string `json:"tenant,omitempty"` // арендатор клиента; пусто - все арендаторы
+}
+
+// APIKey - API-ключ и сопоставленный ему клиент.
+// Если роль не указана, клиент считается автором. Ключ, выданный
+// арендатору, действует только для его данных.
+type APIKey struct {
+	Key      string `json:"key"`
+	AuthorID int    `json:"author_id"`
+	Role     string `json:"role,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+}
+
+// ReadKeys читает список API-ключей из JSON-файла.
+func ReadKeys(path string) ([]APIKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.Role != "" && !validRole(k.Role) {
+			return nil, fmt.Errorf("API key for author %d: unknown role %q", k.AuthorID, k.Role)
+		}
+		if k.Tenant != "" {
+			if err := storage.CheckTenant(k.Tenant); err != nil {
+				return nil, fmt.Errorf("API key for author %d: %w", k.AuthorID, err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Auth проверяет API-ключи и выпускает подписанные HMAC токены.
+type Auth struct {
+	// Ключи хранятся в виде SHA-256 хешей, чтобы поиск по карте
+	// не зависел от содержимого ключа.
+	keys   map[[sha256.Size]byte]Identity
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewAuth создаёт объект аутентификации. Токены подписываются
+// ключом secret и действительны в течение ttl.
+func NewAuth(secret []byte, ttl time.Duration, keys ...APIKey) *Auth {
+	a := Auth{
+		keys:   make(map[[sha256.Size]byte]Identity),
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+	for _, k := range keys {
+		id := Identity{AuthorID: k.AuthorID, Role: k.Role, Tenant: k.Tenant}
+		if id.Role == "" {
+			id.Role = RoleAuthor
+		}
+		a.keys[sha256.Sum256([]byte(k.Key))] = id
+	}
+	return &a
+}
+
+// WithAuth включает аутентификацию запросов, изменяющих данные.
+func WithAuth(a *Auth) Option {
+	return func(api *API) {
+		api.auth = a
+	}
+}
+
+// claims - содержимое токена.
+type claims struct {
+	Identity
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// tokenHeader - заголовок токена в формате JWT.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// IssueToken выпускает токен для клиента. Токен имеет формат
+// JWT с подписью HS256.
+func (a *Auth) IssueToken(id Identity) (string, time.Time, error) {
+	now := a.now()
+	exp := now.Add(a.ttl)
+	payload, err := json.Marshal(claims{
+		Identity:  id,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + a.sign(unsigned), exp, nil
+}
+
+// ParseToken проверяет подпись и срок действия токена.
+func (a *Auth) ParseToken(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidToken
+	}
+	if parts[0] != tokenHeader {
+		return Identity{}, errUnsupportedAlgo
+	}
+	sig := a.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(sig), []byte(parts[2])) {
+		return Identity{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	var c claims
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	if a.now().Unix() >= c.ExpiresAt {
+		return Identity{}, ErrTokenExpired
+	}
+
+	return c.Identity, nil
+}
+
+func (a *Auth) sign(s string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// apiKey ищет клиента по API-ключу.
+func (a *Auth) apiKey(key string) (Identity, error) {
+	id, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Identity{}, ErrInvalidAPIKey
+	}
+	return id, nil
+}
+
+// Authenticate определяет клиента по заголовку X-API-Key
+// или Authorization: Bearer <токен>.
+func (a *Auth) Authenticate(r *http.Request) (Identity, error) {
+	return a.AuthenticateHeader(r.Header)
+}
+
+// AuthenticateHeader определяет клиента по заголовкам, переданным
+// не обязательно по HTTP, например в метаданных gRPC.
+func (a *Auth) AuthenticateHeader(header http.Header) (Identity, error) {
+	if key := header.Get("X-API-Key"); key != "" {
+		return a.apiKey(key)
+	}
+
+	h := header.Get("Authorization")
+	if h == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	const prefix = "Bearer "
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return Identity{}, ErrInvalidToken
+	}
+	return a.ParseToken(strings.TrimSpace(h[len(prefix):]))
+}
+
+type ctxKey int
+
+const (
+	identityKey ctxKey = iota
+	graphqlKey
+	tenantKey
+)
+
+// IdentityFrom возвращает клиента, аутентифицированного для запроса.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
+}
+
+// writeMethods - методы, для которых требуется аутентификация.
+var writeMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// isWrite сообщает, изменяет ли запрос данные. Запросы GraphQL
+// передаются методом POST и при этом могут только читать данные,
+// поэтому их тип определяется по содержимому.
+func isWrite(r *http.Request) bool {
+	if r.URL.Path == graphqlPath && r.Method == http.MethodPost {
+		return graphqlWrite(r)
+	}
+	return writeMethods[r.Method]
+}
+
+// authMiddleware аутентифицирует клиента. Запросы на чтение
+// допускаются анонимно, если учётные данные не переданы.
+func (api *API) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := api.auth.Authenticate(r)
+		if err == ErrNoCredentials && !isWrite(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			unauthorized(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gonews"`)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// tokenResponse - ответ на запрос токена.
+type tokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Выпуск токена по API-ключу.
+func (api *API) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		unauthorized(w, ErrNoCredentials)
+		return
+	}
+	id, err := api.auth.apiKey(key)
+	if err != nil {
+		unauthorized(w, err)
+		return
+	}
+
+	token, exp, err := api.auth.IssueToken(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResponse{Token: token, ExpiresAt: exp.Unix()})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAuth_token(t *testing.T) {
+	a := NewAuth([]byte("secret"), time.Hour)
+	now := time.Unix(1643723400, 0)
+	a.now = func() time.Time { return now }
+
+	token, _, err := a.IssueToken(Identity{AuthorID: 2})
+	if err != nil {
+		t.Fatalf("unexpected error issuing token: %v", err)
+	}
+	id, err := a.ParseToken(token)
+	if err != nil || id.AuthorID != 2 {
+		t.Errorf("expected identity of author 2, got %+v, error %v", id, err)
+	}
+
+	other := NewAuth([]byte("other"), time.Hour)
+	other.now = a.now
+	if _, err := other.ParseToken(token); err != ErrInvalidToken {
+		t.Errorf("expected error %v for foreign signature, got %v", ErrInvalidToken, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := a.ParseToken(token); err != ErrTokenExpired {
+		t.Errorf("expected error %v, got %v", ErrTokenExpired, err)
+	}
+}
+
+func TestAPI_auth(t *testing.T) {
+	db := memdb.New()
+	api := New(db, WithAuth(NewAuth([]byte("secret"), time.Hour, APIKey{Key: "key-tom", AuthorID: 2})))
+
+	post := `{"Title": "Title", "Content": "Text", "AuthorID": 1}`
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		want   int
+	}{
+		{"anonymous read", http.MethodGet, "", "", http.StatusOK},
+		{"anonymous write", http.MethodPost, "", "", http.StatusUnauthorized},
+		{"bad key", http.MethodPost, "X-API-Key", "nope", http.StatusUnauthorized},
+		{"bad token", http.MethodPost, "Authorization", "Bearer a.b.c", http.StatusUnauthorized},
+		{"valid key", http.MethodPost, "X-API-Key", "key-tom", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/posts", strings.NewReader(post))
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rr.Code)
+		}
+	}
+
+	// The token from /token must be accepted as well.
+	req := httptest.NewRequest(http.MethodPost, "/token", nil)
+	req.Header.Set("X-API-Key", "key-tom")
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	var resp tokenResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("expected token, got status %d", rr.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(post))
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rr = httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d with token, got %d", http.StatusOK, rr.Code)
+	}
+
+	// The author must come from the credentials, not from the body.
+	posts, _ := db.Posts()
+	for _, p := range posts {
+		if p.AuthorID != 2 {
+			t.Errorf("expected post by author 2, got %+v", p)
+		}
+	}
+	if len(posts) != 2 {
+		t.Errorf("expected 2 posts, got %d", len(posts))
+	}
+}
+
+func init() {
+	log.SetOutput(io.Discard)
+}
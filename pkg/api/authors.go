@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Получение всех авторов.
+func (api *API) authorsHandler(w http.ResponseWriter, r *http.Request) {
+	authors, err := api.dbFrom(r.Context()).Authors()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	bytes, err := json.Marshal(authors)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
+}
+
+// Добавление автора.
+func (api *API) addAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := api.decodeAuthor(w, r)
+	if !ok || invalid(w, api.rules.validateAuthor(a)) {
+		return
+	}
+	err := api.store(r).AddAuthor(a)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Удаление автора.
+func (api *API) deleteAuthorHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := api.decodeAuthor(w, r)
+	if !ok || invalid(w, api.rules.validateAuthorID(a)) {
+		return
+	}
+	err := api.store(r).DeleteAuthor(a)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"GoNews/pkg/storage"
+)
+
+// Регистрация обработчиков комментариев.
+func (api *API) commentEndpoints() {
+	const path = "/posts/{id:[0-9]+}/comments"
+	api.router.HandleFunc(path, api.commentsHandler).Methods(http.MethodGet)
+	api.router.HandleFunc(path, api.addCommentHandler).Methods(http.MethodPost)
+	api.router.HandleFunc(path, api.updateCommentHandler).Methods(http.MethodPut)
+	api.router.HandleFunc(path, api.deleteCommentHandler).Methods(http.MethodDelete)
+}
+
+// postID возвращает ID публикации из пути запроса.
+func postID(r *http.Request) int {
+	// Маршрут допускает только цифры, поэтому ошибка возможна
+	// лишь при переполнении; такой публикации всё равно нет.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	return id
+}
+
+// Получение комментариев к публикации в порядке создания.
+// Ответы ссылаются на комментарий в ParentID и следуют за ним.
+func (api *API) commentsHandler(w http.ResponseWriter, r *http.Request) {
+	comments, err := api.dbFrom(r.Context()).Comments(postID(r))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if comments == nil {
+		comments = []storage.Comment{}
+	}
+	writeJSON(w, http.StatusOK, comments)
+}
+
+// Добавление комментария или ответа на комментарий.
+func (api *API) addCommentHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := api.decodeComment(w, r)
+	if !ok {
+		return
+	}
+	// ID назначает хранилище, чтобы ответы следовали за комментариями.
+	c.ID = 0
+	c.PostID = postID(r)
+	// Автором комментария, как и публикации, становится
+	// аутентифицированный клиент.
+	if id, ok := IdentityFrom(r.Context()); ok {
+		c.AuthorID = id.AuthorID
+	}
+	c.CreatedAt = time.Now().Unix()
+	c.UpdatedAt = 0
+	if invalid(w, api.rulesFrom(r.Context()).validateComment(c)) {
+		return
+	}
+	err := api.store(r).AddComment(c)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Изменение текста комментария.
+func (api *API) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := api.decodeComment(w, r)
+	if !ok || invalid(w, api.rules.validateCommentUpdate(c)) {
+		return
+	}
+	if !api.postComment(w, r, c.ID) {
+		return
+	}
+	c.UpdatedAt = time.Now().Unix()
+	err := api.store(r).UpdateComment(c)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Удаление комментария вместе с ответами на него.
+func (api *API) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	c, ok := api.decodeComment(w, r)
+	if !ok || invalid(w, api.rules.validateCommentID(c)) {
+		return
+	}
+	if !api.postComment(w, r, c.ID) {
+		return
+	}
+	err := api.store(r).DeleteComment(c)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// postComment проверяет, что комментарий относится к публикации
+// из пути запроса. Если нет, ответ клиенту уже отправлен.
+func (api *API) postComment(w http.ResponseWriter, r *http.Request, id int) bool {
+	c, err := api.dbFrom(r.Context()).Comment(id)
+	if err == nil && c.PostID != postID(r) {
+		err = storage.ErrEntryNotExist
+	}
+	if err != nil {
+		writeError(w, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"GoNews/pkg/storage"
+)
+
+func TestAPI_comments(t *testing.T) {
+	api := New(testDB(t))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"comment", http.MethodPost, "/posts/1/comments", `{"Content": "First", "AuthorID": 2}`, http.StatusOK},
+		{"reply", http.MethodPost, "/posts/1/comments", `{"Content": "Reply", "AuthorID": 3, "ParentID": 1}`, http.StatusOK},
+		{"reply to reply", http.MethodPost, "/posts/1/comments", `{"Content": "Nested", "AuthorID": 2, "ParentID": 2}`, http.StatusOK},
+		{"second comment", http.MethodPost, "/posts/1/comments", `{"Content": "Second", "AuthorID": 1}`, http.StatusOK},
+		{"comment elsewhere", http.MethodPost, "/posts/2/comments", `{"Content": "Elsewhere", "AuthorID": 1}`, http.StatusOK},
+		{"comment on missing post", http.MethodPost, "/posts/42/comments", `{"Content": "Text", "AuthorID": 1}`, http.StatusNotFound},
+		{"reply to missing comment", http.MethodPost, "/posts/1/comments", `{"Content": "Text", "AuthorID": 1, "ParentID": 42}`, http.StatusNotFound},
+		{"reply across posts", http.MethodPost, "/posts/1/comments", `{"Content": "Text", "AuthorID": 1, "ParentID": 5}`, http.StatusNotFound},
+		{"empty comment", http.MethodPost, "/posts/1/comments", `{"Content": " ", "AuthorID": 1}`, http.StatusUnprocessableEntity},
+		{"long comment", http.MethodPost, "/posts/1/comments", `{"Content": "` + strings.Repeat("a", 5001) + `", "AuthorID": 1}`, http.StatusUnprocessableEntity},
+		{"third comment", http.MethodPost, "/posts/1/comments", `{"Content": "Text", "AuthorID": 3}`, http.StatusOK},
+		{"edit", http.MethodPut, "/posts/1/comments", `{"ID": 1, "Content": "Edited"}`, http.StatusOK},
+		{"edit without text", http.MethodPut, "/posts/1/comments", `{"ID": 1, "Content": ""}`, http.StatusUnprocessableEntity},
+		{"edit missing", http.MethodPut, "/posts/1/comments", `{"ID": 42, "Content": "Edited"}`, http.StatusNotFound},
+		{"edit under another post", http.MethodPut, "/posts/2/comments", `{"ID": 1, "Content": "Edited"}`, http.StatusNotFound},
+		{"delete thread", http.MethodDelete, "/posts/1/comments", `{"ID": 2}`, http.StatusOK},
+		{"delete missing", http.MethodDelete, "/posts/1/comments", `{"ID": 3}`, http.StatusNotFound},
+		{"delete without ID", http.MethodDelete, "/posts/1/comments", `{}`, http.StatusUnprocessableEntity},
+		{"malformed JSON", http.MethodPost, "/posts/1/comments", `[]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, tt.method, tt.target, tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+
+	var comments []storage.Comment
+	rr := serveJSON(t, api, http.MethodGet, "/posts/1/comments", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &comments); err != nil {
+		t.Fatalf("unexpected error decoding comments: %v", err)
+	}
+	// The reply and the reply to it are gone with the deleted thread.
+	var got []string
+	for _, c := range comments {
+		got = append(got, c.Content)
+	}
+	if rr.Code != http.StatusOK || strings.Join(got, ",") != "Edited,Second,Text" {
+		t.Errorf("expected comments Edited, Second and Text, got %+v with status %d", comments, rr.Code)
+	}
+	if len(comments) > 0 && (comments[0].CreatedAt == 0 || comments[0].UpdatedAt == 0) {
+		t.Errorf("expected the edited comment to have creation and update times, got %+v", comments[0])
+	}
+
+	if rr := serveJSON(t, api, http.MethodGet, "/posts/3/comments", ""); rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Errorf("expected an empty list, got %q with status %d", rr.Body, rr.Code)
+	}
+	if rr := serveJSON(t, api, http.MethodGet, "/posts/42/comments", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a missing post, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// Deleting a post deletes its comments.
+	if rr := serveJSON(t, api, http.MethodDelete, "/posts", `{"ID": 2}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d deleting post: %s", rr.Code, rr.Body)
+	}
+	if rr := serveJSON(t, api, http.MethodPut, "/posts/2/comments", `{"ID": 5, "Content": "Edited"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a comment of a deleted post, got %d", http.StatusNotFound, rr.Code)
+	}
+}
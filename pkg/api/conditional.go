@@ -0,0 +1,120 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"GoNews/pkg/storage"
+)
+
+// DefaultCacheControl разрешает кэшировать ответы, но требует
+// проверять их актуальность по ETag перед каждым использованием.
+const DefaultCacheControl = "no-cache"
+
+// WithCacheControl задаёт заголовок Cache-Control ответов с публикациями
+// и лент, например "public, max-age=60". Пустая строка отключает заголовок.
+func WithCacheControl(value string) Option {
+	return func(api *API) {
+		api.cacheControl = value
+	}
+}
+
+// lastModified возвращает время последнего изменения публикаций:
+// наибольшее из времени их создания и публикации и времени последнего
+// события шины. Правки и удаления времён публикаций не меняют, поэтому
+// без шины время изменения неизвестно и возвращается нулевое время:
+// актуальность ответа проверяется только по ETag. Время создания
+// и публикации задаёт клиент, поэтому они не могут быть позже
+// текущего момента.
+func (api *API) lastModified(posts ...storage.Post) time.Time {
+	if api.bus == nil {
+		return time.Time{}
+	}
+	now := time.Now().Unix()
+	var last int64
+	for _, p := range posts {
+		for _, v := range []int64{p.CreatedAt, p.PublishedAt} {
+			if v > now {
+				v = now
+			}
+			if v > last {
+				last = v
+			}
+		}
+	}
+	t := api.bus.Modified()
+	if last != 0 && time.Unix(last, 0).After(t) {
+		t = time.Unix(last, 0)
+	}
+	return t
+}
+
+// serveCached отправляет ответ с заголовками кэширования
+// и поддержкой условных запросов.
+func (api *API) serveCached(w http.ResponseWriter, r *http.Request, contentType string, body []byte, modified time.Time) {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	if api.cacheControl != "" {
+		h.Set("Cache-Control", api.cacheControl)
+	}
+	if notModified(w, r, etagOf(body), modified) {
+		return
+	}
+	w.Write(body)
+}
+
+// etagOf вычисляет строгий ETag по содержимому ответа.
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified устанавливает заголовки ETag и Last-Modified и проверяет
+// условия запроса If-None-Match и If-Modified-Since. Если представление
+// у клиента актуально, отправляет 304 Not Modified и возвращает true.
+// Нулевой modified не передаётся клиенту.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	h := w.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match имеет приоритет над If-Modified-Since.
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" || !etagMatch(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+
+	// Для ответа 304 заголовки содержимого не нужны.
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch выполняет слабое сравнение ETag из If-None-Match.
+func etagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAPI_conditional(t *testing.T) {
+	db := memdb.New()
+	db.AddAuthor(storage.Author{Name: "Mark"})
+	for _, tp := range storage.TestPosts {
+		db.AddPost(tp)
+	}
+	api := New(db, WithCacheControl("public, max-age=60"))
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, target := range []string{"/posts", "/posts/3"} {
+		rr := get(target, nil)
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected status %d with ETag, got %d %q", target, http.StatusOK, rr.Code, etag)
+		}
+		if cc := rr.Header().Get("Cache-Control"); cc != "public, max-age=60" {
+			t.Errorf("%s: unexpected Cache-Control %q", target, cc)
+		}
+
+		rr = get(target, http.Header{"If-None-Match": {etag}})
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("%s: expected empty %d for matching ETag, got %d", target, http.StatusNotModified, rr.Code)
+		}
+		// Representations in other formats have their own ETags.
+		rr = get(target, http.Header{"If-None-Match": {etag}, "Accept": {"application/xml"}})
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d for XML, got %d", target, http.StatusOK, rr.Code)
+		}
+	}
+
+	// Without an event bus edits and deletions are not seen in post times,
+	// so freshness is checked by ETag alone.
+	rr := get("/posts", nil)
+	if lm := rr.Header().Get("Last-Modified"); lm != "" {
+		t.Errorf("expected no Last-Modified without a bus, got %q", lm)
+	}
+	since := time.Now().UTC().Format(http.TimeFormat)
+	if rr := get("/posts", http.Header{"If-Modified-Since": {since}}); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d for If-Modified-Since without a bus, got %d", http.StatusOK, rr.Code)
+	}
+
+	// Edits change the ETag.
+	etag := get("/posts/3", nil).Header().Get("ETag")
+	p := storage.TestPosts[2]
+	p.Title = "Edited"
+	db.UpdatePost(p)
+	if rr := get("/posts/3", http.Header{"If-None-Match": {etag}}); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d after edit, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestAPI_lastModifiedBus(t *testing.T) {
+	bus := storage.NewBus(10)
+	api := New(memdb.New(), WithBus(bus))
+
+	// Without posts the bus still tells when the server learnt of changes.
+	if got := api.lastModified(); !got.Equal(bus.Modified()) {
+		t.Errorf("expected %v, got %v", bus.Modified(), got)
+	}
+	// Client-supplied times in the future do not move Last-Modified past now.
+	future := storage.Post{CreatedAt: time.Now().Add(time.Hour).Unix(), PublishedAt: time.Now().Add(time.Hour).Unix()}
+	if got := api.lastModified(future); got.After(time.Now()) {
+		t.Errorf("expected a time not after now, got %v", got)
+	}
+	before := bus.Modified()
+	time.Sleep(time.Millisecond)
+	bus.Publish(storage.EventDeleted, storage.Post{ID: 1})
+	if got := api.lastModified(storage.TestPosts...); !got.After(before) {
+		t.Errorf("expected a time after %v, got %v", before, got)
+	}
+}
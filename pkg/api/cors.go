@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CORS задаёт правила доступа к API из браузера со сторонних источников.
+type CORS struct {
+	// Разрешённые источники, например https://news.example.com.
+	// Значение "*" разрешает любой источник, а шаблон вида
+	// https://*.example.com - все его поддомены.
+	AllowedOrigins []string
+	AllowedMethods []string // методы, разрешённые в предварительных запросах
+	AllowedHeaders []string // заголовки, разрешённые в предварительных запросах
+	ExposedHeaders []string // заголовки ответа, доступные скрипту
+
+	AllowCredentials bool          // разрешить передачу cookie и заголовка Authorization
+	MaxAge           time.Duration // время кеширования предварительного запроса
+}
+
+// DefaultCORS возвращает правила CORS для заданных источников.
+func DefaultCORS(origins ...string) CORS {
+	return CORS{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		ExposedHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// WithCORS включает поддержку CORS.
+func WithCORS(c CORS) Option {
+	return func(api *API) {
+		api.cors = &c
+	}
+}
+
+// originAllowed проверяет, разрешён ли источник.
+func (c *CORS) originAllowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		switch {
+		case o == "*", strings.EqualFold(o, origin):
+			return true
+		case strings.Contains(o, "*."):
+			// https://*.example.com: схема и суффикс должны совпасть.
+			i := strings.Index(o, "*.")
+			if strings.HasPrefix(origin, o[:i]) && strings.HasSuffix(origin, o[i+1:]) && len(origin) > len(o)-1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware добавляет заголовки CORS и отвечает на предварительные запросы.
+func (c *CORS) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !c.originAllowed(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Вместе с учётными данными браузер не примет "*".
+		if containsFold(c.AllowedOrigins, "*") && !c.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(c.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !containsFold(c.AllowedMethods, method) {
+			http.Error(w, "method not allowed", http.StatusForbidden)
+			return
+		}
+		for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !containsFold(c.AllowedHeaders, header) {
+				http.Error(w, "header not allowed: "+header, http.StatusForbidden)
+				return
+			}
+		}
+
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+		if len(c.AllowedHeaders) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+		}
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// optionsEndpoints регистрирует обработчик OPTIONS для каждого пути,
+// чтобы такие запросы не попадали в обработчики других методов.
+func (api *API) optionsEndpoints() {
+	methods := make(map[string][]string)
+	var paths []string
+	api.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		ms, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		if _, ok := methods[path]; !ok {
+			paths = append(paths, path)
+		}
+		methods[path] = append(methods[path], ms...)
+		return nil
+	})
+
+	for _, path := range paths {
+		allow := append([]string{http.MethodOptions}, methods[path]...)
+		sort.Strings(allow)
+		value := strings.Join(allow, ", ")
+		api.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", value)
+			w.WriteHeader(http.StatusNoContent)
+		}).Methods(http.MethodOptions)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAPI_cors(t *testing.T) {
+	c := DefaultCORS("https://news.example.com", "https://*.example.org")
+	c.AllowCredentials = true
+	api := New(memdb.New(),
+		WithCORS(c),
+		WithAuth(NewAuth([]byte("secret"), time.Hour)),
+	)
+
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		reqMethod  string
+		reqHeaders string
+		wantCode   int
+		wantOrigin string
+	}{
+		{"preflight", http.MethodOptions, "https://news.example.com", http.MethodPut, "Content-Type, Authorization", http.StatusNoContent, "https://news.example.com"},
+		{"preflight subdomain", http.MethodOptions, "https://app.example.org", http.MethodDelete, "", http.StatusNoContent, "https://app.example.org"},
+		{"preflight foreign origin", http.MethodOptions, "https://evil.com", http.MethodPut, "", http.StatusForbidden, ""},
+		{"preflight bad method", http.MethodOptions, "https://news.example.com", http.MethodPatch, "", http.StatusForbidden, "https://news.example.com"},
+		{"preflight bad header", http.MethodOptions, "https://news.example.com", http.MethodPost, "X-Custom", http.StatusForbidden, "https://news.example.com"},
+		{"plain options", http.MethodOptions, "", "", "", http.StatusNoContent, ""},
+		{"simple request", http.MethodGet, "https://news.example.com", "", "", http.StatusOK, "https://news.example.com"},
+		{"simple foreign request", http.MethodGet, "https://evil.com", "", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/posts", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.reqMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+		}
+		if tt.reqHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+		}
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantCode {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantCode, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("%s: expected allowed origin %q, got %q", tt.name, tt.wantOrigin, got)
+		}
+		if tt.wantOrigin != "" && rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%s: expected credentials to be allowed", tt.name)
+		}
+	}
+}
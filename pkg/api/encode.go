@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoNews/pkg/storage"
+)
+
+// Encoder кодирует публикации в определённый формат. Encode получает
+// одну публикацию (storage.Post) или их список ([]storage.Post).
+type Encoder interface {
+	MediaType() string // тип содержимого, например application/json
+	Encode(w io.Writer, v interface{}) error
+}
+
+// WithEncoder добавляет формат представления публикаций
+// или заменяет формат с тем же типом содержимого.
+func WithEncoder(enc Encoder) Option {
+	return func(api *API) {
+		api.encoders.register(enc)
+	}
+}
+
+// encoders - реестр форматов в порядке предпочтения сервера.
+type encoders struct {
+	list []Encoder
+}
+
+func defaultEncoders() encoders {
+	var e encoders
+	e.register(jsonEncoder{})
+	e.register(xmlEncoder{})
+	e.register(csvEncoder{})
+	return e
+}
+
+func (e *encoders) register(enc Encoder) {
+	for i, old := range e.list {
+		if old.MediaType() == enc.MediaType() {
+			e.list[i] = enc
+			return
+		}
+	}
+	e.list = append(e.list, enc)
+}
+
+func (e *encoders) mediaTypes() []string {
+	var types []string
+	for _, enc := range e.list {
+		types = append(types, enc.MediaType())
+	}
+	return types
+}
+
+// mediaRange - элемент заголовка Accept.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func (m mediaRange) matches(mediaType string) bool {
+	parts := strings.SplitN(mediaType, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	return (m.typ == "*" || m.typ == parts[0]) && (m.subtype == "*" || m.subtype == parts[1])
+}
+
+// parseAccept разбирает заголовок Accept. Диапазоны с нулевым
+// весом остаются в списке: они запрещают соответствующий тип.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		parts := strings.SplitN(mt, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: parts[0], subtype: parts[1], q: q})
+	}
+	// Более точные диапазоны важнее шаблонов.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+	return ranges
+}
+
+func specificity(m mediaRange) int {
+	switch {
+	case m.typ == "*":
+		return 0
+	case m.subtype == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// negotiate выбирает формат по заголовку Accept. Без заголовка
+// используется первый зарегистрированный формат.
+func (e *encoders) negotiate(accept string) (Encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return e.list[0], true
+	}
+
+	ranges := parseAccept(accept)
+	var (
+		best  Encoder
+		bestQ float64
+	)
+	for _, enc := range e.list {
+		// Вес формата определяет самый точный подходящий диапазон.
+		for _, m := range ranges {
+			if !m.matches(enc.MediaType()) {
+				continue
+			}
+			if m.q > bestQ {
+				best, bestQ = enc, m.q
+			}
+			break
+		}
+	}
+	return best, best != nil
+}
+
+// respond отправляет публикации в формате, запрошенном клиентом.
+// modified - время последнего изменения публикаций для Last-Modified.
+func (api *API) respond(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	w.Header().Add("Vary", "Accept")
+	enc, ok := api.encoders.negotiate(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "supported media types: "+strings.Join(api.encoders.mediaTypes(), ", "), http.StatusNotAcceptable)
+		return
+	}
+
+	var buf bytes.Buffer
+	err := enc.Encode(&buf, v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.serveCached(w, r, enc.MediaType()+"; charset=utf-8", buf.Bytes(), modified)
+}
+
+// jsonEncoder - представление в формате JSON.
+type jsonEncoder struct{}
+
+func (jsonEncoder) MediaType() string { return "application/json" }
+
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// xmlPost - публикация в формате XML.
+type xmlPost struct {
+	XMLName xml.Name `xml:"post"`
+	storage.Post
+}
+
+// xmlPosts - список публикаций в формате XML.
+type xmlPosts struct {
+	XMLName xml.Name  `xml:"posts"`
+	Posts   []xmlPost `xml:"post"`
+}
+
+// xmlEncoder - представление в формате XML.
+type xmlEncoder struct{}
+
+func (xmlEncoder) MediaType() string { return "application/xml" }
+
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	var doc interface{}
+	switch v := v.(type) {
+	case storage.Post:
+		doc = xmlPost{Post: v}
+	case []storage.Post:
+		list := xmlPosts{Posts: []xmlPost{}}
+		for _, p := range v {
+			list.Posts = append(list.Posts, xmlPost{Post: p})
+		}
+		doc = list
+	default:
+		return fmt.Errorf("xml: unsupported value %T", v)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(doc)
+}
+
+// csvHeader - заголовок таблицы публикаций. Метки
+// публикации перечисляются в одной ячейке через запятую.
+var csvHeader = []string{"id", "title", "content", "author_id", "author_name", "created_at", "published_at", "tags"}
+
+// csvEncoder - представление в виде таблицы CSV с заголовком.
+type csvEncoder struct{}
+
+func (csvEncoder) MediaType() string { return "text/csv" }
+
+func (csvEncoder) Encode(w io.Writer, v interface{}) error {
+	var posts []storage.Post
+	switch v := v.(type) {
+	case storage.Post:
+		posts = []storage.Post{v}
+	case []storage.Post:
+		posts = v
+	default:
+		return fmt.Errorf("csv: unsupported value %T", v)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, p := range posts {
+		cw.Write([]string{
+			strconv.Itoa(p.ID),
+			p.Title,
+			p.Content,
+			strconv.Itoa(p.AuthorID),
+			p.AuthorName,
+			strconv.FormatInt(p.CreatedAt, 10),
+			strconv.FormatInt(p.PublishedAt, 10),
+			strings.Join(p.Tags, ","),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestEncoders_negotiate(t *testing.T) {
+	e := defaultEncoders()
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/*", "text/csv"},
+		{"text/csv;q=0.5, application/xml;q=0.9", "application/xml"},
+		{"application/json;q=0, */*;q=0.1", "application/xml"},
+		{"text/html", ""},
+	}
+	for _, tt := range tests {
+		enc, ok := e.negotiate(tt.accept)
+		got := ""
+		if ok {
+			got = enc.MediaType()
+		}
+		if got != tt.want {
+			t.Errorf("Accept %q: expected %q, got %q", tt.accept, tt.want, got)
+		}
+	}
+}
+
+// yamlEncoder checks that formats can be plugged in from outside.
+type yamlEncoder struct{}
+
+func (yamlEncoder) MediaType() string { return "application/yaml" }
+
+func (yamlEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, "title: "+v.(storage.Post).Title+"\n")
+	return err
+}
+
+func TestAPI_contentNegotiation(t *testing.T) {
+	db := memdb.New()
+	for _, tp := range storage.TestPosts {
+		db.AddPost(tp)
+	}
+	api := New(db, WithEncoder(yamlEncoder{}))
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/posts", "application/xml")
+	var list xmlPosts
+	err := xml.Unmarshal(rr.Body.Bytes(), &list)
+	if err != nil || len(list.Posts) != len(storage.TestPosts) || list.Posts[0].Title != "Post 1" {
+		t.Errorf("unexpected XML listing %+v, error %v", list, err)
+	}
+
+	rr = get("/posts/2", "text/csv")
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil || len(records) != 2 || records[1][1] != "Post 2" {
+		t.Errorf("unexpected CSV post %v, error %v", records, err)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("expected text/csv content type, got %q", ct)
+	}
+
+	rr = get("/posts/3", "application/yaml")
+	if rr.Body.String() != "title: Post 3\n" {
+		t.Errorf("unexpected YAML post %q", rr.Body.String())
+	}
+
+	if rr := get("/posts", "text/html"); rr.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, rr.Code)
+	}
+	if rr := get("/posts/42", "application/json"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
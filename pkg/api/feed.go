@@ -0,0 +1,266 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoNews/pkg/storage"
+)
+
+// FeedInfo задаёт описание лент публикаций.
+type FeedInfo struct {
+	Title       string
+	Description string
+	// Адрес сайта, например https://news.example.com. Если не задан,
+	// определяется по запросу.
+	Link string
+	// Число публикаций в ленте по умолчанию и максимальное
+	// число публикаций, которое можно запросить параметром limit.
+	Size, MaxSize int
+}
+
+// DefaultFeedInfo возвращает описание лент по умолчанию.
+func DefaultFeedInfo() FeedInfo {
+	return FeedInfo{
+		Title:       "GoNews",
+		Description: "Latest news",
+		Size:        20,
+		MaxSize:     100,
+	}
+}
+
+// WithFeedInfo задаёт описание лент публикаций.
+func WithFeedInfo(info FeedInfo) Option {
+	return func(api *API) {
+		api.feed = info
+	}
+}
+
+// feed - содержимое ленты, общее для RSS и Atom.
+type feed struct {
+	title       string
+	description string
+	link        string
+	self        string
+	updated     time.Time
+	posts       []storage.Post
+}
+
+// loadFeed выбирает последние опубликованные публикации согласно
+// параметрам запроса: author - ID автора, tag - метки, которые
+// должны быть у публикаций, limit - размер ленты.
+func (api *API) loadFeed(w http.ResponseWriter, r *http.Request) (feed, bool) {
+	f := feed{
+		title:       api.feed.Title,
+		description: api.feed.Description,
+		link:        api.feed.Link,
+	}
+	if f.link == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		f.link = scheme + "://" + r.Host
+	}
+	f.self = f.link + r.URL.RequestURI()
+
+	filter := storage.Filter{
+		PublishedUntil: time.Now().Unix(),
+		Limit:          api.feed.Size,
+	}
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > api.feed.MaxSize {
+			http.Error(w, "limit must be an integer from 1 to "+strconv.Itoa(api.feed.MaxSize), http.StatusBadRequest)
+			return f, false
+		}
+		filter.Limit = n
+	}
+	if v := q.Get("author"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			http.Error(w, "author must be a positive integer", http.StatusBadRequest)
+			return f, false
+		}
+		a, err := api.dbFrom(r.Context()).Author(id)
+		if err != nil {
+			writeError(w, err)
+			return f, false
+		}
+		filter.AuthorID = id
+		f.title += ": " + a.Name
+	}
+	if tags := storage.NormalizeTags(q["tag"]); len(tags) > 0 {
+		filter.Tags = tags
+		f.title += ": " + strings.Join(tags, ", ")
+	}
+
+	posts, err := api.dbFrom(r.Context()).FilterPosts(filter)
+	if err != nil {
+		writeError(w, err)
+		return f, false
+	}
+	f.posts = posts
+	// Публикации упорядочены от новых к старым.
+	if len(posts) > 0 {
+		f.updated = time.Unix(posts[0].PublishedAt, 0).UTC()
+	}
+	return f, true
+}
+
+// serveFeed отправляет ленту с поддержкой условных запросов.
+func (api *API) serveFeed(w http.ResponseWriter, r *http.Request, contentType string, doc interface{}, posts []storage.Post) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	err := xml.NewEncoder(&buf).Encode(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	api.serveCached(w, r, contentType, buf.Bytes(), api.lastModified(posts...))
+}
+
+// Лента RSS 2.0.
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Получение ленты RSS 2.0.
+func (api *API) rssHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := api.loadFeed(w, r)
+	if !ok {
+		return
+	}
+
+	doc := rss{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.title,
+			Link:        f.link,
+			Description: f.description,
+			Self:        atomLink{Href: f.self, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !f.updated.IsZero() {
+		doc.Channel.LastBuildDate = f.updated.Format(time.RFC1123Z)
+	}
+	for _, p := range f.posts {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       p.Title,
+			Description: p.Content,
+			GUID:        rssGUID{Value: postURN(p)},
+			PubDate:     time.Unix(p.PublishedAt, 0).UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	api.serveFeed(w, r, "application/rss+xml; charset=utf-8", doc, f.posts)
+}
+
+// Лента Atom.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Получение ленты Atom.
+func (api *API) atomHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := api.loadFeed(w, r)
+	if !ok {
+		return
+	}
+
+	updated := f.updated
+	if updated.IsZero() {
+		updated = time.Unix(0, 0).UTC()
+	}
+	doc := atomFeed{
+		Title:   f.title,
+		ID:      f.self,
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.self, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.link, Rel: "alternate"},
+		},
+	}
+	for _, p := range f.posts {
+		published := time.Unix(p.PublishedAt, 0).UTC().Format(time.RFC3339)
+		author := p.AuthorName
+		if author == "" {
+			author = "Author " + strconv.Itoa(p.AuthorID)
+		}
+		doc.Entries = append(doc.Entries, atomEntry{
+			Title:     p.Title,
+			ID:        postURN(p),
+			Published: published,
+			Updated:   published,
+			Author:    atomAuthor{Name: author},
+			Content:   atomContent{Type: "text", Value: p.Content},
+		})
+	}
+
+	api.serveFeed(w, r, "application/atom+xml; charset=utf-8", doc, f.posts)
+}
+
+// postURN возвращает постоянный идентификатор публикации в ленте.
+func postURN(p storage.Post) string {
+	return "urn:gonews:post:" + strconv.Itoa(p.ID)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAPI_feeds(t *testing.T) {
+	db := memdb.New()
+	db.AddAuthor(storage.Author{ID: 1, Name: "Mark"})
+	for _, tp := range storage.TestPosts {
+		db.AddPost(tp)
+	}
+	// A draft must not appear in the feeds.
+	db.AddPost(storage.Post{ID: 10, Title: "Draft", AuthorID: 1})
+	// Last-Modified needs the event bus as the modification clock.
+	api := New(db, WithBus(storage.NewBus(10)))
+
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/feed.rss", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var doc rss
+	err := xml.Unmarshal(rr.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("unexpected error decoding RSS: %v", err)
+	}
+	if len(doc.Channel.Items) != len(storage.TestPosts) || doc.Channel.Items[0].Title != "Post 5" {
+		t.Errorf("expected %d items starting with Post 5, got %+v", len(storage.TestPosts), doc.Channel.Items)
+	}
+	wantDate := time.Unix(storage.TestPosts[4].PublishedAt, 0).UTC().Format(time.RFC1123Z)
+	if doc.Channel.Items[0].PubDate != wantDate {
+		t.Errorf("expected pubDate %q, got %q", wantDate, doc.Channel.Items[0].PubDate)
+	}
+
+	// Conditional requests are answered with 304.
+	etag := rr.Header().Get("ETag")
+	if rr := get("/feed.rss", http.Header{"If-None-Match": {etag}}); rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d for matching ETag, got %d", http.StatusNotModified, rr.Code)
+	}
+	lastMod := rr.Header().Get("Last-Modified")
+	if rr := get("/feed.rss", http.Header{"If-Modified-Since": {lastMod}}); rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d for If-Modified-Since, got %d", http.StatusNotModified, rr.Code)
+	}
+
+	rr = get("/feed.atom?author=1&limit=1", nil)
+	var atom atomFeed
+	err = xml.Unmarshal(rr.Body.Bytes(), &atom)
+	if err != nil {
+		t.Fatalf("unexpected error decoding Atom: %v", err)
+	}
+	if atom.Title != "GoNews: Mark" || len(atom.Entries) != 1 || atom.Entries[0].Title != "Post 3" {
+		t.Errorf("expected Mark's latest post in the author feed, got %+v", atom)
+	}
+
+	// Tags are normalized and must all be present.
+	p := storage.TestPosts[1]
+	p.Tags = []string{"go", "news"}
+	db.UpdatePost(p)
+	p = storage.TestPosts[3]
+	p.Tags = []string{"go"}
+	db.UpdatePost(p)
+	rr = get("/feed.atom?tag=News&tag=+GO&tag=", nil)
+	atom = atomFeed{}
+	err = xml.Unmarshal(rr.Body.Bytes(), &atom)
+	if err != nil {
+		t.Fatalf("unexpected error decoding Atom: %v", err)
+	}
+	if atom.Title != "GoNews: go, news" || len(atom.Entries) != 1 || atom.Entries[0].Title != "Post 2" {
+		t.Errorf("expected only Post 2 in the tag feed, got %+v", atom)
+	}
+
+	if rr := get("/feed.atom?author=42", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for unknown author, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := get("/feed.rss?limit=1000", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for too large limit, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
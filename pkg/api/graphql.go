@@ -0,0 +1,697 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// graphqlPath - адрес GraphQL API.
+const graphqlPath = "/graphql"
+
+// graphqlSchema - схема GraphQL API.
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+"Время в секундах Unix."
+scalar Timestamp
+
+type Query {
+	"Публикации от новых к старым. tags отбирает публикации со всеми указанными метками."
+	posts(authorID: Int, tags: [String!], publishedUntil: Timestamp, offset: Int = 0, limit: Int = 20): [Post!]!
+	post(id: Int!): Post
+	authors: [Author!]!
+	author(id: Int!): Author
+	"Метки по алфавиту."
+	tags: [Tag!]!
+}
+
+type Mutation {
+	createPost(input: PostInput!): Boolean!
+	updatePost(id: Int!, input: PostInput!): Post!
+	deletePost(id: Int!): Boolean!
+}
+
+type Post {
+	id: Int!
+	title: String!
+	content: String!
+	author: Author!
+	createdAt: Timestamp!
+	"Не задано у черновиков."
+	publishedAt: Timestamp
+	"Метки по алфавиту."
+	tags: [String!]!
+}
+
+type Tag {
+	name: String!
+	"Число публикаций с меткой."
+	posts: Int!
+}
+
+type Author {
+	id: Int!
+	name: String!
+	"Публикации автора от новых к старым."
+	posts(offset: Int = 0, limit: Int = 20): [Post!]!
+}
+
+"Поля, не указанные в updatePost, сохраняют прежние значения."
+input PostInput {
+	title: String!
+	content: String!
+	"При включённой аутентификации автором новой публикации становится клиент."
+	authorID: Int
+	createdAt: Timestamp
+	"0 снимает публикацию."
+	publishedAt: Timestamp
+	tags: [String!]
+}
+`
+
+// Ограничения запросов GraphQL.
+const (
+	graphqlMaxLimit = 100 // максимальный размер страницы публикаций
+	graphqlMaxDepth = 10  // максимальная вложенность запроса
+	// Число публикаций, которое может запросить один запрос. Вложенные
+	// списки умножают его на каждом уровне: posts { author { posts } }
+	// с limit 100 запрашивает 100 списков по 100 публикаций.
+	graphqlMaxCost = 10000
+)
+
+// buildGraphQL разбирает схему GraphQL API.
+func (api *API) buildGraphQL() {
+	api.graphql = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{api: api},
+		graphql.MaxDepth(graphqlMaxDepth))
+}
+
+// graphqlRequest - запрос GraphQL по HTTP.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// Выполнение запроса GraphQL. Запросы на чтение принимаются
+// методами GET и POST, мутации - только методом POST.
+func (api *API) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			err := json.Unmarshal([]byte(v), &req.Variables)
+			if err != nil {
+				http.Error(w, "variables: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if hasMutation(req.Query) {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "mutations must be sent with POST", http.StatusMethodNotAllowed)
+			return
+		}
+	} else if !api.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return
+	}
+
+	// Тип запроса для аутентификации определяется по тексту документа,
+	// поэтому мутации дополнительно проверяются при выполнении.
+	mutable := r.Method == http.MethodPost
+	if api.auth != nil {
+		_, ok := IdentityFrom(r.Context())
+		mutable = mutable && ok
+	}
+	ctx := context.WithValue(r.Context(), graphqlKey, &graphqlState{
+		store:   api.store(r),
+		mutable: mutable,
+		authors: &authorLoader{db: api.dbFrom(r.Context())},
+	})
+	resp := api.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// graphqlState - данные одного запроса GraphQL.
+type graphqlState struct {
+	store   storage.Interface // хранилище с проверкой прав клиента
+	mutable bool              // запрос может изменять данные
+	authors *authorLoader
+
+	mu   sync.Mutex
+	cost int // запрошено публикаций
+}
+
+// errTooExpensive - запрос превысил graphqlMaxCost.
+var errTooExpensive = &graphqlError{
+	msg:  fmt.Sprintf("query requests more than %d posts", graphqlMaxCost),
+	code: "TOO_EXPENSIVE",
+}
+
+// charge учитывает n запрошенных публикаций до обращения к хранилищу.
+// После превышения бюджета все следующие списки запроса отклоняются,
+// поэтому вложенные списки не умножают работу хранилища.
+func (st *graphqlState) charge(n int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.cost += n
+	if st.cost > graphqlMaxCost {
+		return errTooExpensive
+	}
+	return nil
+}
+
+func stateFrom(ctx context.Context) *graphqlState {
+	return ctx.Value(graphqlKey).(*graphqlState)
+}
+
+// errNotMutable - мутация в запросе, который не может изменять данные.
+var errNotMutable = &graphqlError{
+	msg:  "mutations require an authenticated POST request",
+	code: "UNAUTHENTICATED",
+}
+
+// writer возвращает хранилище для мутации, если запрос
+// может изменять данные.
+func writer(ctx context.Context) (storage.Interface, error) {
+	st := stateFrom(ctx)
+	if !st.mutable {
+		return nil, errNotMutable
+	}
+	return st.store, nil
+}
+
+// authorLoader загружает авторов публикаций одного запроса.
+// Авторы, которые понадобятся, объявляются заранее, и при первом
+// обращении загружаются одним запросом к хранилищу вместо
+// отдельного запроса на каждую публикацию.
+type authorLoader struct {
+	db storage.Interface
+
+	mu      sync.Mutex
+	pending map[int]bool
+	cache   map[int]*storage.Author // nil - автора нет в хранилище
+}
+
+// prime объявляет авторов, которые понадобятся.
+func (l *authorLoader) prime(posts []storage.Post) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending == nil {
+		l.pending = make(map[int]bool)
+	}
+	for _, p := range posts {
+		if _, ok := l.cache[p.AuthorID]; !ok {
+			l.pending[p.AuthorID] = true
+		}
+	}
+}
+
+// load возвращает автора по ID. Если загружать нужно нескольких
+// авторов, они читаются из хранилища все сразу.
+func (l *authorLoader) load(id int) (storage.Author, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.cache[id]; !ok {
+		err := l.fetch(id)
+		if err != nil {
+			return storage.Author{}, err
+		}
+	}
+	a := l.cache[id]
+	if a == nil {
+		return storage.Author{}, storage.ErrEntryNotExist
+	}
+	return *a, nil
+}
+
+// fetch загружает автора id и всех объявленных авторов.
+func (l *authorLoader) fetch(id int) error {
+	if l.cache == nil {
+		l.cache = make(map[int]*storage.Author)
+	}
+	if l.pending == nil {
+		l.pending = make(map[int]bool)
+	}
+	l.pending[id] = true
+
+	if len(l.pending) == 1 {
+		a, err := l.db.Author(id)
+		switch {
+		case errors.Is(err, storage.ErrEntryNotExist):
+			l.cache[id] = nil
+		case err != nil:
+			return err
+		default:
+			l.cache[id] = &a
+		}
+	} else {
+		authors, err := l.db.Authors()
+		if err != nil {
+			return err
+		}
+		for pid := range l.pending {
+			l.cache[pid] = nil
+		}
+		for i := range authors {
+			if l.pending[authors[i].ID] {
+				l.cache[authors[i].ID] = &authors[i]
+			}
+		}
+	}
+	l.pending = nil
+	return nil
+}
+
+// timestamp - скаляр Timestamp: время в секундах Unix.
+// Встроенный тип Int для него мал, он 32-битный.
+type timestamp int64
+
+func (timestamp) ImplementsGraphQLType(name string) bool {
+	return name == "Timestamp"
+}
+
+func (t *timestamp) UnmarshalGraphQL(input interface{}) error {
+	switch v := input.(type) {
+	case int32:
+		*t = timestamp(v)
+	case int64:
+		*t = timestamp(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("timestamp must be an integer, got %v", v)
+		}
+		*t = timestamp(v)
+	default:
+		return fmt.Errorf("wrong type for Timestamp: %T", v)
+	}
+	return nil
+}
+
+// graphqlError - ошибка с кодом в поле extensions ответа.
+type graphqlError struct {
+	msg    string
+	code   string
+	fields []FieldError
+}
+
+func (e *graphqlError) Error() string {
+	return e.msg
+}
+
+func (e *graphqlError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.code}
+	if len(e.fields) > 0 {
+		ext["fields"] = e.fields
+	}
+	return ext
+}
+
+// graphqlErr преобразует ошибку хранилища в ошибку GraphQL.
+func graphqlErr(err error) error {
+	var fe *ForbiddenError
+	switch {
+	case errors.As(err, &fe):
+		return &graphqlError{msg: err.Error(), code: "FORBIDDEN"}
+	case errors.Is(err, storage.ErrEntryNotExist):
+		return &graphqlError{msg: err.Error(), code: "NOT_FOUND"}
+	case errors.Is(err, storage.ErrEntryExists), errors.Is(err, storage.ErrEntryInUse):
+		return &graphqlError{msg: err.Error(), code: "CONFLICT"}
+	case errors.Is(err, storage.ErrDBNotResponding), errors.Is(err, storage.ErrConnectDB):
+		return &graphqlError{msg: err.Error(), code: "UNAVAILABLE"}
+	default:
+		log.Errorf("graphql: %v", err)
+		return &graphqlError{msg: err.Error(), code: "INTERNAL"}
+	}
+}
+
+// graphqlInvalid возвращает ошибку проверки, если она есть.
+func graphqlInvalid(errs []FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &graphqlError{msg: "validation failed", code: "INVALID", fields: errs}
+}
+
+// page проверяет параметры страницы.
+func page(offset, limit int32) error {
+	var errs []FieldError
+	if offset < 0 {
+		errs = append(errs, FieldError{Field: "offset", Message: "must not be negative"})
+	}
+	if limit <= 0 || limit > graphqlMaxLimit {
+		errs = append(errs, FieldError{Field: "limit", Message: fmt.Sprintf("must be from 1 to %d", graphqlMaxLimit)})
+	}
+	return graphqlInvalid(errs)
+}
+
+// graphqlResolver - корневой объект запросов и мутаций.
+type graphqlResolver struct {
+	api *API
+}
+
+func (res *graphqlResolver) posts(ctx context.Context, f storage.Filter) ([]*postResolver, error) {
+	state := stateFrom(ctx)
+	err := state.charge(f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := res.api.dbFrom(ctx).FilterPosts(f)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	state.authors.prime(posts)
+	list := make([]*postResolver, 0, len(posts))
+	for _, p := range posts {
+		list = append(list, &postResolver{res: res, p: p})
+	}
+	return list, nil
+}
+
+func (res *graphqlResolver) Posts(ctx context.Context, args struct {
+	AuthorID       *int32
+	Tags           *[]string
+	PublishedUntil *timestamp
+	Offset         int32
+	Limit          int32
+}) ([]*postResolver, error) {
+	err := page(args.Offset, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	f := storage.Filter{Offset: int(args.Offset), Limit: int(args.Limit)}
+	if args.AuthorID != nil {
+		f.AuthorID = int(*args.AuthorID)
+	}
+	if args.Tags != nil {
+		f.Tags = storage.NormalizeTags(*args.Tags)
+	}
+	if args.PublishedUntil != nil {
+		f.PublishedUntil = int64(*args.PublishedUntil)
+	}
+	return res.posts(ctx, f)
+}
+
+func (res *graphqlResolver) Post(ctx context.Context, args struct{ ID int32 }) (*postResolver, error) {
+	p, err := res.api.dbFrom(ctx).Post(int(args.ID))
+	if errors.Is(err, storage.ErrEntryNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return &postResolver{res: res, p: p}, nil
+}
+
+func (res *graphqlResolver) Authors(ctx context.Context) ([]*authorResolver, error) {
+	authors, err := res.api.dbFrom(ctx).Authors()
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	list := make([]*authorResolver, 0, len(authors))
+	for _, a := range authors {
+		list = append(list, &authorResolver{res: res, a: a})
+	}
+	return list, nil
+}
+
+func (res *graphqlResolver) Author(ctx context.Context, args struct{ ID int32 }) (*authorResolver, error) {
+	a, err := res.api.dbFrom(ctx).Author(int(args.ID))
+	if errors.Is(err, storage.ErrEntryNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return &authorResolver{res: res, a: a}, nil
+}
+
+func (res *graphqlResolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	tags, err := res.api.dbFrom(ctx).Tags()
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	list := make([]*tagResolver, 0, len(tags))
+	for _, t := range tags {
+		list = append(list, &tagResolver{t: t})
+	}
+	return list, nil
+}
+
+// postInput - публикация во входных данных мутаций.
+type postInput struct {
+	Title       string
+	Content     string
+	AuthorID    *int32
+	CreatedAt   *timestamp
+	PublishedAt *timestamp
+	Tags        *[]string
+}
+
+// post возвращает новую публикацию.
+func (in postInput) post() storage.Post {
+	return in.update(storage.Post{})
+}
+
+// update заменяет в публикации p поля, указанные во входных данных.
+func (in postInput) update(p storage.Post) storage.Post {
+	p.Title, p.Content = in.Title, in.Content
+	if in.Tags != nil {
+		p.Tags = *in.Tags
+	}
+	if in.AuthorID != nil {
+		p.AuthorID = int(*in.AuthorID)
+	}
+	if in.CreatedAt != nil {
+		p.CreatedAt = int64(*in.CreatedAt)
+	}
+	if in.PublishedAt != nil {
+		p.PublishedAt = int64(*in.PublishedAt)
+	}
+	return p
+}
+
+func (res *graphqlResolver) CreatePost(ctx context.Context, args struct{ Input postInput }) (bool, error) {
+	db, err := writer(ctx)
+	if err != nil {
+		return false, err
+	}
+	p := args.Input.post()
+	// Автором публикации становится аутентифицированный клиент.
+	if id, ok := IdentityFrom(ctx); ok {
+		p.AuthorID = id.AuthorID
+	}
+	err = graphqlInvalid(res.api.rulesFrom(ctx).ValidateNew(p))
+	if err != nil {
+		return false, err
+	}
+	err = db.AddPost(p)
+	if err != nil {
+		return false, graphqlErr(err)
+	}
+	return true, nil
+}
+
+func (res *graphqlResolver) UpdatePost(ctx context.Context, args struct {
+	ID    int32
+	Input postInput
+}) (*postResolver, error) {
+	db, err := writer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Необязательные поля, которых нет во входных данных,
+	// берутся из сохранённой публикации.
+	old, err := storage.Bind(res.api.dbFrom(ctx), storage.WithPrimary(ctx)).Post(int(args.ID))
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	p := args.Input.update(old)
+	err = graphqlInvalid(res.api.rulesFrom(ctx).ValidateUpdate(p))
+	if err != nil {
+		return nil, err
+	}
+	err = db.UpdatePost(p)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	p, err = res.api.dbFrom(ctx).Post(p.ID)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return &postResolver{res: res, p: p}, nil
+}
+
+func (res *graphqlResolver) DeletePost(ctx context.Context, args struct{ ID int32 }) (bool, error) {
+	db, err := writer(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = db.DeletePost(storage.Post{ID: int(args.ID)})
+	if err != nil {
+		return false, graphqlErr(err)
+	}
+	return true, nil
+}
+
+// postResolver - публикация в ответе GraphQL.
+type postResolver struct {
+	res *graphqlResolver
+	p   storage.Post
+}
+
+func (r *postResolver) ID() int32            { return int32(r.p.ID) }
+func (r *postResolver) Title() string        { return r.p.Title }
+func (r *postResolver) Content() string      { return r.p.Content }
+func (r *postResolver) CreatedAt() timestamp { return timestamp(r.p.CreatedAt) }
+
+func (r *postResolver) PublishedAt() *timestamp {
+	if r.p.PublishedAt == 0 {
+		return nil
+	}
+	t := timestamp(r.p.PublishedAt)
+	return &t
+}
+
+func (r *postResolver) Tags() []string {
+	return append([]string{}, r.p.Tags...)
+}
+
+func (r *postResolver) Author(ctx context.Context) (*authorResolver, error) {
+	a, err := stateFrom(ctx).authors.load(r.p.AuthorID)
+	if errors.Is(err, storage.ErrEntryNotExist) {
+		// Хранилища без списка авторов знают только имя из публикации.
+		a = storage.Author{ID: r.p.AuthorID, Name: r.p.AuthorName}
+	} else if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return &authorResolver{res: r.res, a: a}, nil
+}
+
+// tagResolver - метка в ответе GraphQL.
+type tagResolver struct {
+	t storage.Tag
+}
+
+func (r *tagResolver) Name() string { return r.t.Name }
+func (r *tagResolver) Posts() int32 { return int32(r.t.Posts) }
+
+// authorResolver - автор в ответе GraphQL.
+type authorResolver struct {
+	res *graphqlResolver
+	a   storage.Author
+}
+
+func (r *authorResolver) ID() int32    { return int32(r.a.ID) }
+func (r *authorResolver) Name() string { return r.a.Name }
+
+func (r *authorResolver) Posts(ctx context.Context, args struct{ Offset, Limit int32 }) ([]*postResolver, error) {
+	err := page(args.Offset, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.res.posts(ctx, storage.Filter{AuthorID: r.a.ID, Offset: int(args.Offset), Limit: int(args.Limit)})
+}
+
+// graphqlPeekBytes ограничивает размер тела запроса GraphQL,
+// которое читается для определения его типа.
+const graphqlPeekBytes = 1 << 20
+
+// graphqlWrite сообщает, содержит ли запрос POST /graphql мутации.
+// Тело запроса читается и возвращается в запрос для обработчика.
+// Если разобрать запрос не удалось, он считается изменяющим данные.
+func graphqlWrite(r *http.Request) bool {
+	buf, err := ioutil.ReadAll(io.LimitReader(r.Body, graphqlPeekBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || len(buf) > graphqlPeekBytes {
+		return true
+	}
+	var req graphqlRequest
+	err = json.Unmarshal(buf, &req)
+	if err != nil {
+		return true
+	}
+	return hasMutation(req.Query)
+}
+
+// hasMutation сообщает, объявлена ли в документе GraphQL мутация.
+// Документ не разбирается полностью: достаточно найти ключевое
+// слово mutation вне фигурных скобок, строк и комментариев.
+// Комментарий, как и в лексере GraphQL, заканчивается любым
+// символом конца строки.
+func hasMutation(doc string) bool {
+	depth := 0
+	for i := 0; i < len(doc); i++ {
+		c := doc[i]
+		switch {
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' && doc[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			if len(doc) >= i+3 && doc[i:i+3] == `"""` {
+				end := strings.Index(doc[i+3:], `"""`)
+				if end < 0 {
+					return false
+				}
+				i += 3 + end + 2
+				continue
+			}
+			for i++; i < len(doc) && doc[i] != '"' && doc[i] != '\n'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '$':
+			// Имя переменной может совпадать с ключевым словом.
+			for i+1 < len(doc) && isNameChar(doc[i+1]) {
+				i++
+			}
+		case depth == 0 && isNameChar(c):
+			j := i
+			for j < len(doc) && isNameChar(doc[j]) {
+				j++
+			}
+			if doc[i:j] == "mutation" {
+				return true
+			}
+			i = j - 1
+		}
+	}
+	return false
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+// countingDB counts author and post lookups.
+type countingDB struct {
+	storage.Interface
+
+	mu                      sync.Mutex
+	author, authors, filter int
+}
+
+func (db *countingDB) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	db.mu.Lock()
+	db.filter++
+	db.mu.Unlock()
+	return db.Interface.FilterPosts(f)
+}
+
+func (db *countingDB) Author(id int) (storage.Author, error) {
+	db.mu.Lock()
+	db.author++
+	db.mu.Unlock()
+	return db.Interface.Author(id)
+}
+
+func (db *countingDB) Authors() ([]storage.Author, error) {
+	db.mu.Lock()
+	db.authors++
+	db.mu.Unlock()
+	return db.Interface.Authors()
+}
+
+func graphqlDB(t *testing.T) *memdb.Store {
+	t.Helper()
+	db := memdb.New()
+	for _, name := range []string{"Mark", "Tom", "Travis"} {
+		err := db.AddAuthor(storage.Author{Name: name})
+		if err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+	for _, tp := range storage.TestPosts {
+		err := db.AddPost(tp)
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+	return db
+}
+
+type graphqlResult struct {
+	Data   map[string]json.RawMessage
+	Errors []struct {
+		Message    string
+		Extensions map[string]interface{}
+	}
+}
+
+func postGraphQL(t *testing.T, api *API, query string, header ...string) (*httptest.ResponseRecorder, graphqlResult) {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query})
+	req := httptest.NewRequest(http.MethodPost, graphqlPath, strings.NewReader(string(body)))
+	if len(header) == 2 {
+		req.Header.Set(header[0], header[1])
+	}
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+
+	var res graphqlResult
+	if rr.Code == http.StatusOK {
+		err := json.Unmarshal(rr.Body.Bytes(), &res)
+		if err != nil {
+			t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+		}
+	}
+	return rr, res
+}
+
+func TestAPI_graphqlQuery(t *testing.T) {
+	db := &countingDB{Interface: graphqlDB(t)}
+	api := New(db)
+
+	_, res := postGraphQL(t, api, `{
+		posts(publishedUntil: 1643896200, limit: 10) { id title publishedAt author { id name } }
+	}`)
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors: %+v", res.Errors)
+	}
+	var posts []struct {
+		ID          int
+		Title       string
+		PublishedAt int64
+		Author      struct {
+			ID   int
+			Name string
+		}
+	}
+	json.Unmarshal(res.Data["posts"], &posts)
+	if len(posts) != 3 || posts[0].ID != 3 || posts[0].PublishedAt != 1643896200 || posts[0].Author.Name != "Mark" || posts[1].Author.Name != "Tom" {
+		t.Errorf("unexpected posts %+v", posts)
+	}
+	// Authors of all posts are loaded with a single call.
+	if db.authors != 1 || db.author != 0 {
+		t.Errorf("expected 1 Authors and 0 Author calls, got %d and %d", db.authors, db.author)
+	}
+
+	_, res = postGraphQL(t, api, `{ post(id: 42) { id } author(id: 2) { name posts(limit: 1) { title } } }`)
+	if string(res.Data["post"]) != "null" || !strings.Contains(string(res.Data["author"]), `"Post 5"`) {
+		t.Errorf("unexpected data %s %s, errors %+v", res.Data["post"], res.Data["author"], res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `{ posts(limit: 1000) { id } }`)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "INVALID" {
+		t.Errorf("expected an INVALID error, got %+v", res.Errors)
+	}
+}
+
+func TestAPI_graphqlMutation(t *testing.T) {
+	api := New(graphqlDB(t))
+
+	_, res := postGraphQL(t, api, `mutation { createPost(input: {title: "New", content: "Text", authorID: 1}) }`)
+	if string(res.Data["createPost"]) != "true" {
+		t.Errorf("expected post to be created, got %s, errors %+v", res.Data["createPost"], res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "Updated", content: "Text", authorID: 2}) { title } }`)
+	if !strings.Contains(string(res.Data["updatePost"]), `"Updated"`) {
+		t.Errorf("expected updated post, got %s, errors %+v", res.Data["updatePost"], res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "", content: "Text", authorID: 2}) { title } }`)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "INVALID" {
+		t.Errorf("expected an INVALID error, got %+v", res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `mutation { deletePost(id: 42) }`)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("expected a NOT_FOUND error, got %+v", res.Errors)
+	}
+
+	q := url.Values{"query": {`mutation { deletePost(id: 1) }`}}
+	req := httptest.NewRequest(http.MethodGet, graphqlPath+"?"+q.Encode(), nil)
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d for GET mutation, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
+
+func TestAPI_graphqlPartialUpdate(t *testing.T) {
+	api := New(graphqlDB(t))
+	_, res := postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "Tagged", content: "Text", tags: ["news"]}) { id } }`)
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+	before, _ := api.db.Post(2)
+
+	// Fields left out keep their stored values.
+	_, res = postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "Renamed", content: "Text"}) { title publishedAt tags } }`)
+	want := fmt.Sprintf(`{"title":"Renamed","publishedAt":%d,"tags":["news"]}`, before.PublishedAt)
+	if string(res.Data["updatePost"]) != want {
+		t.Errorf("expected %s, got %s, errors %+v", want, res.Data["updatePost"], res.Errors)
+	}
+	after, _ := api.db.Post(2)
+	if after.CreatedAt != before.CreatedAt || after.AuthorID != before.AuthorID || after.PublishedAt == 0 {
+		t.Errorf("expected stored fields to stay, got %+v, was %+v", after, before)
+	}
+
+	// A zero publishedAt turns the post back into a draft.
+	_, res = postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "Renamed", content: "Text", publishedAt: 0}) { publishedAt } }`)
+	if string(res.Data["updatePost"]) != `{"publishedAt":null}` {
+		t.Errorf("expected a draft, got %s, errors %+v", res.Data["updatePost"], res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `mutation { updatePost(id: 42, input: {title: "T", content: "C"}) { id } }`)
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("expected NOT_FOUND for a missing post, got %+v", res.Errors)
+	}
+}
+
+func TestAPI_graphqlTags(t *testing.T) {
+	api := New(graphqlDB(t))
+
+	_, res := postGraphQL(t, api, `mutation { updatePost(id: 2, input: {title: "Tagged", content: "Text", authorID: 2, tags: ["Sport", "news"]}) { tags } }`)
+	if string(res.Data["updatePost"]) != `{"tags":["news","sport"]}` {
+		t.Errorf("expected normalized tags, got %s, errors %+v", res.Data["updatePost"], res.Errors)
+	}
+
+	_, res = postGraphQL(t, api, `{ posts(tags: ["sport"]) { id tags } tags { name posts } }`)
+	if string(res.Data["posts"]) != `[{"id":2,"tags":["news","sport"]}]` {
+		t.Errorf("expected the tagged post, got %s, errors %+v", res.Data["posts"], res.Errors)
+	}
+	if string(res.Data["tags"]) != `[{"name":"news","posts":1},{"name":"sport","posts":1}]` {
+		t.Errorf("unexpected tags %s", res.Data["tags"])
+	}
+
+	_, res = postGraphQL(t, api, `{ post(id: 1) { tags } }`)
+	if string(res.Data["post"]) != `{"tags":[]}` {
+		t.Errorf("expected no tags, got %s, errors %+v", res.Data["post"], res.Errors)
+	}
+}
+
+func TestAPI_graphqlCost(t *testing.T) {
+	mem := graphqlDB(t)
+	for i := 0; i < graphqlMaxLimit; i++ {
+		err := mem.AddPost(storage.Post{AuthorID: 1, Title: "Post", Content: "Text", PublishedAt: 1})
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+	db := &countingDB{Interface: mem}
+	api := New(db)
+
+	// 100 posts of one author request 100 more posts each.
+	_, res := postGraphQL(t, api, `{ posts(limit: 100) { author { posts(limit: 100) { author { posts(limit: 100) { id } } } } } }`)
+	if len(res.Errors) == 0 || res.Errors[0].Extensions["code"] != "TOO_EXPENSIVE" {
+		t.Errorf("expected a TOO_EXPENSIVE error, got %+v", res.Errors)
+	}
+	if max := graphqlMaxCost / graphqlMaxLimit; db.filter > max {
+		t.Errorf("expected at most %d post lookups, got %d", max, db.filter)
+	}
+
+	// Budgets are per request.
+	_, res = postGraphQL(t, api, `{ posts(limit: 100) { id } }`)
+	if len(res.Errors) > 0 {
+		t.Errorf("unexpected errors: %+v", res.Errors)
+	}
+}
+
+func TestAPI_graphqlAuth(t *testing.T) {
+	api := New(graphqlDB(t), WithAuth(NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "key-tom", AuthorID: 2})))
+
+	if rr, res := postGraphQL(t, api, `{ posts { id } }`); rr.Code != http.StatusOK || len(res.Errors) > 0 {
+		t.Errorf("expected anonymous query to succeed, got status %d, errors %+v", rr.Code, res.Errors)
+	}
+	create := `mutation { createPost(input: {title: "New", content: "Text"}) }`
+	if rr, _ := postGraphQL(t, api, create); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for anonymous mutation, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if _, res := postGraphQL(t, api, create, "X-API-Key", "key-tom"); string(res.Data["createPost"]) != "true" {
+		t.Errorf("expected post to be created, got errors %+v", res.Errors)
+	}
+	_, res := postGraphQL(t, api, `mutation { deletePost(id: 1) }`, "X-API-Key", "key-tom")
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "FORBIDDEN" {
+		t.Errorf("expected a FORBIDDEN error, got %+v", res.Errors)
+	}
+
+	// Line terminators end comments just as in the GraphQL lexer.
+	for _, prefix := range []string{"#c\r", "#c\r\n", "\ufeff", "\ufeff#c\r"} {
+		q := prefix + `mutation { createPost(input: {title: "pwn", content: "y", authorID: 1}) }`
+		if rr, _ := postGraphQL(t, api, q); rr.Code != http.StatusUnauthorized {
+			t.Errorf("%q: expected status %d for anonymous mutation, got %d", q, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	posts, err := api.db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range posts {
+		if p.Title == "pwn" {
+			t.Errorf("expected anonymous mutations to be rejected, got post %+v", p)
+		}
+	}
+
+	// Mutations that slip past the middleware are rejected by the resolvers.
+	body, _ := json.Marshal(graphqlRequest{Query: create})
+	req := httptest.NewRequest(http.MethodPost, graphqlPath, strings.NewReader(string(body)))
+	rr := httptest.NewRecorder()
+	api.graphqlHandler(rr, req)
+	var direct graphqlResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &direct); err != nil {
+		t.Fatalf("invalid response %q: %v", rr.Body.String(), err)
+	}
+	if len(direct.Errors) != 1 || direct.Errors[0].Extensions["code"] != "UNAUTHENTICATED" {
+		t.Errorf("expected an UNAUTHENTICATED error, got %+v", direct.Errors)
+	}
+}
+
+func Test_hasMutation(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want bool
+	}{
+		{`{ posts { id } }`, false},
+		{`query Q($mutation: Int) { post(id: $mutation) { title } }`, false},
+		{`{ posts { mutation: title } }`, false},
+		{`# mutation
+		query { posts { id } }`, false},
+		{`query { post(id: 1) { title } } mutation M { deletePost(id: 1) }`, true},
+		{`"mutation" mutation { deletePost(id: 1) }`, true},
+		{`  mutation{deletePost(id: 1)}`, true},
+		{"#c\rmutation { deletePost(id: 1) }", true},
+		{"#c\r\nmutation { deletePost(id: 1) }", true},
+		{"\ufeffmutation { deletePost(id: 1) }", true},
+		{"\ufeff# mutation\r{ posts { id } }", false},
+	}
+	for _, tt := range tests {
+		if got := hasMutation(tt.doc); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.doc, tt.want, got)
+		}
+	}
+}
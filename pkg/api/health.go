@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+)
+
+// HealthChecker сообщает о состоянии компонента сервера.
+// Health возвращает сведения для ответа /health и признак
+// работоспособности компонента.
+type HealthChecker interface {
+	Health() (interface{}, bool)
+}
+
+type healthCheck struct {
+	name    string
+	checker HealthChecker
+}
+
+// WithHealth добавляет проверку компонента name в ответ /health.
+// Если компонент неработоспособен, /health отвечает кодом 503.
+func WithHealth(name string, c HealthChecker) Option {
+	return func(api *API) {
+		api.health = append(api.health, healthCheck{name: name, checker: c})
+	}
+}
+
+// Проверка работоспособности сервера.
+type healthResponse struct {
+	Status string                 `json:"status"` // "ok" или "unavailable"
+	Checks map[string]healthEntry `json:"checks,omitempty"`
+}
+
+type healthEntry struct {
+	Healthy bool        `json:"healthy"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Состояние сервера и его компонентов.
+func (api *API) healthHandler(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "ok"}
+	status := http.StatusOK
+	for _, c := range api.health {
+		details, ok := c.checker.Health()
+		if resp.Checks == nil {
+			resp.Checks = make(map[string]healthEntry)
+		}
+		resp.Checks[c.name] = healthEntry{Healthy: ok, Details: details}
+		if !ok {
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+type fakeHealth struct {
+	ok bool
+}
+
+func (h *fakeHealth) Health() (interface{}, bool) {
+	return map[string]string{"state": "test"}, h.ok
+}
+
+// downDB fails every read as an unreachable database.
+type downDB struct {
+	*memdb.Store
+}
+
+func (downDB) Posts() ([]storage.Post, error) {
+	return nil, storage.ErrDBNotResponding
+}
+
+func (downDB) Post(int) (storage.Post, error) {
+	return storage.Post{}, storage.ErrConnectDB
+}
+
+func TestAPI_health(t *testing.T) {
+	get := func(api *API, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Without checks the server is healthy.
+	rr := get(New(memdb.New()), "/health")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	h := &fakeHealth{ok: true}
+	api := New(memdb.New(), WithHealth("storage", h))
+	var resp healthResponse
+	rr = get(api, "/health")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || resp.Status != "ok" || !resp.Checks["storage"].Healthy {
+		t.Errorf("expected a healthy storage, got %d %s", rr.Code, rr.Body)
+	}
+
+	h.ok = false
+	rr = get(api, "/health")
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusServiceUnavailable || resp.Status != "unavailable" || resp.Checks["storage"].Healthy {
+		t.Errorf("expected an unavailable storage, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+func TestAPI_unavailable(t *testing.T) {
+	api := New(downDB{memdb.New()})
+	for _, target := range []string{"/posts", "/posts/1"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusServiceUnavailable, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,570 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/webhook"
+)
+
+// Описание API в формате OpenAPI 3. Схемы моделей строятся по типам
+// пакета storage, поэтому изменения моделей попадают в описание
+// автоматически, а соответствие маршрутов проверяется тестом.
+
+type openAPI struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       openAPIInfo         `json:"info"`
+	Paths      map[string]pathItem `json:"paths"`
+	Components components          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// pathItem сопоставляет методу (в нижнем регистре) операцию.
+type pathItem map[string]*operation
+
+type operation struct {
+	Summary     string                `json:"summary"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema schema `json:"schema"`
+}
+
+type components struct {
+	Schemas         map[string]schema `json:"schemas"`
+	SecuritySchemes map[string]schema `json:"securitySchemes,omitempty"`
+}
+
+type schema map[string]interface{}
+
+func ref(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(s schema) schema {
+	return schema{"type": "array", "items": s}
+}
+
+// schemaOf строит схему JSON-представления типа.
+func schemaOf(t reflect.Type) schema {
+	switch t.Kind() {
+	case reflect.Struct:
+		props := make(map[string]schema)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if n := strings.Split(tag, ",")[0]; n != "" {
+					name = n
+				}
+			}
+			props[name] = schemaOf(f.Type)
+		}
+		return schema{"type": "object", "properties": props}
+	case reflect.Slice:
+		return arrayOf(schemaOf(t.Elem()))
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int64:
+		return schema{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int32:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	default:
+		return schema{}
+	}
+}
+
+// Типовые ответы.
+var (
+	textError = map[string]mediaType{"text/plain": {Schema: schema{"type": "string"}}}
+
+	respOK           = response{Description: "Success"}
+	respBadRequest   = response{Description: "Malformed request", Content: textError}
+	respUnauthorized = response{Description: "Missing or invalid credentials", Content: textError}
+	respForbidden    = response{Description: "Operation not permitted for the caller's role", Content: textError}
+	respNotFound     = response{Description: "Entry does not exist", Content: textError}
+	respConflict     = response{Description: "Entry already exists or is in use", Content: textError}
+	respTooLarge     = response{Description: "Request body too large", Content: textError}
+	respInvalid      = response{Description: "Validation failed", Content: jsonContent(ref("ValidationErrors"))}
+	respTooMany      = response{Description: "Rate limit exceeded", Content: textError}
+	respServerError  = response{Description: "Internal error", Content: textError}
+	respUnavailable  = response{Description: "Database is unavailable", Content: textError}
+)
+
+func jsonContent(s schema) map[string]mediaType {
+	return map[string]mediaType{"application/json": {Schema: s}}
+}
+
+// openAPISpec строит описание API с учётом включённых возможностей.
+func (api *API) openAPISpec() openAPI {
+	spec := openAPI{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "GoNews API", Version: "1.0.0"},
+		Paths:   make(map[string]pathItem),
+		Components: components{
+			Schemas: map[string]schema{
+				"Post":             schemaOf(reflect.TypeOf(storage.Post{})),
+				"Author":           schemaOf(reflect.TypeOf(storage.Author{})),
+				"Tag":              schemaOf(reflect.TypeOf(storage.Tag{})),
+				"Comment":          schemaOf(reflect.TypeOf(storage.Comment{})),
+				"FieldError":       schemaOf(reflect.TypeOf(FieldError{})),
+				"ValidationErrors": schemaOf(reflect.TypeOf(validationErrors{})),
+			},
+		},
+	}
+
+	// Ответы с публикациями доступны во всех зарегистрированных форматах.
+	posts := make(map[string]mediaType)
+	post := make(map[string]mediaType)
+	for _, mt := range api.encoders.mediaTypes() {
+		posts[mt] = mediaType{Schema: arrayOf(ref("Post"))}
+		post[mt] = mediaType{Schema: ref("Post")}
+	}
+
+	var security []map[string][]string
+	if api.auth != nil {
+		spec.Components.SecuritySchemes = map[string]schema{
+			"apiKey":     {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			"bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+		}
+		security = []map[string][]string{{"apiKey": {}}, {"bearerAuth": {}}}
+		spec.Components.Schemas["Token"] = schemaOf(reflect.TypeOf(tokenResponse{}))
+		spec.Paths["/token"] = pathItem{
+			"post": {
+				Summary:  "Issue a signed bearer token for an API key",
+				Security: []map[string][]string{{"apiKey": {}}},
+				Responses: map[string]response{
+					"200": {Description: "Token issued", Content: jsonContent(ref("Token"))},
+					"401": respUnauthorized,
+				},
+			},
+		}
+	}
+
+	// write описывает операцию, изменяющую данные.
+	write := func(summary, model string, extra map[string]response) *operation {
+		op := &operation{
+			Summary:     summary,
+			RequestBody: &requestBody{Required: true, Content: jsonContent(ref(model))},
+			Responses: map[string]response{
+				"200": respOK,
+				"400": respBadRequest,
+				"413": respTooLarge,
+				"422": respInvalid,
+				"500": respServerError,
+			},
+			Security: security,
+		}
+		if api.auth != nil {
+			op.Responses["401"] = respUnauthorized
+			op.Responses["403"] = respForbidden
+		}
+		for code, resp := range extra {
+			op.Responses[code] = resp
+		}
+		return op
+	}
+	notFound := map[string]response{"404": respNotFound}
+	conflict := map[string]response{"409": respConflict}
+
+	spec.Paths["/posts"] = pathItem{
+		"get": {
+			Summary: "List all posts",
+			Parameters: []parameter{
+				{Name: "tag", In: "query", Description: "Only posts with this tag; may be repeated to require several tags", Schema: schema{"type": "string"}},
+			},
+			Responses: map[string]response{
+				"200": {Description: "Posts ordered by ID, or newest first when filtered by tags", Content: posts},
+				"304": {Description: "Not modified"},
+				"406": {Description: "None of the accepted media types is supported", Content: textError},
+				"500": respServerError,
+			},
+		},
+		"post":   write("Create a post", "Post", conflict),
+		"put":    write("Update a post", "Post", notFound),
+		"delete": write("Delete a post by ID", "Post", notFound),
+	}
+	spec.Paths["/posts/{id}"] = pathItem{
+		"get": {
+			Summary: "Get a post by ID",
+			Parameters: []parameter{
+				{Name: "id", In: "path", Required: true, Schema: schema{"type": "integer"}},
+			},
+			Responses: map[string]response{
+				"200": {Description: "The post", Content: post},
+				"304": {Description: "Not modified"},
+				"404": respNotFound,
+				"406": {Description: "None of the accepted media types is supported", Content: textError},
+				"500": respServerError,
+			},
+		},
+	}
+	postParams := []parameter{
+		{Name: "id", In: "path", Required: true, Schema: schema{"type": "integer"}},
+	}
+	// commentWrite описывает изменение комментария публикации.
+	commentWrite := func(summary string, extra map[string]response) *operation {
+		op := write(summary, "Comment", extra)
+		op.Parameters = postParams
+		return op
+	}
+	spec.Paths["/posts/{id}/comments"] = pathItem{
+		"get": {
+			Summary:    "List the comments of a post",
+			Parameters: postParams,
+			Responses: map[string]response{
+				"200": {Description: "Comments in the order they were added; replies refer to their comment by ParentID", Content: jsonContent(arrayOf(ref("Comment")))},
+				"404": respNotFound,
+				"500": respServerError,
+			},
+		},
+		"post":   commentWrite("Comment on a post or reply to a comment", notFound),
+		"put":    commentWrite("Edit the text of a comment", notFound),
+		"delete": commentWrite("Delete a comment with the replies to it", notFound),
+	}
+	if api.bus != nil {
+		spec.Components.Schemas["Event"] = schemaOf(reflect.TypeOf(storage.Event{}))
+		resume := []parameter{
+			{Name: "Last-Event-ID", In: "header", Description: "ID of the last received event", Schema: schema{"type": "string"}},
+			{Name: "lastEventId", In: "query", Description: "Same as Last-Event-ID", Schema: schema{"type": "string"}},
+		}
+		spec.Paths["/posts/stream"] = pathItem{
+			"get": {
+				Summary:    "Server-Sent Events about created, updated, published and deleted posts",
+				Parameters: resume,
+				Responses: map[string]response{
+					"200": {Description: "Event stream; data holds the post", Content: map[string]mediaType{"text/event-stream": {Schema: schema{"type": "string"}}}},
+					"400": respBadRequest,
+				},
+			},
+		}
+		spec.Paths["/posts/ws"] = pathItem{
+			"get": {
+				Summary:    "WebSocket stream of post events, one JSON message per event",
+				Parameters: resume,
+				Responses: map[string]response{
+					"101": {Description: "Switching to WebSocket; messages are Event objects", Content: jsonContent(ref("Event"))},
+					"400": respBadRequest,
+					"403": {Description: "Origin not allowed", Content: textError},
+				},
+			},
+		}
+	}
+	spec.Paths["/authors"] = pathItem{
+		"get": {
+			Summary: "List all authors",
+			Responses: map[string]response{
+				"200": {Description: "Authors ordered by ID", Content: jsonContent(arrayOf(ref("Author")))},
+				"500": respServerError,
+			},
+		},
+		"post":   write("Create an author", "Author", conflict),
+		"delete": write("Delete an author by ID", "Author", map[string]response{"404": respNotFound, "409": respConflict}),
+	}
+
+	spec.Paths["/tags"] = pathItem{
+		"get": {
+			Summary: "List all tags with their numbers of posts",
+			Responses: map[string]response{
+				"200": {Description: "Tags ordered by name", Content: jsonContent(arrayOf(ref("Tag")))},
+				"500": respServerError,
+			},
+		},
+		"post":   write("Create a tag without posts", "Tag", conflict),
+		"delete": write("Delete a tag that has no posts", "Tag", map[string]response{"404": respNotFound, "409": respConflict}),
+	}
+	spec.Paths["/tags/cloud"] = pathItem{
+		"get": {
+			Summary: "Tag cloud: tags with posts, most used first",
+			Parameters: []parameter{
+				{Name: "limit", In: "query", Description: "Number of tags", Schema: schema{"type": "integer", "minimum": 1}},
+			},
+			Responses: map[string]response{
+				"200": {Description: "Tags ordered by number of posts, then by name", Content: jsonContent(arrayOf(ref("Tag")))},
+				"400": respBadRequest,
+				"500": respServerError,
+			},
+		},
+	}
+
+	feedParams := []parameter{
+		{Name: "author", In: "query", Description: "Only posts of this author", Schema: schema{"type": "integer"}},
+		{Name: "tag", In: "query", Description: "Only posts with this tag; may be repeated to require several tags", Schema: schema{"type": "string"}},
+		{Name: "limit", In: "query", Description: "Number of posts in the feed", Schema: schema{"type": "integer", "maximum": api.feed.MaxSize}},
+	}
+	feed := func(summary, mt string) pathItem {
+		return pathItem{
+			"get": {
+				Summary:    summary,
+				Parameters: feedParams,
+				Responses: map[string]response{
+					"200": {Description: "The feed", Content: map[string]mediaType{mt: {Schema: schema{"type": "string"}}}},
+					"304": {Description: "Not modified"},
+					"400": respBadRequest,
+					"404": respNotFound,
+					"500": respServerError,
+				},
+			},
+		}
+	}
+	spec.Paths["/feed.rss"] = feed("RSS 2.0 feed of the latest published posts", "application/rss+xml")
+	spec.Paths["/feed.atom"] = feed("Atom feed of the latest published posts", "application/atom+xml")
+
+	spec.Components.Schemas["GraphQLRequest"] = schemaOf(reflect.TypeOf(graphqlRequest{}))
+	graphqlResult := response{Description: "GraphQL result with data and errors", Content: jsonContent(schema{"type": "object"})}
+	graphqlPost := &operation{
+		Summary:     "Run a GraphQL query or mutation; mutations require credentials when authentication is enabled",
+		RequestBody: &requestBody{Required: true, Content: jsonContent(ref("GraphQLRequest"))},
+		Responses: map[string]response{
+			"200": graphqlResult,
+			"400": respBadRequest,
+			"413": respTooLarge,
+		},
+		Security: security,
+	}
+	if api.auth != nil {
+		graphqlPost.Responses["401"] = respUnauthorized
+	}
+	spec.Paths[graphqlPath] = pathItem{
+		"get": {
+			Summary: "Run a GraphQL query; mutations must use POST",
+			Parameters: []parameter{
+				{Name: "query", In: "query", Required: true, Schema: schema{"type": "string"}},
+				{Name: "operationName", In: "query", Schema: schema{"type": "string"}},
+				{Name: "variables", In: "query", Description: "JSON object", Schema: schema{"type": "string"}},
+			},
+			Responses: map[string]response{
+				"200": graphqlResult,
+				"400": respBadRequest,
+				"405": {Description: "Mutations are not allowed with GET", Content: textError},
+			},
+		},
+		"post": graphqlPost,
+	}
+
+	if api.webhooks != nil && api.auth != nil {
+		spec.Components.Schemas["Subscription"] = schemaOf(reflect.TypeOf(webhook.Subscription{}))
+		spec.Components.Schemas["Delivery"] = schemaOf(reflect.TypeOf(webhook.Delivery{}))
+		spec.Components.Schemas["DeadLetter"] = schemaOf(reflect.TypeOf(webhook.DeadLetter{}))
+		// admin описывает операцию, доступную только администраторам.
+		admin := func(summary string, responses map[string]response) *operation {
+			op := &operation{Summary: summary, Responses: responses, Security: security}
+			op.Responses["401"] = respUnauthorized
+			op.Responses["403"] = respForbidden
+			return op
+		}
+		idParam := []parameter{
+			{Name: "id", In: "path", Required: true, Schema: schema{"type": "integer"}},
+		}
+		create := admin("Subscribe a URL to post events; the response holds the signing secret", map[string]response{
+			"201": {Description: "Subscription created", Content: jsonContent(ref("Subscription"))},
+			"400": respBadRequest,
+			"413": respTooLarge,
+			"422": respInvalid,
+			"500": respServerError,
+		})
+		create.RequestBody = &requestBody{Required: true, Content: jsonContent(ref("Subscription"))}
+		spec.Paths["/webhooks"] = pathItem{
+			"get": admin("List webhook subscriptions without secrets", map[string]response{
+				"200": {Description: "Subscriptions ordered by ID", Content: jsonContent(arrayOf(ref("Subscription")))},
+			}),
+			"post": create,
+		}
+		del := admin("Delete a webhook subscription", map[string]response{
+			"200": respOK,
+			"404": respNotFound,
+			"500": respServerError,
+		})
+		del.Parameters = idParam
+		spec.Paths["/webhooks/{id}"] = pathItem{"delete": del}
+		deliveries := admin("Recent delivery attempts of a subscription", map[string]response{
+			"200": {Description: "Attempts from oldest to newest", Content: jsonContent(arrayOf(ref("Delivery")))},
+			"404": respNotFound,
+		})
+		deliveries.Parameters = idParam
+		spec.Paths["/webhooks/{id}/deliveries"] = pathItem{"get": deliveries}
+		spec.Paths["/webhooks/dead-letters"] = pathItem{
+			"get": admin("Events that could not be delivered", map[string]response{
+				"200": {Description: "Dead letters from oldest to newest", Content: jsonContent(arrayOf(ref("DeadLetter")))},
+			}),
+		}
+		retry := admin("Deliver a dead letter again", map[string]response{
+			"202": {Description: "Delivery restarted"},
+			"404": respNotFound,
+		})
+		retry.Parameters = idParam
+		spec.Paths["/webhooks/dead-letters/{id}/retry"] = pathItem{"post": retry}
+	}
+
+	if api.tenancy != nil {
+		// Операции с данными относятся к арендатору запроса.
+		var tenantParams []parameter
+		if api.tenancy.Header != "" {
+			tenantParams = append(tenantParams, parameter{Name: api.tenancy.Header, In: "header", Description: "Tenant ID", Schema: schema{"type": "string"}})
+		}
+		for path, item := range spec.Paths {
+			if tenantFreePath(path) {
+				continue
+			}
+			for _, op := range item {
+				op.Parameters = append(op.Parameters, tenantParams...)
+				op.Responses["400"] = respBadRequest
+				op.Responses["404"] = respNotFound
+				if api.auth != nil {
+					op.Responses["403"] = respForbidden
+				}
+			}
+		}
+
+	}
+	if api.tenancy != nil && api.auth != nil {
+		spec.Components.Schemas["Tenant"] = schemaOf(reflect.TypeOf(Tenant{}))
+		// operator описывает операцию, доступную только администраторам,
+		// ключи которых не выданы арендаторам.
+		operator := func(summary string, responses map[string]response) *operation {
+			op := &operation{Summary: summary, Responses: responses, Security: security}
+			op.Responses["401"] = respUnauthorized
+			op.Responses["403"] = respForbidden
+			return op
+		}
+		create := operator("Create a tenant with empty storage", map[string]response{
+			"201": {Description: "Tenant created", Content: jsonContent(ref("Tenant"))},
+			"400": respBadRequest,
+			"409": respConflict,
+			"413": respTooLarge,
+			"422": respInvalid,
+			"500": respServerError,
+		})
+		create.RequestBody = &requestBody{Required: true, Content: jsonContent(ref("Tenant"))}
+		spec.Paths["/tenants"] = pathItem{
+			"get": operator("List tenants", map[string]response{
+				"200": {Description: "Tenants ordered by ID", Content: jsonContent(arrayOf(ref("Tenant")))},
+				"500": respServerError,
+			}),
+			"post": create,
+		}
+		del := operator("Delete a tenant with all its data", map[string]response{
+			"200": respOK,
+			"404": respNotFound,
+			"500": respServerError,
+		})
+		del.Parameters = []parameter{
+			{Name: "id", In: "path", Required: true, Schema: schema{"type": "string"}},
+		}
+		spec.Paths["/tenants/{id}"] = pathItem{"delete": del}
+	}
+
+	spec.Paths["/openapi.json"] = pathItem{
+		"get": {
+			Summary: "This document",
+			Responses: map[string]response{
+				"200": {Description: "OpenAPI 3 document", Content: jsonContent(schema{"type": "object"})},
+			},
+		},
+	}
+
+	// Операции, обращающиеся к хранилищу, отвечают кодом 503,
+	// пока БД недоступна. Подписки хранятся отдельно от БД.
+	for path, item := range spec.Paths {
+		if strings.HasPrefix(path, "/webhooks") {
+			continue
+		}
+		for _, op := range item {
+			if _, ok := op.Responses["500"]; ok {
+				op.Responses["503"] = respUnavailable
+			}
+		}
+	}
+
+	spec.Components.Schemas["Health"] = schema{
+		"type": "object",
+		"properties": map[string]schema{
+			"status": {"type": "string", "enum": []string{"ok", "unavailable"}},
+			"checks": {
+				"type": "object",
+				"additionalProperties": schema{
+					"type": "object",
+					"properties": map[string]schema{
+						"healthy": {"type": "boolean"},
+						"details": {"type": "object"},
+					},
+				},
+			},
+		},
+	}
+	spec.Paths["/health"] = pathItem{
+		"get": {
+			Summary: "Server health and the state of its components",
+			Responses: map[string]response{
+				"200": {Description: "All components are healthy", Content: jsonContent(ref("Health"))},
+				"503": {Description: "A component is unavailable", Content: jsonContent(ref("Health"))},
+			},
+		},
+	}
+
+	// Ограничение частоты касается всех операций.
+	if api.limiter != nil {
+		for _, item := range spec.Paths {
+			for _, op := range item {
+				op.Responses["429"] = respTooMany
+			}
+		}
+	}
+
+	return spec
+}
+
+// Получение описания API.
+func (api *API) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.openapi)
+}
+
+// buildOpenAPI кодирует описание API один раз при создании API.
+func (api *API) buildOpenAPI() {
+	bytes, err := json.MarshalIndent(api.openAPISpec(), "", "  ")
+	if err != nil {
+		// Описание состоит только из сериализуемых типов.
+		panic(err)
+	}
+	api.openapi = bytes
+}
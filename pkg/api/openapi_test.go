@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+// routeParam matches mux path variables with an optional pattern, {id:[0-9]+}.
+var routeParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// routes returns "METHOD /path" for every route of the router except
+// the generated OPTIONS handlers, with path variables in OpenAPI form.
+func routes(t *testing.T, r *mux.Router) []string {
+	t.Helper()
+	var list []string
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s has no methods", path)
+			return nil
+		}
+		path = routeParam.ReplaceAllString(path, "{$1}")
+		for _, m := range methods {
+			if m != http.MethodOptions {
+				list = append(list, m+" "+path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error walking routes: %v", err)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestAPI_openAPI(t *testing.T) {
+	configs := map[string][]Option{
+		"default": nil,
+		"full": {
+			WithAuth(NewAuth([]byte("secret"), time.Hour)),
+			WithRateLimits(RateLimits{Read: Limit{Rate: 1, Burst: 1}, Write: Limit{Rate: 1, Burst: 1}}),
+			WithCORS(DefaultCORS("*")),
+			WithBus(storage.NewBus(10)),
+			WithWebhooks(newDispatcher(t)),
+		},
+		"tenants": {
+			WithAuth(NewAuth([]byte("secret"), time.Hour)),
+			WithTenants(Tenancy{Tenants: newTenants(t), Header: DefaultTenantHeader}),
+		},
+	}
+	for name, opts := range configs {
+		api := New(memdb.New(), opts...)
+
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d", name, http.StatusOK, rr.Code)
+		}
+		var spec openAPI
+		err := json.Unmarshal(rr.Body.Bytes(), &spec)
+		if err != nil {
+			t.Fatalf("%s: invalid document: %v", name, err)
+		}
+
+		var documented []string
+		for path, item := range spec.Paths {
+			for method := range item {
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+		sort.Strings(documented)
+
+		registered := routes(t, api.Router())
+		if strings.Join(registered, "\n") != strings.Join(documented, "\n") {
+			t.Errorf("%s: routes and specification differ.\nRegistered:\n%s\nDocumented:\n%s",
+				name, strings.Join(registered, "\n"), strings.Join(documented, "\n"))
+		}
+
+		// Every schema reference must resolve.
+		for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(rr.Body.String(), -1) {
+			if _, ok := spec.Components.Schemas[m[1]]; !ok {
+				t.Errorf("%s: unresolved schema reference %s", name, m[1])
+			}
+		}
+	}
+
+	post := schemaOf(reflect.TypeOf(storage.Post{}))["properties"].(map[string]schema)
+	for _, field := range []string{"ID", "Title", "Content", "AuthorID", "AuthorName", "CreatedAt", "PublishedAt"} {
+		if _, ok := post[field]; !ok {
+			t.Errorf("Post schema lacks field %s", field)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"GoNews/pkg/storage"
+)
+
+// Роли клиентов API.
+const (
+	RoleAuthor = "author" // создаёт и редактирует свои публикации
+	RoleEditor = "editor" // редактирует и публикует любые публикации, управляет метками, удаляет комментарии
+	RoleAdmin  = "admin"  // удаляет публикации и управляет авторами
+)
+
+// roleRank упорядочивает роли: каждая следующая
+// обладает всеми правами предыдущей.
+var roleRank = map[string]int{
+	RoleAuthor: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+func validRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// ForbiddenError - отказ в доступе с указанием причины.
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return "forbidden: " + e.Reason
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return &ForbiddenError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// policy проверяет права клиента перед изменением данных
+// и передаёт разрешённые операции хранилищу.
+type policy struct {
+	storage.Interface
+	id  Identity
+	ctx context.Context
+}
+
+// Restrict возвращает хранилище, которое разрешает клиенту
+// только операции, допустимые для его роли.
+func Restrict(db storage.Interface, id Identity) storage.Interface {
+	return policy{Interface: db, id: id, ctx: context.Background()}
+}
+
+// primary возвращает хранилище для чтения данных, по которым
+// проверяются права: реплика или кэш могут вернуть устаревшую
+// запись, например прежнего автора публикации.
+func (p policy) primary() storage.Interface {
+	return storage.Bind(p.Interface, storage.WithPrimary(p.ctx))
+}
+
+// at проверяет, что роль клиента не ниже заданной.
+func (p policy) at(role string) bool {
+	return roleRank[p.id.Role] >= roleRank[role]
+}
+
+// member проверяет, что клиенту назначена известная роль.
+// Клиент без роли не может изменять данные, даже если
+// остальные проверки ему бы это разрешили.
+func (p policy) member() error {
+	if roleRank[p.id.Role] == 0 {
+		return forbidden("unknown role %q", p.id.Role)
+	}
+	return nil
+}
+
+func (p policy) AddPost(post storage.Post) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if post.PublishedAt != 0 && !p.at(RoleEditor) {
+		return forbidden("only editors may publish posts")
+	}
+	return p.Interface.AddPost(post)
+}
+
+func (p policy) UpdatePost(post storage.Post) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if p.at(RoleEditor) {
+		return p.Interface.UpdatePost(post)
+	}
+
+	old, err := p.primary().Post(post.ID)
+	if err != nil {
+		return err
+	}
+	if old.AuthorID != p.id.AuthorID {
+		return forbidden("authors may edit only their own posts")
+	}
+	if post.AuthorID != old.AuthorID {
+		return forbidden("only editors may change the author of a post")
+	}
+	if post.PublishedAt != old.PublishedAt {
+		return forbidden("only editors may publish posts")
+	}
+	return p.Interface.UpdatePost(post)
+}
+
+func (p policy) DeletePost(post storage.Post) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if !p.at(RoleAdmin) {
+		return forbidden("only admins may delete posts")
+	}
+	return p.Interface.DeletePost(post)
+}
+
+func (p policy) AddAuthor(a storage.Author) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if !p.at(RoleAdmin) {
+		return forbidden("only admins may manage authors")
+	}
+	return p.Interface.AddAuthor(a)
+}
+
+func (p policy) DeleteAuthor(a storage.Author) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if !p.at(RoleAdmin) {
+		return forbidden("only admins may manage authors")
+	}
+	return p.Interface.DeleteAuthor(a)
+}
+
+func (p policy) AddTag(t storage.Tag) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if !p.at(RoleEditor) {
+		return forbidden("only editors may manage tags")
+	}
+	return p.Interface.AddTag(t)
+}
+
+func (p policy) DeleteTag(t storage.Tag) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if !p.at(RoleEditor) {
+		return forbidden("only editors may manage tags")
+	}
+	return p.Interface.DeleteTag(t)
+}
+
+// AddComment разрешает комментировать любому клиенту с известной ролью.
+func (p policy) AddComment(c storage.Comment) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	return p.Interface.AddComment(c)
+}
+
+// UpdateComment разрешает изменять комментарий только его автору.
+func (p policy) UpdateComment(c storage.Comment) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	old, err := p.primary().Comment(c.ID)
+	if err != nil {
+		return err
+	}
+	if old.AuthorID != p.id.AuthorID {
+		return forbidden("authors may edit only their own comments")
+	}
+	return p.Interface.UpdateComment(c)
+}
+
+// DeleteComment разрешает удалять комментарий его автору,
+// а чужие комментарии - редакторам.
+func (p policy) DeleteComment(c storage.Comment) error {
+	if err := p.member(); err != nil {
+		return err
+	}
+	if p.at(RoleEditor) {
+		return p.Interface.DeleteComment(c)
+	}
+
+	old, err := p.primary().Comment(c.ID)
+	if err != nil {
+		return err
+	}
+	if old.AuthorID != p.id.AuthorID {
+		return forbidden("only editors may delete comments of others")
+	}
+	return p.Interface.DeleteComment(c)
+}
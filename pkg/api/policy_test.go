@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAPI_policy(t *testing.T) {
+	api := New(testDB(t), WithAuth(NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "mark", AuthorID: 1},
+		APIKey{Key: "editor", AuthorID: 2, Role: RoleEditor},
+		APIKey{Key: "admin", AuthorID: 3, Role: RoleAdmin},
+	)))
+
+	// Post 1 is written by Mark (author 1), post 2 by Tom (author 2).
+	own := `{"ID": 1, "Title": "New title", "Content": "Text", "AuthorID": 1, "CreatedAt": 1643723400, "PublishedAt": 1643723400}`
+	foreign := `{"ID": 2, "Title": "New title", "Content": "Text", "AuthorID": 2, "CreatedAt": 1643809800, "PublishedAt": 1643809800}`
+	unpublish := `{"ID": 1, "Title": "New title", "Content": "Text", "AuthorID": 1, "CreatedAt": 1643723400}`
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"author edits own post", "mark", http.MethodPut, "/posts", own, http.StatusOK},
+		{"author edits foreign post", "mark", http.MethodPut, "/posts", foreign, http.StatusForbidden},
+		{"author unpublishes", "mark", http.MethodPut, "/posts", unpublish, http.StatusForbidden},
+		{"author publishes new post", "mark", http.MethodPost, "/posts", `{"Title": "T", "Content": "C", "CreatedAt": 1, "PublishedAt": 2}`, http.StatusForbidden},
+		{"author deletes", "mark", http.MethodDelete, "/posts", `{"ID": 1}`, http.StatusForbidden},
+		{"author adds author", "mark", http.MethodPost, "/authors", `{"Name": "Ann"}`, http.StatusForbidden},
+		{"editor edits foreign post", "editor", http.MethodPut, "/posts", unpublish, http.StatusOK},
+		{"editor deletes", "editor", http.MethodDelete, "/posts", `{"ID": 1}`, http.StatusForbidden},
+		{"author adds tag", "mark", http.MethodPost, "/tags", `{"Name": "sport"}`, http.StatusForbidden},
+		{"author tags own post", "mark", http.MethodPut, "/posts", `{"ID": 1, "Title": "T", "Content": "C", "AuthorID": 1, "CreatedAt": 1643723400, "Tags": ["sport"]}`, http.StatusOK},
+		{"editor adds tag", "editor", http.MethodPost, "/tags", `{"Name": "economy"}`, http.StatusOK},
+		{"author deletes tag", "mark", http.MethodDelete, "/tags", `{"Name": "economy"}`, http.StatusForbidden},
+		{"editor deletes tag", "editor", http.MethodDelete, "/tags", `{"Name": "economy"}`, http.StatusOK},
+		{"author comments", "mark", http.MethodPost, "/posts/2/comments", `{"Content": "Nice"}`, http.StatusOK},
+		{"editor replies", "editor", http.MethodPost, "/posts/2/comments", `{"Content": "Thanks", "ParentID": 1}`, http.StatusOK},
+		{"author edits own comment", "mark", http.MethodPut, "/posts/2/comments", `{"ID": 1, "Content": "Edited"}`, http.StatusOK},
+		{"author edits foreign comment", "mark", http.MethodPut, "/posts/2/comments", `{"ID": 2, "Content": "Edited"}`, http.StatusForbidden},
+		{"editor edits foreign comment", "editor", http.MethodPut, "/posts/2/comments", `{"ID": 1, "Content": "Edited"}`, http.StatusForbidden},
+		{"author edits comment of another post", "mark", http.MethodPut, "/posts/3/comments", `{"ID": 1, "Content": "Edited"}`, http.StatusNotFound},
+		{"author deletes foreign comment", "mark", http.MethodDelete, "/posts/2/comments", `{"ID": 2}`, http.StatusForbidden},
+		{"editor deletes foreign comment", "editor", http.MethodDelete, "/posts/2/comments", `{"ID": 1}`, http.StatusOK},
+		{"author comments again", "mark", http.MethodPost, "/posts/2/comments", `{"Content": "Again"}`, http.StatusOK},
+		{"author deletes own comment", "mark", http.MethodDelete, "/posts/2/comments", `{"ID": 3}`, http.StatusOK},
+		{"admin deletes", "admin", http.MethodDelete, "/posts", `{"ID": 1}`, http.StatusOK},
+		{"admin deletes missing post", "admin", http.MethodDelete, "/posts", `{"ID": 1}`, http.StatusNotFound},
+		{"admin adds author", "admin", http.MethodPost, "/authors", `{"Name": "Ann"}`, http.StatusOK},
+		{"admin deletes author with posts", "admin", http.MethodDelete, "/authors", `{"ID": 1}`, http.StatusConflict},
+		{"admin deletes missing author", "admin", http.MethodDelete, "/authors", `{"ID": 42}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("X-API-Key", tt.key)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+}
+
+// orphanDB serves comments without authors, as left by stores
+// that did not check them.
+type orphanDB struct {
+	*memdb.Store
+}
+
+func (db orphanDB) Comment(id int) (storage.Comment, error) {
+	c, err := db.Store.Comment(id)
+	c.AuthorID = 0
+	return c, err
+}
+
+func TestRestrict_zeroIdentity(t *testing.T) {
+	db := testDB(t)
+	// A comment without an author must not be editable by a client without one.
+	err := db.AddComment(storage.Comment{PostID: 1, AuthorID: 1, Content: "Anonymous"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := Restrict(orphanDB{db}, Identity{})
+
+	comment := storage.Comment{ID: 1, Content: "Edited"}
+	ops := map[string]func() error{
+		"AddPost":       func() error { return p.AddPost(storage.Post{Title: "T", Content: "C"}) },
+		"UpdatePost":    func() error { return p.UpdatePost(storage.TestPosts[0]) },
+		"DeletePost":    func() error { return p.DeletePost(storage.Post{ID: 1}) },
+		"AddAuthor":     func() error { return p.AddAuthor(storage.Author{Name: "Ann"}) },
+		"DeleteAuthor":  func() error { return p.DeleteAuthor(storage.Author{ID: 1}) },
+		"AddTag":        func() error { return p.AddTag(storage.Tag{Name: "sport"}) },
+		"DeleteTag":     func() error { return p.DeleteTag(storage.Tag{Name: "sport"}) },
+		"AddComment":    func() error { return p.AddComment(storage.Comment{PostID: 1, Content: "C"}) },
+		"UpdateComment": func() error { return p.UpdateComment(comment) },
+		"DeleteComment": func() error { return p.DeleteComment(comment) },
+	}
+	for name, op := range ops {
+		var fe *ForbiddenError
+		if err := op(); !errors.As(err, &fe) {
+			t.Errorf("%s: expected a forbidden error, got %v", name, err)
+		}
+	}
+	c, err := db.Comment(1)
+	if err != nil || c.Content != "Anonymous" {
+		t.Errorf("expected comment to stay unchanged, got %+v, %v", c, err)
+	}
+}
+
+// staleDB serves an outdated author of every post unless
+// the read is bound to the primary.
+type staleDB struct {
+	*memdb.Store
+	stale bool
+}
+
+func (db *staleDB) Bind(ctx context.Context) storage.Interface {
+	return &staleDB{Store: db.Store, stale: !storage.PrimaryFrom(ctx)}
+}
+
+func (db *staleDB) Post(id int) (storage.Post, error) {
+	p, err := db.Store.Post(id)
+	if db.stale {
+		p.AuthorID = 2
+	}
+	return p, err
+}
+
+func TestRestrict_primary(t *testing.T) {
+	db := &staleDB{Store: memdb.New(), stale: true}
+	for _, tp := range storage.TestPosts {
+		db.AddPost(tp)
+	}
+	post, _ := db.Store.Post(1)
+	if post.AuthorID == 2 {
+		t.Fatal("expected post 1 to belong to another author")
+	}
+	// A replica still lists the client as the author of the post.
+	post.AuthorID = 2
+	post.Title = "Taken over"
+	p := Restrict(db, Identity{AuthorID: 2, Role: RoleAuthor})
+	var fe *ForbiddenError
+	if err := p.UpdatePost(post); !errors.As(err, &fe) {
+		t.Errorf("expected a forbidden error, got %v", err)
+	}
+}
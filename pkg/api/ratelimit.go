@@ -0,0 +1,258 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit задаёт корзину токенов: запросы расходуют по токену,
+// корзина пополняется со скоростью Rate токенов в секунду
+// и вмещает не больше Burst токенов.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits задаёт ограничения частоты запросов клиентов.
+// Клиент определяется по API-ключу или токену, а анонимный клиент -
+// по IP-адресу. Нулевой Limit отключает ограничение.
+type RateLimits struct {
+	Read  Limit // ограничение для запросов на чтение
+	Write Limit // ограничение для запросов, изменяющих данные
+
+	// Ограничение всех запросов с одного IP-адреса. Проверяется
+	// до аутентификации, поэтому распространяется и на запросы
+	// с неверными учётными данными.
+	Address Limit
+
+	ExemptAuthors []ExemptAuthor // авторы без ограничений
+	ExemptNets    []*net.IPNet   // подсети без ограничений
+
+	// Брать адрес клиента из заголовка X-Forwarded-For.
+	// Включается, только если сервер работает за доверенным прокси.
+	TrustForwardedFor bool
+	// Число доверенных прокси перед сервером. Каждый прокси дописывает
+	// адрес в конец X-Forwarded-For, поэтому адрес клиента берётся
+	// на ProxyHops позиций от конца заголовка. 0 равнозначно 1.
+	ProxyHops int
+}
+
+// ExemptAuthor - автор без ограничений частоты запросов. Идентификаторы
+// авторов у каждого арендатора свои; пустой Tenant обозначает автора
+// без арендатора.
+type ExemptAuthor struct {
+	Tenant   string
+	AuthorID int
+}
+
+// WithRateLimits включает ограничение частоты запросов.
+func WithRateLimits(limits RateLimits) Option {
+	return func(api *API) {
+		api.limiter = newRateLimiter(limits)
+	}
+}
+
+// bucket - корзина токенов одного клиента.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit // ограничение, по которому корзина пополняется
+}
+
+// full сообщает, наполнилась ли корзина к моменту now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// rateLimiter ограничивает частоту запросов по алгоритму token bucket.
+type rateLimiter struct {
+	conf      RateLimits
+	exemptIDs map[string]bool // ключи корзин авторов без ограничений
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// sweepInterval - период удаления корзин неактивных клиентов.
+const sweepInterval = time.Minute
+
+func newRateLimiter(conf RateLimits) *rateLimiter {
+	rl := rateLimiter{
+		conf:      conf,
+		exemptIDs: make(map[string]bool),
+		buckets:   make(map[string]*bucket),
+		now:       time.Now,
+	}
+	for _, a := range conf.ExemptAuthors {
+		rl.exemptIDs[authorKey(a.Tenant, a.AuthorID)] = true
+	}
+	return &rl
+}
+
+// authorKey возвращает ключ корзины автора.
+// Идентификаторы авторов у каждого арендатора свои.
+func authorKey(tenant string, id int) string {
+	if tenant != "" {
+		return "author:" + tenant + "/" + strconv.Itoa(id)
+	}
+	return "author:" + strconv.Itoa(id)
+}
+
+// clientIP определяет адрес клиента. Начало X-Forwarded-For
+// задаёт сам клиент, поэтому адрес берётся из той части заголовка,
+// которую дописали доверенные прокси.
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	if rl.conf.TrustForwardedFor {
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+		n := rl.conf.ProxyHops
+		if n < 1 {
+			n = 1
+		}
+		if len(hops) >= n {
+			if ip := strings.TrimSpace(hops[len(hops)-n]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// exemptIP сообщает, входит ли адрес в подсети без ограничений.
+func (rl *rateLimiter) exemptIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, n := range rl.conf.ExemptNets {
+		if parsed != nil && n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// client возвращает ключ корзины клиента и признак освобождения
+// от ограничений.
+func (rl *rateLimiter) client(r *http.Request) (string, bool) {
+	if id, ok := IdentityFrom(r.Context()); ok {
+		key := authorKey(id.Tenant, id.AuthorID)
+		return key, rl.exemptIDs[key]
+	}
+
+	ip := rl.clientIP(r)
+	if rl.exemptIP(ip) {
+		return "", true
+	}
+	return "ip:" + ip, false
+}
+
+// take расходует токен из корзины клиента. Возвращает, разрешён ли
+// запрос, сколько токенов осталось и через сколько корзина наполнится
+// или, если запрос отклонён, появится следующий токен.
+func (rl *rateLimiter) take(key string, limit Limit) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.lastSweep) > sweepInterval {
+		rl.sweep(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	full := time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second))
+	return true, int(b.tokens), full
+}
+
+// sweep удаляет корзины, которые успели наполниться: для клиента
+// такая корзина ничем не отличается от новой. Корзины медленных
+// ограничений наполняются дольше sweepInterval и остаются до тех пор.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if b.full(now) {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// allow расходует токен из корзины и передаёт лимит в заголовках
+// ответа. Если запрос отклонён, ответ клиенту уже отправлен.
+func (rl *rateLimiter) allow(w http.ResponseWriter, key string, limit Limit) bool {
+	ok, remaining, reset := rl.take(key, limit)
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+	if !ok {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(reset)))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+func (l Limit) off() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+// addressMiddleware ограничивает частоту всех запросов с одного
+// адреса. Выполняется до аутентификации.
+func (rl *rateLimiter) addressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.conf.Address.off() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := rl.clientIP(r)
+		if !rl.exemptIP(ip) && !rl.allow(w, "address:"+ip, rl.conf.Address) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middleware ограничивает частоту запросов клиента.
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, scope := rl.conf.Read, "read"
+		if isWrite(r) {
+			limit, scope = rl.conf.Write, "write"
+		}
+		key, exempt := rl.client(r)
+		if exempt || limit.off() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !rl.allow(w, scope+":"+key, limit) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage/memdb"
+)
+
+func TestAPI_rateLimits(t *testing.T) {
+	_, local, _ := net.ParseCIDR("10.0.0.0/8")
+	api := New(memdb.New(), WithRateLimits(RateLimits{
+		Read:       Limit{Rate: 1, Burst: 2},
+		Write:      Limit{Rate: 1, Burst: 1},
+		ExemptNets: []*net.IPNet{local},
+	}))
+	now := time.Unix(1643723400, 0)
+	api.limiter.now = func() time.Time { return now }
+
+	get := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := get("192.0.2.1:1000"); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusOK, rr.Code)
+		}
+	}
+	rr := get("192.0.2.1:1000")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+	if got := rr.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("expected X-RateLimit-Remaining 0, got %q", got)
+	}
+
+	// Other clients and exempt networks have their own budget.
+	if rr := get("192.0.2.2:1000"); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d for another client, got %d", http.StatusOK, rr.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if rr := get("10.1.2.3:1000"); rr.Code != http.StatusOK {
+			t.Errorf("expected status %d for exempt client, got %d", http.StatusOK, rr.Code)
+		}
+	}
+
+	// The bucket refills over time.
+	now = now.Add(time.Second)
+	if rr := get("192.0.2.1:1000"); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d after refill, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestRateLimiter_clientIP(t *testing.T) {
+	tests := []struct {
+		hops int
+		xff  []string
+		want string
+	}{
+		{0, []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{1, []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{2, []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, "198.51.100.7"},
+		{2, []string{"198.51.100.7"}, "192.0.2.1"},
+		{1, nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		rl := newRateLimiter(RateLimits{TrustForwardedFor: true, ProxyHops: tt.hops})
+		req := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		req.RemoteAddr = "192.0.2.1:1000"
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := rl.clientIP(req); got != tt.want {
+			t.Errorf("%d hops, %q: expected %q, got %q", tt.hops, tt.xff, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimiter_sweep(t *testing.T) {
+	rl := newRateLimiter(RateLimits{})
+	now := time.Unix(1643723400, 0)
+	rl.now = func() time.Time { return now }
+	slow := Limit{Rate: 1.0 / 600, Burst: 1} // one request per 10 minutes
+	fast := Limit{Rate: 1, Burst: 1}
+
+	if ok, _, _ := rl.take("slow", slow); !ok {
+		t.Fatal("expected the first request to be allowed")
+	}
+	if ok, _, _ := rl.take("fast", fast); !ok {
+		t.Fatal("expected the first request to be allowed")
+	}
+
+	// A sweep keeps buckets that have not refilled yet.
+	now = now.Add(2 * sweepInterval)
+	rl.take("other", fast)
+	if ok, _, _ := rl.take("slow", slow); ok {
+		t.Error("expected the slow limit to survive the sweep")
+	}
+	if _, ok := rl.buckets["fast"]; ok {
+		t.Error("expected the refilled bucket to be removed")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if ok, _, _ := rl.take("slow", slow); !ok {
+		t.Error("expected the slow limit to refill")
+	}
+}
+
+func TestRateLimiter_exemptAuthors(t *testing.T) {
+	rl := newRateLimiter(RateLimits{ExemptAuthors: []ExemptAuthor{{Tenant: "daily", AuthorID: 1}}})
+	tests := []struct {
+		id   Identity
+		want bool
+	}{
+		{Identity{AuthorID: 1, Role: RoleAuthor, Tenant: "daily"}, true},
+		{Identity{AuthorID: 1, Role: RoleAuthor, Tenant: "weekly"}, false},
+		{Identity{AuthorID: 1, Role: RoleAuthor}, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/posts", nil)
+		req = req.WithContext(context.WithValue(req.Context(), identityKey, tt.id))
+		if _, exempt := rl.client(req); exempt != tt.want {
+			t.Errorf("%+v: expected exempt %v, got %v", tt.id, tt.want, exempt)
+		}
+	}
+}
+
+func TestAPI_rateLimitsBeforeAuth(t *testing.T) {
+	api := New(memdb.New(),
+		WithAuth(NewAuth([]byte("secret"), time.Hour, APIKey{Key: "key", AuthorID: 1})),
+		WithRateLimits(RateLimits{Address: Limit{Rate: 1, Burst: 2}}))
+	now := time.Unix(1643723400, 0)
+	api.limiter.now = func() time.Time { return now }
+
+	post := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/posts", nil)
+		req.RemoteAddr = "192.0.2.1:1000"
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := post("wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusUnauthorized, code)
+		}
+	}
+	if code := post("wrong"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d for invalid credentials, got %d", http.StatusTooManyRequests, code)
+	}
+	if code := post("key"); code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d for the same address, got %d", http.StatusTooManyRequests, code)
+	}
+}
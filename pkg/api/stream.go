@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"GoNews/pkg/storage"
+)
+
+// WithBus включает потоки событий об изменении публикаций:
+// /posts/stream (Server-Sent Events) и /posts/ws (WebSocket).
+func WithBus(bus *storage.Bus) Option {
+	return func(api *API) {
+		api.bus = bus
+	}
+}
+
+// eventReset сообщает клиенту, что часть событий потеряна
+// и публикации нужно загрузить заново.
+const eventReset = "reset"
+
+// Параметры соединений потоков событий.
+var (
+	streamHeartbeat = 15 * time.Second // период проверки соединения
+	wsWriteTimeout  = 10 * time.Second // время на отправку сообщения
+)
+
+// subscribe подписывается на события. Клиент, переподключаясь,
+// передаёт ID последнего полученного события в заголовке
+// Last-Event-ID или параметре lastEventId.
+func (api *API) subscribe(w http.ResponseWriter, r *http.Request) (*storage.Subscription, bool) {
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
+	}
+	if last == "" {
+		return api.bus.Subscribe(), true
+	}
+	id, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		http.Error(w, "Last-Event-ID must be an event ID", http.StatusBadRequest)
+		return nil, false
+	}
+	return api.bus.Resume(id), true
+}
+
+// Поток событий в формате Server-Sent Events.
+func (api *API) sseHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	sub, ok := api.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if sub.Gap {
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {}\n\n", sub.Last, eventReset)
+	}
+	for _, e := range sub.Backlog {
+		writeSSE(w, e)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// Клиент не успевал получать события. Переподключившись
+				// с Last-Event-ID, он получит пропущенные.
+				return
+			}
+			writeSSE(w, e)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE отправляет событие: тип события в поле event,
+// публикацию в формате JSON в поле data.
+func writeSSE(w http.ResponseWriter, e storage.Event) {
+	data, _ := json.Marshal(e.Post)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+}
+
+// checkOrigin разрешает WebSocket-соединения с того же узла
+// и с источников, разрешённых настройками CORS.
+func (api *API) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if api.cors != nil && api.cors.originAllowed(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Поток событий через WebSocket. Каждое событие отправляется
+// отдельным сообщением в формате JSON.
+func (api *API) wsHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := api.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	upgrader := websocket.Upgrader{CheckOrigin: api.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrader уже отправил клиенту ошибку.
+		return
+	}
+	defer conn.Close()
+
+	// Клиент ничего не отправляет, но сообщения нужно читать,
+	// чтобы обрабатывать ответы на ping и закрытие соединения.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(512)
+		conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+		})
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(e storage.Event) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(e) == nil
+	}
+	if sub.Gap && !send(storage.Event{ID: sub.Last, Type: eventReset}) {
+		return
+	}
+	for _, e := range sub.Backlog {
+		if !send(e) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if !send(e) {
+				return
+			}
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
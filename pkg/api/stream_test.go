@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+// streamServer starts the API over memdb publishing to a bus.
+func streamServer(t *testing.T) (*httptest.Server, *memdb.Store) {
+	t.Helper()
+	db := memdb.New()
+	bus := storage.NewBus(storage.DefaultBusHistory)
+	db.SetBus(bus)
+	srv := httptest.NewServer(New(db, WithBus(bus)).Router())
+	t.Cleanup(srv.Close)
+	return srv, db
+}
+
+// sseEvent is a parsed Server-Sent Event.
+type sseEvent struct {
+	id, event, data string
+}
+
+func readSSE(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("unexpected error reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.event != "" {
+				return e
+			}
+		case strings.HasPrefix(line, "id: "):
+			e.id = line[len("id: "):]
+		case strings.HasPrefix(line, "event: "):
+			e.event = line[len("event: "):]
+		case strings.HasPrefix(line, "data: "):
+			e.data = line[len("data: "):]
+		}
+	}
+}
+
+func openSSE(t *testing.T, url, lastID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url+"/posts/stream", nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error opening stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func TestAPI_sse(t *testing.T) {
+	srv, db := streamServer(t)
+
+	resp, r := openSSE(t, srv.URL, "")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	post := storage.Post{Title: "Draft", Content: "Text", AuthorID: 1}
+	db.AddPost(post)
+	post.ID, post.PublishedAt = 1, time.Now().Unix()
+	db.UpdatePost(post)
+	db.DeletePost(post)
+
+	var got []sseEvent
+	for _, want := range []string{storage.EventCreated, storage.EventPublished, storage.EventDeleted} {
+		e := readSSE(t, r)
+		if e.event != want || !strings.Contains(e.data, `"ID":1`) {
+			t.Errorf("expected %s event for post 1, got %+v", want, e)
+		}
+		got = append(got, e)
+	}
+	resp.Body.Close()
+
+	// Resuming after the first event replays the other two.
+	_, r = openSSE(t, srv.URL, got[0].id)
+	for _, want := range got[1:] {
+		if e := readSSE(t, r); e != want {
+			t.Errorf("expected replayed event %+v, got %+v", want, e)
+		}
+	}
+
+	// An unknown ID asks the client to reload.
+	id, _ := strconv.ParseUint(got[2].id, 10, 64)
+	_, r = openSSE(t, srv.URL, strconv.FormatUint(id+10, 10))
+	if e := readSSE(t, r); e.event != eventReset || e.id != got[2].id {
+		t.Errorf("expected reset event with ID %s, got %+v", got[2].id, e)
+	}
+
+	if resp, _ := openSSE(t, srv.URL, "abc"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestAPI_websocket(t *testing.T) {
+	srv, db := streamServer(t)
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/posts/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	defer conn.Close()
+
+	db.AddPost(storage.Post{Title: "New", Content: "Text", AuthorID: 1})
+	var e storage.Event
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err = conn.ReadJSON(&e)
+	if err != nil || e.Type != storage.EventCreated || e.Post.Title != "New" {
+		t.Errorf("expected created event, got %+v, error %v", e, err)
+	}
+
+	// A post created as published is announced as both.
+	db.AddPost(storage.Post{Title: "Live", Content: "Text", AuthorID: 1, CreatedAt: 1, PublishedAt: 1})
+	for _, want := range []string{storage.EventCreated, storage.EventPublished} {
+		var e storage.Event
+		err = conn.ReadJSON(&e)
+		if err != nil || e.Type != want || e.Post.Title != "Live" {
+			t.Errorf("expected %s event, got %+v, error %v", want, e, err)
+		}
+	}
+
+	// Foreign origins are rejected unless allowed by CORS.
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d for foreign origin, got %v", http.StatusForbidden, err)
+	}
+}
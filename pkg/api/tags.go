@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"GoNews/pkg/storage"
+)
+
+// Получение всех меток с числом публикаций, по алфавиту.
+func (api *API) tagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := api.dbFrom(r.Context()).Tags()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if tags == nil {
+		tags = []storage.Tag{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// Облако меток: метки, у которых есть публикации, от самых
+// популярных к менее популярным. Параметр limit ограничивает
+// число меток.
+func (api *API) tagCloudHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	tags, err := api.dbFrom(r.Context()).Tags()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	cloud := make([]storage.Tag, 0, len(tags))
+	for _, t := range tags {
+		if t.Posts > 0 {
+			cloud = append(cloud, t)
+		}
+	}
+	// Метки с равным числом публикаций остаются по алфавиту.
+	sort.SliceStable(cloud, func(i, j int) bool {
+		return cloud[i].Posts > cloud[j].Posts
+	})
+	if limit > 0 && len(cloud) > limit {
+		cloud = cloud[:limit]
+	}
+	writeJSON(w, http.StatusOK, cloud)
+}
+
+// Добавление метки без публикаций.
+func (api *API) addTagHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := api.decodeTag(w, r)
+	if !ok || invalid(w, api.rules.checkTag("Name", t.Name)) {
+		return
+	}
+	err := api.store(r).AddTag(storage.Tag{Name: storage.NormalizeTag(t.Name)})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Удаление метки, у которой нет публикаций.
+func (api *API) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := api.decodeTag(w, r)
+	if !ok || invalid(w, api.rules.checkText("Name", t.Name, 0)) {
+		return
+	}
+	err := api.store(r).DeleteTag(storage.Tag{Name: storage.NormalizeTag(t.Name)})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"GoNews/pkg/storage"
+)
+
+func TestAPI_tags(t *testing.T) {
+	db := testDB(t)
+	api := New(db)
+
+	// Post 1 is about politics and economy, posts 3 and 4 about politics.
+	for id, tags := range map[int][]string{1: {"Politics", "economy"}, 3: {"politics"}, 4: {"politics "}} {
+		p := storage.TestPosts[id-1]
+		p.Tags = tags
+		body, _ := json.Marshal(p)
+		rr := serveJSON(t, api, http.MethodPut, "/posts", string(body))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d tagging post %d: %s", rr.Code, id, rr.Body)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"create", http.MethodPost, `{"Name": "Sport"}`, http.StatusOK},
+		{"create taken", http.MethodPost, `{"Name": "sport"}`, http.StatusConflict},
+		{"create without name", http.MethodPost, `{"Name": " "}`, http.StatusUnprocessableEntity},
+		{"create with comma", http.MethodPost, `{"Name": "a,b"}`, http.StatusUnprocessableEntity},
+		{"create with long name", http.MethodPost, `{"Name": "` + strings.Repeat("a", 51) + `"}`, http.StatusUnprocessableEntity},
+		{"create and delete", http.MethodPost, `{"Name": "weather"}`, http.StatusOK},
+		{"delete", http.MethodDelete, `{"Name": "Weather"}`, http.StatusOK},
+		{"delete missing", http.MethodDelete, `{"Name": "weather"}`, http.StatusNotFound},
+		{"delete tag of posts", http.MethodDelete, `{"Name": "politics"}`, http.StatusConflict},
+		{"malformed JSON", http.MethodPost, `[]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, tt.method, "/tags", tt.body)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.want, rr.Code, rr.Body)
+		}
+	}
+
+	var tags []storage.Tag
+	rr := serveJSON(t, api, http.MethodGet, "/tags", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("unexpected error decoding tags: %v", err)
+	}
+	want := []storage.Tag{{Name: "economy", Posts: 1}, {Name: "politics", Posts: 3}, {Name: "sport", Posts: 0}}
+	if rr.Code != http.StatusOK || !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tags %+v, got %+v with status %d", want, tags, rr.Code)
+	}
+
+	// The cloud leaves out unused tags and puts popular ones first.
+	rr = serveJSON(t, api, http.MethodGet, "/tags/cloud", "")
+	tags = nil
+	json.Unmarshal(rr.Body.Bytes(), &tags)
+	want = []storage.Tag{{Name: "politics", Posts: 3}, {Name: "economy", Posts: 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tag cloud %+v, got %+v", want, tags)
+	}
+	rr = serveJSON(t, api, http.MethodGet, "/tags/cloud?limit=1", "")
+	tags = nil
+	json.Unmarshal(rr.Body.Bytes(), &tags)
+	if len(tags) != 1 || tags[0].Name != "politics" {
+		t.Errorf("expected the most used tag, got %+v", tags)
+	}
+	if rr := serveJSON(t, api, http.MethodGet, "/tags/cloud?limit=0", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a bad limit, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestAPI_postsByTag(t *testing.T) {
+	db := testDB(t)
+	api := New(db)
+	for id, tags := range map[int][]string{1: {"politics", "economy"}, 3: {"politics"}} {
+		p := storage.TestPosts[id-1]
+		p.Tags = tags
+		if err := db.UpdatePost(p); err != nil {
+			t.Fatalf("unexpected error tagging post: %v", err)
+		}
+	}
+
+	tests := []struct {
+		target string
+		want   []int
+	}{
+		{"/posts?tag=politics", []int{3, 1}},
+		{"/posts?tag=Politics&tag=economy", []int{1}},
+		{"/posts?tag=sport", nil},
+	}
+	for _, tt := range tests {
+		rr := serveJSON(t, api, http.MethodGet, tt.target, "")
+		var posts []storage.Post
+		if err := json.Unmarshal(rr.Body.Bytes(), &posts); err != nil {
+			t.Fatalf("%s: unexpected error decoding posts: %v", tt.target, err)
+		}
+		var ids []int
+		for _, p := range posts {
+			ids = append(ids, p.ID)
+		}
+		if rr.Code != http.StatusOK || !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: expected posts %v, got %v with status %d", tt.target, tt.want, ids, rr.Code)
+		}
+	}
+
+	// Posts are checked for too many and malformed tags.
+	tooMany := make([]string, 11)
+	for i := range tooMany {
+		tooMany[i] = string(rune('a' + i))
+	}
+	for _, tags := range [][]string{tooMany, {"a,b"}, {""}} {
+		p := storage.TestPosts[0]
+		p.Tags = tags
+		body, _ := json.Marshal(p)
+		if rr := serveJSON(t, api, http.MethodPut, "/posts", string(body)); rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("tags %q: expected status %d, got %d", tags, http.StatusUnprocessableEntity, rr.Code)
+		}
+	}
+}
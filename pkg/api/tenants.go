@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"GoNews/pkg/storage"
+)
+
+// DefaultTenantHeader - заголовок с идентификатором арендатора
+// по умолчанию.
+const DefaultTenantHeader = "X-Tenant"
+
+// Tenancy задаёт размещение нескольких арендаторов (редакций)
+// на одном сервере. Арендатор запроса определяется по заголовку
+// Header, а если заголовка нет - по имени хоста: запросы
+// к acme.news.example.com при Domain = "news.example.com"
+// относятся к арендатору acme.
+type Tenancy struct {
+	Tenants storage.Tenants
+	Header  string // заголовок с идентификатором арендатора; пусто - не используется
+	Domain  string // домен, поддомены которого соответствуют арендаторам; пусто - не используется
+}
+
+// WithTenants включает размещение нескольких арендаторов. Запросы
+// к публикациям, авторам, лентам и GraphQL обрабатываются хранилищем
+// арендатора, а хранилище, переданное New, не используется.
+// Арендаторами управляют через /tenants; эти обработчики
+// регистрируются только вместе с аутентификацией.
+func WithTenants(t Tenancy) Option {
+	return func(api *API) {
+		api.tenancy = &t
+	}
+}
+
+// tenantFreePath сообщает, что запросы по пути не относятся
+// к арендатору.
+func tenantFreePath(path string) bool {
+	switch path {
+	case "/health", "/openapi.json", "/token", "/tenants":
+		return true
+	}
+	return strings.HasPrefix(path, "/tenants/")
+}
+
+// tenantOf возвращает идентификатор арендатора запроса
+// или пустую строку, если арендатор не указан.
+func (t *Tenancy) tenantOf(r *http.Request) string {
+	if t.Header != "" {
+		if id := r.Header.Get(t.Header); id != "" {
+			return id
+		}
+	}
+	if t.Domain == "" {
+		return ""
+	}
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	sub := strings.TrimSuffix(host, "."+strings.ToLower(t.Domain))
+	if sub == host || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// tenantStore - арендатор запроса и его хранилище.
+type tenantStore struct {
+	id string
+	db storage.Interface
+}
+
+// TenantFrom возвращает идентификатор арендатора запроса.
+func TenantFrom(ctx context.Context) (string, bool) {
+	t, ok := ctx.Value(tenantKey).(tenantStore)
+	return t.id, ok
+}
+
+// tenantMiddleware определяет арендатора запроса и передаёт
+// обработчикам его хранилище. Клиент, ключ которого выдан
+// арендатору, не может обращаться к данным других арендаторов.
+func (api *API) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || tenantFreePath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Ответы разных арендаторов не должны смешиваться в кэшах.
+		if api.tenancy.Header != "" {
+			w.Header().Add("Vary", api.tenancy.Header)
+		}
+
+		id := api.tenancy.tenantOf(r)
+		if id == "" {
+			http.Error(w, "tenant is not specified", http.StatusBadRequest)
+			return
+		}
+		err := storage.CheckTenant(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ident, ok := IdentityFrom(r.Context()); ok && ident.Tenant != "" && ident.Tenant != id {
+			writeError(w, forbidden("the client belongs to another tenant"))
+			return
+		}
+		db, err := api.tenancy.Tenants.Tenant(id)
+		if errors.Is(err, storage.ErrEntryNotExist) {
+			http.Error(w, "unknown tenant "+id, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantKey, tenantStore{id: id, db: db})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tenantEndpoints регистрирует обработчики управления арендаторами.
+func (api *API) tenantEndpoints() {
+	api.router.HandleFunc("/tenants", api.tenantsHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/tenants", api.addTenantHandler).Methods(http.MethodPost)
+	api.router.HandleFunc("/tenants/{id}", api.deleteTenantHandler).Methods(http.MethodDelete)
+}
+
+// operator проверяет, что клиент - администратор, ключ которого
+// не выдан какому-либо арендатору. При отказе ответ клиенту
+// уже отправлен.
+func (api *API) operator(w http.ResponseWriter, r *http.Request) bool {
+	id, ok := IdentityFrom(r.Context())
+	if !ok {
+		unauthorized(w, ErrNoCredentials)
+		return false
+	}
+	if roleRank[id.Role] < roleRank[RoleAdmin] || id.Tenant != "" {
+		writeError(w, forbidden("only operator admins may manage tenants"))
+		return false
+	}
+	return true
+}
+
+// Tenant - арендатор в ответах API.
+type Tenant struct {
+	ID string `json:"id"`
+}
+
+// Получение арендаторов.
+func (api *API) tenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.operator(w, r) {
+		return
+	}
+	ids, err := api.tenancy.Tenants.Tenants()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list := make([]Tenant, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, Tenant{ID: id})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Создание арендатора с пустым хранилищем.
+func (api *API) addTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.operator(w, r) {
+		return
+	}
+	var t Tenant
+	if !api.decodeJSON(w, r, &t) {
+		return
+	}
+	if err := storage.CheckTenant(t.ID); err != nil {
+		invalid(w, []FieldError{{Field: "id", Message: err.Error()}})
+		return
+	}
+	err := api.tenancy.Tenants.AddTenant(t.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// Удаление арендатора вместе с его данными.
+func (api *API) deleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.operator(w, r) {
+		return
+	}
+	err := api.tenancy.Tenants.DeleteTenant(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
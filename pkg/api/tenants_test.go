@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func newTenants(t *testing.T) *memdb.Tenants {
+	t.Helper()
+	tenants, err := memdb.NewTenants(memdb.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error creating tenants: %v", err)
+	}
+	return tenants
+}
+
+// serveTenant serves a request to the tenant with the API key;
+// empty values are not sent.
+func serveTenant(api *API, method, path, body, tenant, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if tenant != "" {
+		req.Header.Set(DefaultTenantHeader, tenant)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_tenants(t *testing.T) {
+	api := New(nil, WithTenants(Tenancy{Tenants: newTenants(t), Header: DefaultTenantHeader}),
+		WithAuth(NewAuth([]byte("secret"), time.Hour, APIKey{Key: "operator", AuthorID: 1, Role: RoleAdmin})))
+	serveJSON := func(t *testing.T, api *API, method, path, body string) *httptest.ResponseRecorder {
+		return serveJSON(t, api, method, path, body, "X-API-Key", "operator")
+	}
+
+	for _, id := range []string{"acme", "globex"} {
+		rr := serveJSON(t, api, http.MethodPost, "/tenants", `{"id":"`+id+`"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d creating tenant %s, got %d: %s", http.StatusCreated, id, rr.Code, rr.Body)
+		}
+	}
+	if rr := serveJSON(t, api, http.MethodPost, "/tenants", `{"id":"acme"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d for a duplicate tenant, got %d", http.StatusConflict, rr.Code)
+	}
+	if rr := serveJSON(t, api, http.MethodPost, "/tenants", `{"id":"Acme Corp"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d for an invalid tenant ID, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	rr := serveJSON(t, api, http.MethodGet, "/tenants", "")
+	var list []Tenant
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].ID != "acme" || list[1].ID != "globex" {
+		t.Errorf("expected tenants acme and globex, got %s", rr.Body)
+	}
+
+	// Data of one tenant is invisible to the other.
+	if rr := serveTenant(api, http.MethodPost, "/authors", `{"Name":"Mark"}`, "acme", "operator"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d adding author, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	post := `{"Title":"Acme news","Content":"Text","AuthorID":1}`
+	if rr := serveTenant(api, http.MethodPost, "/posts", post, "acme", "operator"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d adding post, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	// Authors are checked against the tenant's own authors.
+	if rr := serveTenant(api, http.MethodPost, "/posts", post, "globex", "operator"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d for an author of another tenant, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	for tenant, want := range map[string]int{"acme": 1, "globex": 0} {
+		rr := serveTenant(api, http.MethodGet, "/posts", "", tenant, "")
+		var posts []storage.Post
+		json.Unmarshal(rr.Body.Bytes(), &posts)
+		if rr.Code != http.StatusOK || len(posts) != want {
+			t.Errorf("%s: expected %d posts, got status %d and %s", tenant, want, rr.Code, rr.Body)
+		}
+		if vary := rr.Header().Get("Vary"); !strings.Contains(vary, DefaultTenantHeader) {
+			t.Errorf("%s: expected Vary to name %s, got %q", tenant, DefaultTenantHeader, vary)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tenant string
+		status int
+	}{
+		{"missing", "", http.StatusBadRequest},
+		{"invalid", "ACME!", http.StatusBadRequest},
+		{"unknown", "initech", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rr := serveTenant(api, http.MethodGet, "/posts", "", tt.tenant, ""); rr.Code != tt.status {
+			t.Errorf("%s tenant: expected status %d, got %d", tt.name, tt.status, rr.Code)
+		}
+	}
+	// Routes outside tenants need no tenant.
+	if rr := serveTenant(api, http.MethodGet, "/openapi.json", "", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d for /openapi.json, got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr := serveJSON(t, api, http.MethodDelete, "/tenants/acme", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d deleting tenant, got %d", http.StatusOK, rr.Code)
+	}
+	if rr := serveJSON(t, api, http.MethodDelete, "/tenants/acme", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d deleting tenant twice, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := serveTenant(api, http.MethodGet, "/posts", "", "acme", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a deleted tenant, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestAPI_tenantHost(t *testing.T) {
+	tenants := newTenants(t)
+	tenants.AddTenant("acme")
+	api := New(nil, WithTenants(Tenancy{Tenants: tenants, Header: DefaultTenantHeader, Domain: "news.example.com"}))
+
+	tests := []struct {
+		host   string
+		status int
+	}{
+		{"acme.news.example.com", http.StatusOK},
+		{"ACME.news.example.com:8080", http.StatusOK},
+		{"news.example.com", http.StatusBadRequest},
+		{"www.acme.news.example.com", http.StatusBadRequest},
+		{"acme.example.org", http.StatusBadRequest},
+		{"initech.news.example.com", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/authors", nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		api.Router().ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.host, tt.status, rr.Code)
+		}
+	}
+
+	// The header takes precedence over the host name.
+	req := httptest.NewRequest(http.MethodGet, "/authors", nil)
+	req.Host = "initech.news.example.com"
+	req.Header.Set(DefaultTenantHeader, "acme")
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d with the tenant header, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestAPI_tenantAuth(t *testing.T) {
+	tenants := newTenants(t)
+	tenants.AddTenant("acme")
+	tenants.AddTenant("globex")
+	auth := NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "operator", AuthorID: 1, Role: RoleAdmin},
+		APIKey{Key: "acme-admin", AuthorID: 1, Role: RoleAdmin, Tenant: "acme"},
+	)
+	api := New(nil, WithAuth(auth), WithTenants(Tenancy{Tenants: tenants, Header: DefaultTenantHeader}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		tenant string
+		key    string
+		status int
+	}{
+		{"own tenant", http.MethodPost, "/authors", `{"Name":"Mark"}`, "acme", "acme-admin", http.StatusOK},
+		{"other tenant", http.MethodGet, "/posts", "", "globex", "acme-admin", http.StatusForbidden},
+		{"operator in any tenant", http.MethodPost, "/authors", `{"Name":"Tom"}`, "globex", "operator", http.StatusOK},
+		{"anonymous list", http.MethodGet, "/tenants", "", "", "", http.StatusUnauthorized},
+		{"tenant admin list", http.MethodGet, "/tenants", "", "", "acme-admin", http.StatusForbidden},
+		{"tenant admin create", http.MethodPost, "/tenants", `{"id":"initech"}`, "", "acme-admin", http.StatusForbidden},
+		{"tenant admin delete", http.MethodDelete, "/tenants/globex", "", "", "acme-admin", http.StatusForbidden},
+		{"operator create", http.MethodPost, "/tenants", `{"id":"initech"}`, "", "operator", http.StatusCreated},
+		{"operator list", http.MethodGet, "/tenants", "", "", "operator", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := serveTenant(api, tt.method, tt.path, tt.body, tt.tenant, tt.key)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, rr.Code, rr.Body)
+		}
+	}
+
+	// A token carries the tenant of its key.
+	token, _, _ := auth.IssueToken(Identity{AuthorID: 1, Role: RoleAdmin, Tenant: "acme"})
+	req := httptest.NewRequest(http.MethodGet, "/authors", nil)
+	req.Header.Set(DefaultTenantHeader, "globex")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d for a token of another tenant, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestAPI_tenantsWithoutAuth(t *testing.T) {
+	tenants := newTenants(t)
+	tenants.AddTenant("acme")
+	api := New(nil, WithTenants(Tenancy{Tenants: tenants, Header: DefaultTenantHeader}))
+
+	if rr := serveJSON(t, api, http.MethodDelete, "/tenants/acme", ""); rr.Code == http.StatusOK {
+		t.Errorf("expected tenants to be unmanageable without authentication, got status %d", rr.Code)
+	}
+	if rr := serveTenant(api, http.MethodGet, "/posts", "", "acme", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected tenant acme to remain, got status %d", rr.Code)
+	}
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"GoNews/pkg/storage"
+)
+
+// AuthorLookup позволяет проверить существование автора.
+type AuthorLookup interface {
+	Author(id int) (storage.Author, error)
+}
+
+// Rules задаёт правила проверки входящих публикаций.
+type Rules struct {
+	MaxBodyBytes  int64 // максимальный размер тела запроса
+	MaxTitleLen   int   // максимальная длина заголовка в символах
+	MaxContentLen int   // максимальная длина текста в символах
+	MaxNameLen    int   // максимальная длина имени автора в символах
+	MaxTagLen     int   // максимальная длина имени метки в символах
+	MaxTags       int   // максимальное число меток публикации
+	MaxCommentLen int   // максимальная длина комментария в символах
+
+	// Источник авторов для проверки AuthorID.
+	// Если nil, существование автора не проверяется.
+	Authors AuthorLookup
+}
+
+// DefaultRules возвращает правила проверки по умолчанию.
+func DefaultRules() Rules {
+	return Rules{
+		MaxBodyBytes:  1 << 20,
+		MaxTitleLen:   200,
+		MaxContentLen: 100000,
+		MaxNameLen:    50,
+		MaxTagLen:     50,
+		MaxTags:       10,
+		MaxCommentLen: 5000,
+	}
+}
+
+// WithRules задаёт правила проверки входящих публикаций.
+func WithRules(rules Rules) Option {
+	return func(api *API) {
+		api.rules = rules
+	}
+}
+
+// FieldError - ошибка в поле публикации.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationErrors - тело ответа 422 Unprocessable Entity.
+type validationErrors struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// validateID проверяет идентификатор публикации.
+func (rules Rules) validateID(p storage.Post) []FieldError {
+	if p.ID <= 0 {
+		return []FieldError{{Field: "ID", Message: "must be a positive integer"}}
+	}
+	return nil
+}
+
+// ValidateNew проверяет публикацию перед созданием.
+func (rules Rules) ValidateNew(p storage.Post) []FieldError {
+	var errs []FieldError
+
+	errs = append(errs, rules.checkText("Title", p.Title, rules.MaxTitleLen)...)
+	errs = append(errs, rules.checkText("Content", p.Content, rules.MaxContentLen)...)
+
+	if p.CreatedAt < 0 {
+		errs = append(errs, FieldError{Field: "CreatedAt", Message: "must not be negative"})
+	}
+	if p.PublishedAt < 0 {
+		errs = append(errs, FieldError{Field: "PublishedAt", Message: "must not be negative"})
+	}
+	if p.PublishedAt > 0 && p.PublishedAt < p.CreatedAt {
+		errs = append(errs, FieldError{Field: "PublishedAt", Message: "must not be earlier than CreatedAt"})
+	}
+	errs = append(errs, rules.checkTags(p.Tags)...)
+
+	switch {
+	case p.AuthorID <= 0:
+		errs = append(errs, FieldError{Field: "AuthorID", Message: "must be a positive integer"})
+	case rules.Authors != nil:
+		_, err := rules.Authors.Author(p.AuthorID)
+		if errors.Is(err, storage.ErrEntryNotExist) {
+			errs = append(errs, FieldError{Field: "AuthorID", Message: fmt.Sprintf("author %d does not exist", p.AuthorID)})
+		}
+		// Прочие ошибки хранилища не относятся к данным клиента,
+		// их вернёт само хранилище при записи.
+	}
+
+	return errs
+}
+
+// ValidateUpdate проверяет публикацию перед обновлением.
+func (rules Rules) ValidateUpdate(p storage.Post) []FieldError {
+	return append(rules.validateID(p), rules.ValidateNew(p)...)
+}
+
+// validateAuthor проверяет автора перед созданием.
+func (rules Rules) validateAuthor(a storage.Author) []FieldError {
+	return rules.checkText("Name", a.Name, rules.MaxNameLen)
+}
+
+// validateAuthorID проверяет идентификатор автора.
+func (rules Rules) validateAuthorID(a storage.Author) []FieldError {
+	if a.ID <= 0 {
+		return []FieldError{{Field: "ID", Message: "must be a positive integer"}}
+	}
+	return nil
+}
+
+// validateComment проверяет комментарий перед созданием.
+func (rules Rules) validateComment(c storage.Comment) []FieldError {
+	errs := rules.checkText("Content", c.Content, rules.MaxCommentLen)
+	if c.ParentID < 0 {
+		errs = append(errs, FieldError{Field: "ParentID", Message: "must not be negative"})
+	}
+	switch {
+	case c.AuthorID <= 0:
+		errs = append(errs, FieldError{Field: "AuthorID", Message: "must be a positive integer"})
+	case rules.Authors != nil:
+		_, err := rules.Authors.Author(c.AuthorID)
+		if errors.Is(err, storage.ErrEntryNotExist) {
+			errs = append(errs, FieldError{Field: "AuthorID", Message: fmt.Sprintf("author %d does not exist", c.AuthorID)})
+		}
+	}
+	return errs
+}
+
+// validateCommentUpdate проверяет комментарий перед изменением.
+func (rules Rules) validateCommentUpdate(c storage.Comment) []FieldError {
+	return append(rules.validateCommentID(c), rules.checkText("Content", c.Content, rules.MaxCommentLen)...)
+}
+
+// validateCommentID проверяет идентификатор комментария.
+func (rules Rules) validateCommentID(c storage.Comment) []FieldError {
+	if c.ID <= 0 {
+		return []FieldError{{Field: "ID", Message: "must be a positive integer"}}
+	}
+	return nil
+}
+
+// checkTags проверяет метки публикации.
+func (rules Rules) checkTags(tags []string) []FieldError {
+	if rules.MaxTags > 0 && len(storage.NormalizeTags(tags)) > rules.MaxTags {
+		return []FieldError{{Field: "Tags", Message: fmt.Sprintf("must not have more than %d tags", rules.MaxTags)}}
+	}
+	for _, t := range tags {
+		if errs := rules.checkTag("Tags", t); errs != nil {
+			return errs
+		}
+	}
+	return nil
+}
+
+// checkTag проверяет имя метки. Запятые не допускаются,
+// поскольку ими разделяются метки в CSV.
+func (rules Rules) checkTag(field, name string) []FieldError {
+	if errs := rules.checkText(field, name, rules.MaxTagLen); errs != nil {
+		return errs
+	}
+	bad := strings.IndexFunc(name, func(r rune) bool {
+		return r == ',' || unicode.IsControl(r)
+	})
+	if bad >= 0 {
+		return []FieldError{{Field: field, Message: "must not contain commas or control characters"}}
+	}
+	return nil
+}
+
+func (rules Rules) checkText(field, s string, max int) []FieldError {
+	if strings.TrimSpace(s) == "" {
+		return []FieldError{{Field: field, Message: "must not be empty"}}
+	}
+	if max > 0 && utf8.RuneCountInString(s) > max {
+		return []FieldError{{Field: field, Message: fmt.Sprintf("must not be longer than %d characters", max)}}
+	}
+	return nil
+}
+
+// decodePost читает публикацию из тела запроса.
+// Если публикацию прочитать не удалось, ответ клиенту уже отправлен.
+func (api *API) decodePost(w http.ResponseWriter, r *http.Request) (storage.Post, bool) {
+	var p storage.Post
+	ok := api.decodeJSON(w, r, &p)
+	return p, ok
+}
+
+// decodeAuthor читает автора из тела запроса.
+// Если автора прочитать не удалось, ответ клиенту уже отправлен.
+func (api *API) decodeAuthor(w http.ResponseWriter, r *http.Request) (storage.Author, bool) {
+	var a storage.Author
+	ok := api.decodeJSON(w, r, &a)
+	return a, ok
+}
+
+// decodeTag читает метку из тела запроса.
+// Если метку прочитать не удалось, ответ клиенту уже отправлен.
+func (api *API) decodeTag(w http.ResponseWriter, r *http.Request) (storage.Tag, bool) {
+	var t storage.Tag
+	ok := api.decodeJSON(w, r, &t)
+	return t, ok
+}
+
+// decodeComment читает комментарий из тела запроса.
+// Если комментарий прочитать не удалось, ответ клиенту уже отправлен.
+func (api *API) decodeComment(w http.ResponseWriter, r *http.Request) (storage.Comment, bool) {
+	var c storage.Comment
+	ok := api.decodeJSON(w, r, &c)
+	return c, ok
+}
+
+// decodeJSON читает JSON-объект из тела запроса в v.
+// Неизвестные поля и данные после JSON-объекта считаются ошибкой.
+func (api *API) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body := r.Body
+	if api.rules.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, api.rules.MaxBodyBytes)
+	}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		_, err = dec.Token()
+		if err == io.EOF {
+			err = nil
+		} else {
+			err = errors.New("unexpected data after JSON object")
+		}
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return false
+	}
+
+	return true
+}
+
+// invalid отправляет клиенту ошибки проверки, если они есть.
+func invalid(w http.ResponseWriter, errs []FieldError) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(validationErrors{Errors: errs})
+	return true
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"GoNews/pkg/storage"
+)
+
+type authorsStub map[int]string
+
+func (a authorsStub) Author(id int) (storage.Author, error) {
+	name, ok := a[id]
+	if !ok {
+		return storage.Author{}, storage.ErrEntryNotExist
+	}
+	return storage.Author{ID: id, Name: name}, nil
+}
+
+func fields(errs []FieldError) []string {
+	var res []string
+	for _, e := range errs {
+		res = append(res, e.Field)
+	}
+	return res
+}
+
+func TestRules_ValidateNew(t *testing.T) {
+	rules := DefaultRules()
+	rules.MaxTitleLen = 5
+	rules.Authors = authorsStub{1: "Mark"}
+
+	valid := storage.Post{Title: "Title", Content: "Text", AuthorID: 1, CreatedAt: 10, PublishedAt: 20}
+
+	tests := []struct {
+		name   string
+		modify func(p *storage.Post)
+		want   []string
+	}{
+		{"valid", func(p *storage.Post) {}, nil},
+		{"empty title", func(p *storage.Post) { p.Title = "  " }, []string{"Title"}},
+		{"long title", func(p *storage.Post) { p.Title = "Заголовок" }, []string{"Title"}},
+		{"empty content", func(p *storage.Post) { p.Content = "" }, []string{"Content"}},
+		{"negative timestamps", func(p *storage.Post) { p.CreatedAt, p.PublishedAt = -1, -1 }, []string{"CreatedAt", "PublishedAt"}},
+		{"published before created", func(p *storage.Post) { p.PublishedAt = 5 }, []string{"PublishedAt"}},
+		{"no author", func(p *storage.Post) { p.AuthorID = 0 }, []string{"AuthorID"}},
+		{"unknown author", func(p *storage.Post) { p.AuthorID = 42 }, []string{"AuthorID"}},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.modify(&p)
+		got := fields(rules.ValidateNew(p))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected errors in fields %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAPI_decodePost(t *testing.T) {
+	api := New(nil, WithRules(Rules{MaxBodyBytes: 64}))
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid", `{"ID": 1}`, http.StatusOK},
+		{"malformed", `{"ID": `, http.StatusBadRequest},
+		{"unknown field", `{"ID": 1, "Extra": true}`, http.StatusBadRequest},
+		{"trailing data", `{"ID": 1} {"ID": 2}`, http.StatusBadRequest},
+		{"too large", `{"Title": "` + strings.Repeat("a", 100) + `"}`, http.StatusRequestEntityTooLarge},
+		{"invalid", `{"ID": -1}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/posts", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		p, ok := api.decodePost(rr, req)
+		if ok && !invalid(rr, api.rules.validateID(p)) {
+			rr.WriteHeader(http.StatusOK)
+		}
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/webhook"
+)
+
+// WithWebhooks включает управление подписками на события
+// через /webhooks. Подписками управляют только администраторы,
+// поэтому без аутентификации обработчики не регистрируются.
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(api *API) {
+		api.webhooks = d
+	}
+}
+
+// webhookEndpoints регистрирует обработчики подписок.
+func (api *API) webhookEndpoints() {
+	api.router.HandleFunc("/webhooks", api.webhooksHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/webhooks", api.addWebhookHandler).Methods(http.MethodPost)
+	api.router.HandleFunc("/webhooks/{id:[0-9]+}", api.deleteWebhookHandler).Methods(http.MethodDelete)
+	api.router.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", api.deliveriesHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/webhooks/dead-letters", api.deadLettersHandler).Methods(http.MethodGet)
+	api.router.HandleFunc("/webhooks/dead-letters/{id:[0-9]+}/retry", api.redeliverHandler).Methods(http.MethodPost)
+}
+
+// admin проверяет, что клиент - администратор.
+// При отказе ответ клиенту уже отправлен.
+func (api *API) admin(w http.ResponseWriter, r *http.Request) bool {
+	id, ok := IdentityFrom(r.Context())
+	if !ok {
+		unauthorized(w, ErrNoCredentials)
+		return false
+	}
+	if roleRank[id.Role] < roleRank[RoleAdmin] {
+		writeError(w, forbidden("only admins may manage webhooks"))
+		return false
+	}
+	return true
+}
+
+// validateWebhook проверяет подписку.
+func validateWebhook(s webhook.Subscription) []FieldError {
+	var errs []FieldError
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, FieldError{Field: "url", Message: "must be an absolute http or https URL"})
+	}
+	for _, e := range s.Events {
+		if !knownEvent(e) {
+			errs = append(errs, FieldError{Field: "events", Message: "unknown event type " + strconv.Quote(e)})
+		}
+	}
+	return errs
+}
+
+func knownEvent(typ string) bool {
+	for _, t := range storage.EventTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON отправляет клиенту v в формате JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Получение подписок.
+func (api *API) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, api.webhooks.Subscriptions())
+}
+
+// Создание подписки. Ключ подписи возвращается только в этом ответе.
+func (api *API) addWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	var s webhook.Subscription
+	if !api.decodeJSON(w, r, &s) || invalid(w, validateWebhook(s)) {
+		return
+	}
+	// Подписка не должна превращать сервер в прокси во внутреннюю сеть.
+	err := api.webhooks.CheckURL(r.Context(), s.URL)
+	if errors.Is(err, webhook.ErrPrivateTarget) {
+		invalid(w, []FieldError{{Field: "url", Message: "must not point to a loopback, private or link-local address"}})
+		return
+	}
+	if err != nil {
+		invalid(w, []FieldError{{Field: "url", Message: "must be an absolute http or https URL"}})
+		return
+	}
+	s, err = api.webhooks.Add(s)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s)
+}
+
+// Удаление подписки.
+func (api *API) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	err := api.webhooks.Delete(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Получение журнала доставки подписки.
+func (api *API) deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	list, err := api.webhooks.Deliveries(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Получение недоставленных событий.
+func (api *API) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, api.webhooks.DeadLetters())
+}
+
+// Повторная доставка недоставленного события.
+func (api *API) redeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !api.admin(w, r) {
+		return
+	}
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	err := api.webhooks.Redeliver(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
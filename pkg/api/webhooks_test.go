@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+	"GoNews/pkg/webhook"
+)
+
+func newDispatcher(t *testing.T) *webhook.Dispatcher {
+	t.Helper()
+	conf := webhook.DefaultConfig()
+	conf.Backoff = time.Millisecond
+	conf.AllowPrivate = true
+	d, err := webhook.New(conf)
+	if err != nil {
+		t.Fatalf("unexpected error creating dispatcher: %v", err)
+	}
+	return d
+}
+
+func serveJSON(t *testing.T, api *API, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if len(header) == 2 {
+		req.Header.Set(header[0], header[1])
+	}
+	rr := httptest.NewRecorder()
+	api.Router().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAPI_webhooks(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- b
+	}))
+	defer partner.Close()
+
+	db := memdb.New()
+	bus := storage.NewBus(storage.DefaultBusHistory)
+	db.SetBus(bus)
+	d := newDispatcher(t)
+	d.Run(bus)
+	defer d.Close()
+	api := New(db, WithWebhooks(d), WithAuth(NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "key-admin", AuthorID: 1, Role: RoleAdmin})))
+	serveJSON := func(t *testing.T, api *API, method, path, body string) *httptest.ResponseRecorder {
+		return serveJSON(t, api, method, path, body, "X-API-Key", "key-admin")
+	}
+
+	rr := serveJSON(t, api, http.MethodPost, "/webhooks", `{"url": "ftp://example.com", "events": ["edited"]}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	var verr validationErrors
+	json.Unmarshal(rr.Body.Bytes(), &verr)
+	if len(verr.Errors) != 2 {
+		t.Errorf("expected 2 field errors, got %+v", verr.Errors)
+	}
+
+	rr = serveJSON(t, api, http.MethodPost, "/webhooks", `{"url": "`+partner.URL+`", "events": ["created"]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var sub webhook.Subscription
+	json.Unmarshal(rr.Body.Bytes(), &sub)
+	if sub.ID != 1 || sub.Secret == "" {
+		t.Fatalf("expected subscription 1 with a secret, got %+v", sub)
+	}
+
+	rr = serveJSON(t, api, http.MethodGet, "/webhooks", "")
+	if strings.Contains(rr.Body.String(), sub.Secret) {
+		t.Errorf("expected secret to be hidden, got %s", rr.Body.String())
+	}
+
+	db.AddAuthor(storage.Author{Name: "Mark"})
+	err := db.AddPost(storage.Post{Title: "Title", Content: "Text", AuthorID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected webhook delivery")
+	}
+	body := <-bodies
+	if !webhook.Verify(sub.Secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body) {
+		t.Errorf("expected valid signature for %s", body)
+	}
+	var e storage.Event
+	json.Unmarshal(body, &e)
+	if e.Type != storage.EventCreated || e.Post.Title != "Title" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	var deliveries []webhook.Delivery
+	for i := 0; i < 100 && len(deliveries) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		rr = serveJSON(t, api, http.MethodGet, "/webhooks/1/deliveries", "")
+		json.Unmarshal(rr.Body.Bytes(), &deliveries)
+	}
+	if len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusOK || deliveries[0].EventID != e.ID {
+		t.Errorf("unexpected deliveries %+v", deliveries)
+	}
+
+	if rr = serveJSON(t, api, http.MethodDelete, "/webhooks/1", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr = serveJSON(t, api, http.MethodGet, "/webhooks/1/deliveries", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr = serveJSON(t, api, http.MethodPost, "/webhooks/dead-letters/1/retry", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestAPI_webhooksAuth(t *testing.T) {
+	api := New(memdb.New(), WithWebhooks(newDispatcher(t)), WithAuth(NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "key-editor", AuthorID: 1, Role: RoleEditor},
+		APIKey{Key: "key-admin", AuthorID: 2, Role: RoleAdmin})))
+
+	tests := []struct {
+		method, path, key string
+		want              int
+	}{
+		{http.MethodGet, "/webhooks", "", http.StatusUnauthorized},
+		{http.MethodGet, "/webhooks/dead-letters", "", http.StatusUnauthorized},
+		{http.MethodGet, "/webhooks", "key-editor", http.StatusForbidden},
+		{http.MethodPost, "/webhooks", "key-editor", http.StatusForbidden},
+		{http.MethodGet, "/webhooks", "key-admin", http.StatusOK},
+		{http.MethodPost, "/webhooks", "key-admin", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		var header []string
+		if tt.key != "" {
+			header = []string{"X-API-Key", tt.key}
+		}
+		rr := serveJSON(t, api, tt.method, tt.path, `{"url": "https://example.com/hook"}`, header...)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s with key %q: expected status %d, got %d", tt.method, tt.path, tt.key, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestAPI_webhooksPrivateTargets(t *testing.T) {
+	d, err := webhook.New(webhook.DefaultConfig())
+	if err != nil {
+		t.Fatalf("unexpected error creating dispatcher: %v", err)
+	}
+	api := New(memdb.New(), WithWebhooks(d), WithAuth(NewAuth([]byte("secret"), time.Hour,
+		APIKey{Key: "key-admin", AuthorID: 1, Role: RoleAdmin})))
+
+	for _, target := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+	} {
+		rr := serveJSON(t, api, http.MethodPost, "/webhooks", `{"url": "`+target+`"}`, "X-API-Key", "key-admin")
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusUnprocessableEntity, rr.Code)
+		}
+	}
+}
+
+func TestAPI_webhooksWithoutAuth(t *testing.T) {
+	api := New(memdb.New(), WithWebhooks(newDispatcher(t)))
+	rr := serveJSON(t, api, http.MethodPost, "/webhooks", `{"url": "https://example.com/hook"}`)
+	if rr.Code == http.StatusCreated {
+		t.Errorf("expected webhooks to be unavailable without authentication, got status %d", rr.Code)
+	}
+}
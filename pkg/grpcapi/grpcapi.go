@@ -0,0 +1,362 @@
+// Package grpcapi реализует gRPC API публикаций поверх того же
+// хранилища, что и REST API. Правила проверки, аутентификация
+// и права клиентов совпадают с REST API.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"GoNews/pkg/api"
+	"GoNews/pkg/grpcapi/pb"
+	"GoNews/pkg/storage"
+)
+
+// DefaultPageSize - число публикаций, которое StreamPosts
+// читает из хранилища за один запрос.
+const DefaultPageSize = 100
+
+// Server - служба публикаций gRPC.
+type Server struct {
+	pb.UnimplementedPostsServer
+
+	db       storage.Interface
+	rules    api.Rules
+	auth     *api.Auth
+	pageSize int
+}
+
+// Option настраивает Server.
+type Option func(*Server)
+
+// WithRules задаёт правила проверки входящих публикаций.
+func WithRules(rules api.Rules) Option {
+	return func(s *Server) {
+		s.rules = rules
+	}
+}
+
+// WithAuth включает аутентификацию. Учётные данные передаются
+// в метаданных x-api-key или authorization, как заголовки REST API.
+func WithAuth(a *api.Auth) Option {
+	return func(s *Server) {
+		s.auth = a
+	}
+}
+
+// WithPageSize задаёт размер частей, которыми StreamPosts
+// читает хранилище. При n <= 0 используется DefaultPageSize.
+func WithPageSize(n int) Option {
+	return func(s *Server) {
+		if n <= 0 {
+			n = DefaultPageSize
+		}
+		s.pageSize = n
+	}
+}
+
+// New создаёт службу публикаций.
+func New(db storage.Interface, opts ...Option) *Server {
+	s := &Server{
+		db:       db,
+		rules:    api.DefaultRules(),
+		pageSize: DefaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GRPC создаёт сервер gRPC с зарегистрированной службой публикаций.
+func (s *Server) GRPC(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryAuth),
+		grpc.ChainStreamInterceptor(s.streamAuth),
+	)
+	gs := grpc.NewServer(opts...)
+	pb.RegisterPostsServer(gs, s)
+	return gs
+}
+
+// writeMethods - методы, для которых требуется аутентификация.
+var writeMethods = map[string]bool{
+	pb.Posts_CreatePost_FullMethodName: true,
+	pb.Posts_UpdatePost_FullMethodName: true,
+	pb.Posts_DeletePost_FullMethodName: true,
+}
+
+type ctxKey int
+
+const identityKey ctxKey = iota
+
+// authenticate определяет клиента по метаданным вызова. Чтение
+// допускается анонимно, если учётные данные не переданы.
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := make(http.Header)
+	for k, v := range md {
+		for _, vv := range v {
+			header.Add(k, vv)
+		}
+	}
+	id, err := s.auth.AuthenticateHeader(header)
+	if err == api.ErrNoCredentials && !writeMethods[method] {
+		return ctx, nil
+	}
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, identityKey, id), nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// Потоковые методы только читают данные, поэтому клиента
+	// достаточно проверить, не сохраняя его в контексте.
+	_, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// store возвращает хранилище для обработки вызова, привязанное
+// к нему, чтобы хранилище учитывало срок вызова. Если включена
+// аутентификация, изменения проходят проверку прав клиента.
+func (s *Server) store(ctx context.Context) storage.Interface {
+	db := storage.Bind(s.db, ctx)
+	if s.auth == nil {
+		return db
+	}
+	id, _ := ctx.Value(identityKey).(api.Identity)
+	return api.Restrict(db, id)
+}
+
+// toStatus преобразует ошибку хранилища в статус gRPC.
+func toStatus(err error) error {
+	var fe *api.ForbiddenError
+	switch {
+	case errors.As(err, &fe):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, storage.ErrEntryNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrEntryExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, storage.ErrEntryInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, storage.ErrDBNotResponding), errors.Is(err, storage.ErrConnectDB):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		log.Errorf("grpc: %v", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// invalid возвращает статус InvalidArgument с описанием ошибок в полях.
+func invalid(errs []api.FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	br := &errdetails.BadRequest{}
+	for _, e := range errs {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       e.Field,
+			Description: e.Message,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, "invalid post").WithDetails(br)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid post")
+	}
+	return st.Err()
+}
+
+func toPB(p storage.Post) *pb.Post {
+	return &pb.Post{
+		Id:          int64(p.ID),
+		Title:       p.Title,
+		Content:     p.Content,
+		AuthorId:    int64(p.AuthorID),
+		AuthorName:  p.AuthorName,
+		CreatedAt:   p.CreatedAt,
+		PublishedAt: p.PublishedAt,
+		Tags:        p.Tags,
+	}
+}
+
+func fromPB(p *pb.Post) storage.Post {
+	if p == nil {
+		return storage.Post{}
+	}
+	return storage.Post{
+		ID:          int(p.Id),
+		Title:       p.Title,
+		Content:     p.Content,
+		AuthorID:    int(p.AuthorId),
+		AuthorName:  p.AuthorName,
+		CreatedAt:   p.CreatedAt,
+		PublishedAt: p.PublishedAt,
+		Tags:        p.Tags,
+	}
+}
+
+// filter проверяет условия выборки.
+func filter(req *pb.ListPostsRequest) (storage.Filter, error) {
+	var errs []api.FieldError
+	if req.AuthorId < 0 {
+		errs = append(errs, api.FieldError{Field: "author_id", Message: "must not be negative"})
+	}
+	if req.PublishedUntil < 0 {
+		errs = append(errs, api.FieldError{Field: "published_until", Message: "must not be negative"})
+	}
+	if req.Offset < 0 {
+		errs = append(errs, api.FieldError{Field: "offset", Message: "must not be negative"})
+	}
+	if req.Limit < 0 {
+		errs = append(errs, api.FieldError{Field: "limit", Message: "must not be negative"})
+	}
+	f := storage.Filter{
+		AuthorID:       int(req.AuthorId),
+		PublishedUntil: req.PublishedUntil,
+		Offset:         int(req.Offset),
+		Limit:          int(req.Limit),
+		Tags:           storage.NormalizeTags(req.Tags),
+	}
+	return f, invalid(errs)
+}
+
+// ListPosts возвращает выборку публикаций одним ответом.
+func (s *Server) ListPosts(ctx context.Context, req *pb.ListPostsRequest) (*pb.ListPostsResponse, error) {
+	f, err := filter(req)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := s.store(ctx).FilterPosts(f)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.ListPostsResponse{}
+	for _, p := range posts {
+		resp.Posts = append(resp.Posts, toPB(p))
+	}
+	return resp, nil
+}
+
+// StreamPosts отправляет выборку публикаций потоком, читая
+// хранилище частями по pageSize публикаций.
+func (s *Server) StreamPosts(req *pb.ListPostsRequest, stream pb.Posts_StreamPostsServer) error {
+	f, err := filter(req)
+	if err != nil {
+		return err
+	}
+
+	db := s.store(stream.Context())
+	remaining := f.Limit
+	for {
+		page := f
+		page.Limit = s.pageSize
+		if remaining > 0 && remaining < page.Limit {
+			page.Limit = remaining
+		}
+		posts, err := db.FilterPosts(page)
+		if err != nil {
+			return toStatus(err)
+		}
+		for _, p := range posts {
+			err = stream.Send(toPB(p))
+			if err != nil {
+				return err
+			}
+		}
+		// Пустая часть завершает поток, даже если хранилище
+		// не ограничило выборку размером части.
+		if len(posts) == 0 || len(posts) < page.Limit {
+			return nil
+		}
+		f.Offset += len(posts)
+		if remaining > 0 {
+			remaining -= len(posts)
+			if remaining == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+// GetPost возвращает публикацию по ID.
+func (s *Server) GetPost(ctx context.Context, req *pb.GetPostRequest) (*pb.Post, error) {
+	if req.Id <= 0 {
+		return nil, invalid([]api.FieldError{{Field: "id", Message: "must be a positive integer"}})
+	}
+	p, err := s.store(ctx).Post(int(req.Id))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toPB(p), nil
+}
+
+// CreatePost создаёт публикацию.
+func (s *Server) CreatePost(ctx context.Context, req *pb.CreatePostRequest) (*emptypb.Empty, error) {
+	p := fromPB(req.Post)
+	// Автором публикации становится аутентифицированный клиент.
+	if id, ok := ctx.Value(identityKey).(api.Identity); ok {
+		p.AuthorID = id.AuthorID
+	}
+	if err := invalid(s.rules.ValidateNew(p)); err != nil {
+		return nil, err
+	}
+	err := s.store(ctx).AddPost(p)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Infof("grpc: post %q added", p.Title)
+	return &emptypb.Empty{}, nil
+}
+
+// UpdatePost обновляет публикацию.
+func (s *Server) UpdatePost(ctx context.Context, req *pb.UpdatePostRequest) (*emptypb.Empty, error) {
+	p := fromPB(req.Post)
+	if err := invalid(s.rules.ValidateUpdate(p)); err != nil {
+		return nil, err
+	}
+	err := s.store(ctx).UpdatePost(p)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Infof("grpc: post ID:%v updated", p.ID)
+	return &emptypb.Empty{}, nil
+}
+
+// DeletePost удаляет публикацию по ID.
+func (s *Server) DeletePost(ctx context.Context, req *pb.DeletePostRequest) (*emptypb.Empty, error) {
+	if req.Id <= 0 {
+		return nil, invalid([]api.FieldError{{Field: "id", Message: "must be a positive integer"}})
+	}
+	err := s.store(ctx).DeletePost(storage.Post{ID: int(req.Id)})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	log.Infof("grpc: post ID:%v deleted", req.Id)
+	return &emptypb.Empty{}, nil
+}
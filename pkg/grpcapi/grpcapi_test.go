@@ -0,0 +1,214 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"GoNews/pkg/api"
+	"GoNews/pkg/grpcapi/pb"
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+// client starts the service on an in-memory listener.
+func client(t *testing.T, s *Server) pb.PostsClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := s.GRPC()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewPostsClient(conn)
+}
+
+func testDB(t *testing.T) *memdb.Store {
+	t.Helper()
+	db := memdb.New()
+	for _, tp := range storage.TestPosts {
+		err := db.AddPost(tp)
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+	return db
+}
+
+func TestServer_posts(t *testing.T) {
+	c := client(t, New(testDB(t)))
+	ctx := context.Background()
+
+	p, err := c.GetPost(ctx, &pb.GetPostRequest{Id: 2})
+	if err != nil || p.Title != "Post 2" {
+		t.Errorf("expected post 2, got %v, error %v", p, err)
+	}
+	_, err = c.GetPost(ctx, &pb.GetPostRequest{Id: 42})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected code %v, got %v", codes.NotFound, err)
+	}
+
+	_, err = c.CreatePost(ctx, &pb.CreatePostRequest{Post: &pb.Post{Title: "New", Content: "Text", AuthorId: 1}})
+	if err != nil {
+		t.Fatalf("unexpected error creating post: %v", err)
+	}
+	_, err = c.UpdatePost(ctx, &pb.UpdatePostRequest{Post: &pb.Post{Id: 42, Title: "New", Content: "Text", AuthorId: 1}})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected code %v, got %v", codes.NotFound, err)
+	}
+	_, err = c.DeletePost(ctx, &pb.DeletePostRequest{Id: 1})
+	if err != nil {
+		t.Errorf("unexpected error deleting post: %v", err)
+	}
+
+	resp, err := c.ListPosts(ctx, &pb.ListPostsRequest{AuthorId: 1})
+	// Drafts have no publication time and come last.
+	if err != nil || len(resp.Posts) != 2 || resp.Posts[1].Title != "New" {
+		t.Errorf("expected the new draft after the post of author 1, got %v, error %v", resp, err)
+	}
+
+	_, err = c.UpdatePost(ctx, &pb.UpdatePostRequest{Post: &pb.Post{Id: 2, Title: "Post 2", Content: "Text", AuthorId: 2, Tags: []string{"Sport"}}})
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	resp, err = c.ListPosts(ctx, &pb.ListPostsRequest{Tags: []string{"sport"}})
+	if err != nil || len(resp.Posts) != 1 || resp.Posts[0].Id != 2 || len(resp.Posts[0].Tags) != 1 || resp.Posts[0].Tags[0] != "sport" {
+		t.Errorf("expected post 2 tagged sport, got %v, error %v", resp, err)
+	}
+}
+
+func TestServer_invalid(t *testing.T) {
+	c := client(t, New(testDB(t)))
+
+	_, err := c.CreatePost(context.Background(), &pb.CreatePostRequest{Post: &pb.Post{Content: "Text"}})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected code %v, got %v", codes.InvalidArgument, err)
+	}
+	var fields []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "Title" || fields[1] != "AuthorID" {
+		t.Errorf("expected violations of Title and AuthorID, got %v", fields)
+	}
+}
+
+func TestServer_StreamPosts(t *testing.T) {
+	tests := []struct {
+		req  *pb.ListPostsRequest
+		want []int64
+	}{
+		{&pb.ListPostsRequest{}, []int64{5, 4, 3, 2, 1}},
+		{&pb.ListPostsRequest{Offset: 1, Limit: 3}, []int64{4, 3, 2}},
+		{&pb.ListPostsRequest{Limit: 4}, []int64{5, 4, 3, 2}},
+		{&pb.ListPostsRequest{AuthorId: 2}, []int64{5, 2}},
+	}
+	// The page size is smaller than the listing to exercise paging;
+	// sizes below 1 fall back to the default.
+	for _, size := range []int{2, 0, -1} {
+		c := client(t, New(testDB(t), WithPageSize(size)))
+		for _, tt := range tests {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			stream, err := c.StreamPosts(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []int64
+			for {
+				p, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("page size %d: unexpected error receiving: %v", size, err)
+				}
+				got = append(got, p.Id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("page size %d, %v: expected IDs %v, got %v", size, tt.req, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestServer_auth(t *testing.T) {
+	auth := api.NewAuth([]byte("secret"), time.Hour, api.APIKey{Key: "key-tom", AuthorID: 2})
+	c := client(t, New(testDB(t), WithAuth(auth)))
+	ctx := context.Background()
+	tom := metadata.AppendToOutgoingContext(ctx, "x-api-key", "key-tom")
+
+	if _, err := c.GetPost(ctx, &pb.GetPostRequest{Id: 1}); err != nil {
+		t.Errorf("unexpected error reading anonymously: %v", err)
+	}
+
+	post := &pb.Post{Title: "New", Content: "Text", AuthorId: 1}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		call func(context.Context) error
+		want codes.Code
+	}{
+		{"anonymous create", ctx, func(ctx context.Context) error {
+			_, err := c.CreatePost(ctx, &pb.CreatePostRequest{Post: post})
+			return err
+		}, codes.Unauthenticated},
+		{"bad key", metadata.AppendToOutgoingContext(ctx, "x-api-key", "nope"), func(ctx context.Context) error {
+			_, err := c.CreatePost(ctx, &pb.CreatePostRequest{Post: post})
+			return err
+		}, codes.Unauthenticated},
+		{"author creates", tom, func(ctx context.Context) error {
+			_, err := c.CreatePost(ctx, &pb.CreatePostRequest{Post: post})
+			return err
+		}, codes.OK},
+		{"author edits foreign post", tom, func(ctx context.Context) error {
+			_, err := c.UpdatePost(ctx, &pb.UpdatePostRequest{Post: &pb.Post{Id: 1, Title: "T", Content: "C", AuthorId: 1}})
+			return err
+		}, codes.PermissionDenied},
+		{"author deletes", tom, func(ctx context.Context) error {
+			_, err := c.DeletePost(ctx, &pb.DeletePostRequest{Id: 2})
+			return err
+		}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		if got := status.Code(tt.call(tt.ctx)); got != tt.want {
+			t.Errorf("%s: expected code %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// The created post belongs to the authenticated author.
+	resp, err := c.ListPosts(ctx, &pb.ListPostsRequest{Offset: int32(len(storage.TestPosts))})
+	if err != nil || len(resp.Posts) != 1 || resp.Posts[0].AuthorId != 2 {
+		t.Errorf("expected the new post of author 2, got %v, error %v", resp, err)
+	}
+}
+
+func init() {
+	log.SetOutput(io.Discard)
+}
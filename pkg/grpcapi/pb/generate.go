@@ -0,0 +1,5 @@
+// Package pb содержит сообщения и службу gRPC API, сгенерированные
+// по news.proto.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative news.proto
@@ -0,0 +1,570 @@
+// Package boltdb stores posts, authors, tags and comments in an embedded
+// bbolt file: a B+tree with secondary indexes that keep filtered and
+// ordered listings from scanning every post.
+package boltdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"GoNews/pkg/storage"
+)
+
+// Buckets. Posts, authors and comments are keyed by ID, tags by name
+// with empty values. The index buckets hold empty values under composite
+// keys, so that a cursor walks them in the order of storage.Filter:
+//
+//	byPublished: published_at | id
+//	byAuthor:    author_id | published_at | id
+//	byTag:       name | 0 | published_at | id
+//
+// and comments in the order they were added:
+//
+//	commentsByPost:   post_id | comment id
+//	commentsByParent: parent_id | comment id
+//
+// All numbers are big-endian uint64, which sorts them numerically.
+var (
+	postsBucket       = []byte("posts")
+	authorsBucket     = []byte("authors")
+	tagsBucket        = []byte("tags")
+	byPublishedBucket = []byte("posts_by_published")
+	byAuthorBucket    = []byte("posts_by_author")
+	byTagBucket       = []byte("posts_by_tag")
+
+	commentsBucket         = []byte("comments")
+	commentsByPostBucket   = []byte("comments_by_post")
+	commentsByParentBucket = []byte("comments_by_parent")
+	commentsByAuthorBucket = []byte("comments_by_author")
+)
+
+type Store struct {
+	db  *bolt.DB
+	bus *storage.Bus
+}
+
+// New opens the database file at path, creating it if needed.
+// It fails if another process holds the file for more than a second.
+func New(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		// Files created before the index have comments to add to it.
+		indexAuthors := tx.Bucket(commentsByAuthorBucket) == nil
+		buckets := [][]byte{
+			postsBucket, authorsBucket, tagsBucket, byPublishedBucket, byAuthorBucket, byTagBucket,
+			commentsBucket, commentsByPostBucket, commentsByParentBucket, commentsByAuthorBucket,
+		}
+		for _, name := range buckets {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		if indexAuthors {
+			return indexCommentAuthors(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+// SetBus sets the bus post changes are published to.
+// It must be called before the store is used.
+func (s *Store) SetBus(bus *storage.Bus) {
+	s.bus = bus
+}
+
+// key encodes the numbers as a composite key.
+func key(nums ...int64) []byte {
+	k := make([]byte, 8*len(nums))
+	for i, n := range nums {
+		binary.BigEndian.PutUint64(k[8*i:], uint64(n))
+	}
+	return k
+}
+
+// lastID returns the trailing post ID of an index key.
+func lastID(k []byte) int {
+	return int(binary.BigEndian.Uint64(k[len(k)-8:]))
+}
+
+func publishedKey(p storage.Post) []byte {
+	return key(p.PublishedAt, int64(p.ID))
+}
+
+func authorKey(p storage.Post) []byte {
+	return key(int64(p.AuthorID), p.PublishedAt, int64(p.ID))
+}
+
+// tagPrefix is the prefix of the byTag keys of the tag. The zero byte
+// keeps a tag apart from the longer tags it is a prefix of.
+func tagPrefix(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+func tagKey(name string, p storage.Post) []byte {
+	return append(tagPrefix(name), publishedKey(p)...)
+}
+
+func getPost(tx *bolt.Tx, id int) (storage.Post, error) {
+	var p storage.Post
+	v := tx.Bucket(postsBucket).Get(key(int64(id)))
+	if v == nil {
+		return p, storage.ErrEntryNotExist
+	}
+	err := json.Unmarshal(v, &p)
+	return p, err
+}
+
+// putPost writes the post and its index entries
+// and creates the missing tags of the post.
+func putPost(tx *bolt.Tx, p storage.Post) error {
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(postsBucket).Put(key(int64(p.ID)), v)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(byPublishedBucket).Put(publishedKey(p), nil)
+	if err != nil {
+		return err
+	}
+	for _, t := range p.Tags {
+		err = tx.Bucket(tagsBucket).Put([]byte(t), nil)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(byTagBucket).Put(tagKey(t, p), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(byAuthorBucket).Put(authorKey(p), nil)
+}
+
+// deletePost removes the post and its index entries.
+func deletePost(tx *bolt.Tx, p storage.Post) error {
+	err := tx.Bucket(postsBucket).Delete(key(int64(p.ID)))
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(byPublishedBucket).Delete(publishedKey(p))
+	if err != nil {
+		return err
+	}
+	for _, t := range p.Tags {
+		err = tx.Bucket(byTagBucket).Delete(tagKey(t, p))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(byAuthorBucket).Delete(authorKey(p))
+}
+
+// assignID gives an entry with zero ID the next ID of the bucket and
+// keeps the sequence ahead of explicitly set IDs.
+func assignID(b *bolt.Bucket, id int) (int, error) {
+	if id == 0 {
+		seq, err := b.NextSequence()
+		return int(seq), err
+	}
+	if uint64(id) > b.Sequence() {
+		return id, b.SetSequence(uint64(id))
+	}
+	return id, nil
+}
+
+// AddPost adds the post. A post with zero ID gets the next free ID.
+func (s *Store) AddPost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(postsBucket)
+		if post.ID != 0 && b.Get(key(int64(post.ID))) != nil {
+			return storage.ErrEntryExists
+		}
+		id, err := assignID(b, post.ID)
+		if err != nil {
+			return err
+		}
+		post.ID = id
+		return putPost(tx, post)
+	})
+	if err == storage.ErrEntryExists {
+		log.Errorf("error adding post: post with ID %v already exists", post.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	for _, typ := range storage.CreateEvents(post) {
+		s.bus.Publish(typ, post)
+	}
+
+	log.Infof("post ID:%v added successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Posts() ([]storage.Post, error) {
+	var posts []storage.Post
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(postsBucket).ForEach(func(_, v []byte) error {
+			var p storage.Post
+			err := json.Unmarshal(v, &p)
+			if err != nil {
+				return err
+			}
+			posts = append(posts, p)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+
+	log.Infof("retrieved %d posts", len(posts))
+	return posts, nil
+}
+
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		p, err = getPost(tx, id)
+		return err
+	})
+	if err != nil && err != storage.ErrEntryNotExist {
+		log.Errorf("error requesting post: %v", err)
+	}
+	return p, err
+}
+
+// FilterPosts walks an index backwards from the newest matching entry,
+// so it reads only the posts it skips by offset or returns. A filter by
+// tags walks the index of the first tag and checks the rest of the
+// filter on the posts themselves.
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	f.Tags = storage.NormalizeTags(f.Tags)
+	// The index, the range of keys within it and the key past
+	// the newest entry to return; nil is past the index end.
+	bucket, prefix, end := byPublishedBucket, []byte(nil), []byte(nil)
+	switch {
+	case len(f.Tags) > 0:
+		bucket, prefix = byTagBucket, tagPrefix(f.Tags[0])
+		end = append([]byte(f.Tags[0]), 1)
+	case f.AuthorID != 0:
+		bucket, prefix = byAuthorBucket, key(int64(f.AuthorID))
+		end = key(int64(f.AuthorID) + 1)
+	}
+	if f.PublishedUntil != 0 {
+		end = append(append([]byte(nil), prefix...), key(f.PublishedUntil+1)...)
+	}
+
+	var posts []storage.Post
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		var k []byte
+		if end != nil {
+			k, _ = c.Seek(end)
+		}
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+		skip := f.Offset
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+			// Drafts come last; they never match PublishedUntil.
+			published := int64(binary.BigEndian.Uint64(k[len(prefix):]))
+			if f.PublishedUntil != 0 && published == 0 {
+				break
+			}
+			var p storage.Post
+			if len(f.Tags) > 0 {
+				var err error
+				p, err = getPost(tx, lastID(k))
+				if err != nil {
+					return err
+				}
+				if !f.Match(p) {
+					continue
+				}
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(f.Tags) == 0 {
+				var err error
+				p, err = getPost(tx, lastID(k))
+				if err != nil {
+					return err
+				}
+			}
+			posts = append(posts, p)
+			if f.Limit > 0 && len(posts) == f.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *Store) UpdatePost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	var old storage.Post
+	err := s.db.Update(func(tx *bolt.Tx) (err error) {
+		old, err = getPost(tx, post.ID)
+		if err != nil {
+			return err
+		}
+		err = deletePost(tx, old)
+		if err != nil {
+			return err
+		}
+		return putPost(tx, post)
+	})
+	if err == storage.ErrEntryNotExist {
+		log.Errorf("error updating post: post with ID %v not found", post.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.UpdateEvent(old, post), post)
+
+	log.Infof("post ID:%v updated successfully", post.ID)
+	return nil
+}
+
+// DeletePost removes the post together with its comments.
+func (s *Store) DeletePost(post storage.Post) error {
+	var old storage.Post
+	err := s.db.Update(func(tx *bolt.Tx) (err error) {
+		old, err = getPost(tx, post.ID)
+		if err != nil {
+			return err
+		}
+		err = deletePost(tx, old)
+		if err != nil {
+			return err
+		}
+		return deletePostComments(tx, old.ID)
+	})
+	if err == storage.ErrEntryNotExist {
+		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error deleting post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.EventDeleted, old)
+
+	log.Infof("post ID:%v deleted successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	var authors []storage.Author
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(authorsBucket).ForEach(func(_, v []byte) error {
+			var a storage.Author
+			err := json.Unmarshal(v, &a)
+			if err != nil {
+				return err
+			}
+			authors = append(authors, a)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("error requesting authors: %v", err)
+		return nil, err
+	}
+
+	return authors, nil
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(authorsBucket).Get(key(int64(id)))
+		if v == nil {
+			return storage.ErrEntryNotExist
+		}
+		return json.Unmarshal(v, &a)
+	})
+	if err != nil && err != storage.ErrEntryNotExist {
+		log.Errorf("error requesting author: %v", err)
+	}
+	return a, err
+}
+
+// AddAuthor adds the author. An author with zero ID gets the next free ID.
+func (s *Store) AddAuthor(author storage.Author) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(authorsBucket)
+		if author.ID != 0 && b.Get(key(int64(author.ID))) != nil {
+			return storage.ErrEntryExists
+		}
+		id, err := assignID(b, author.ID)
+		if err != nil {
+			return err
+		}
+		author.ID = id
+		v, err := json.Marshal(author)
+		if err != nil {
+			return err
+		}
+		return b.Put(key(int64(author.ID)), v)
+	})
+	if err == storage.ErrEntryExists {
+		log.Errorf("error adding author: author with ID %v already exists", author.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v added successfully", author.ID)
+	return nil
+}
+
+// DeleteAuthor removes the author. Authors of existing posts and
+// comments cannot be removed; the author indexes tell it without a scan.
+func (s *Store) DeleteAuthor(author storage.Author) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(authorsBucket)
+		if b.Get(key(int64(author.ID))) == nil {
+			return storage.ErrEntryNotExist
+		}
+		prefix := key(int64(author.ID))
+		k, _ := tx.Bucket(byAuthorBucket).Cursor().Seek(prefix)
+		if k != nil && bytes.HasPrefix(k, prefix) {
+			return storage.ErrEntryInUse
+		}
+		if hasComments(tx, author.ID) {
+			return storage.ErrEntryInUse
+		}
+		return b.Delete(prefix)
+	})
+	switch err {
+	case nil:
+	case storage.ErrEntryNotExist:
+		log.Errorf("error deleting author: author with ID %v not found", author.ID)
+		return err
+	case storage.ErrEntryInUse:
+		log.Errorf("error deleting author: author ID %v has posts or comments", author.ID)
+		return err
+	default:
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v deleted successfully", author.ID)
+	return nil
+}
+
+// Tags counts the posts of every tag by its index.
+func (s *Store) Tags() ([]storage.Tag, error) {
+	var tags []storage.Tag
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(byTagBucket).Cursor()
+		return tx.Bucket(tagsBucket).ForEach(func(k, _ []byte) error {
+			t := storage.Tag{Name: string(k)}
+			prefix := tagPrefix(t.Name)
+			for ik, _ := c.Seek(prefix); ik != nil && bytes.HasPrefix(ik, prefix); ik, _ = c.Next() {
+				t.Posts++
+			}
+			tags = append(tags, t)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (s *Store) AddTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tagsBucket)
+		if b.Get([]byte(tag.Name)) != nil {
+			return storage.ErrEntryExists
+		}
+		return b.Put([]byte(tag.Name), nil)
+	})
+	if err == storage.ErrEntryExists {
+		log.Errorf("error adding tag: tag %q already exists", tag.Name)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error adding tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q added successfully", tag.Name)
+	return nil
+}
+
+// DeleteTag removes the tag. Tags of existing posts
+// cannot be removed; the tag index tells it without a scan.
+func (s *Store) DeleteTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tagsBucket)
+		if b.Get([]byte(tag.Name)) == nil {
+			return storage.ErrEntryNotExist
+		}
+		prefix := tagPrefix(tag.Name)
+		k, _ := tx.Bucket(byTagBucket).Cursor().Seek(prefix)
+		if k != nil && bytes.HasPrefix(k, prefix) {
+			return storage.ErrEntryInUse
+		}
+		return b.Delete([]byte(tag.Name))
+	})
+	switch err {
+	case nil:
+	case storage.ErrEntryNotExist:
+		log.Errorf("error deleting tag: tag %q not found", tag.Name)
+		return err
+	case storage.ErrEntryInUse:
+		log.Errorf("error deleting tag: tag %q has posts", tag.Name)
+		return err
+	default:
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q deleted successfully", tag.Name)
+	return nil
+}
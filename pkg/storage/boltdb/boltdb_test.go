@@ -0,0 +1,142 @@
+package boltdb
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/storagetest"
+)
+
+// newStore opens a store in a temporary file with the test authors.
+func newStore(t *testing.T, path string) *Store {
+	t.Helper()
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	for _, a := range storage.TestAuthors {
+		err := db.AddAuthor(a)
+		if err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		return newStore(t, filepath.Join(t.TempDir(), "gonews.db"))
+	})
+}
+
+func TestStore_indexes(t *testing.T) {
+	db := newStore(t, filepath.Join(t.TempDir(), "gonews.db"))
+	for _, tp := range storage.TestPosts {
+		if err := db.AddPost(tp); err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+
+	// Moving a post to another author and time moves its index entries.
+	p := storage.TestPosts[0]
+	p.AuthorID, p.AuthorName, p.PublishedAt = 2, "Tom", storage.TestPosts[4].PublishedAt+1
+	if err := db.UpdatePost(p); err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	if err := db.DeletePost(storage.TestPosts[3]); err != nil {
+		t.Fatalf("unexpected error deleting post: %v", err)
+	}
+
+	count := func(bucket []byte) int {
+		n := 0
+		db.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(bucket).Stats().KeyN
+			return nil
+		})
+		return n
+	}
+	if n, m := count(byPublishedBucket), count(byAuthorBucket); n != 4 || m != 4 {
+		t.Errorf("expected 4 entries in each index, got %d and %d", n, m)
+	}
+
+	got, err := db.FilterPosts(storage.Filter{AuthorID: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []storage.Post{p, storage.TestPosts[4], storage.TestPosts[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	got, _ = db.FilterPosts(storage.Filter{AuthorID: 1})
+	if !reflect.DeepEqual(got, []storage.Post{storage.TestPosts[2]}) {
+		t.Errorf("expected only post 3 of author 1, got %+v", got)
+	}
+}
+
+func TestNew_reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gonews.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	db.AddAuthor(storage.Author{Name: "Mark"})
+	db.AddPost(storage.Post{Title: "First", Content: "Text", AuthorID: 1})
+	db.AddPost(storage.Post{Title: "Second", Content: "Text", AuthorID: 1})
+	db.DeletePost(storage.Post{ID: 2})
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	defer db.Close()
+	// Deleted IDs are not given out again.
+	db.AddPost(storage.Post{Title: "Third", Content: "Text", AuthorID: 1})
+	posts, _ := db.Posts()
+	if len(posts) != 2 || posts[0].Title != "First" || posts[1].ID != 3 {
+		t.Errorf("expected posts 1 and 3 after reopening, got %+v", posts)
+	}
+}
+
+func TestNew_indexesCommentAuthors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gonews.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	db.AddAuthor(storage.Author{Name: "Mark"})
+	db.AddAuthor(storage.Author{Name: "Tom"})
+	db.AddPost(storage.Post{Title: "First", Content: "Text", AuthorID: 1})
+	db.AddComment(storage.Comment{PostID: 1, AuthorID: 2, Content: "Hi"})
+	// A file written before comments were indexed by author.
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(commentsByAuthorBucket)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db.Close()
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	defer db.Close()
+	err = db.DeleteAuthor(storage.Author{ID: 2})
+	if !errors.Is(err, storage.ErrEntryInUse) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryInUse, err)
+	}
+}
+
+func init() {
+	log.SetOutput(io.Discard)
+}
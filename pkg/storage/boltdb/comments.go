@@ -0,0 +1,255 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+
+	"GoNews/pkg/storage"
+)
+
+func getComment(tx *bolt.Tx, id int) (storage.Comment, error) {
+	var c storage.Comment
+	v := tx.Bucket(commentsBucket).Get(key(int64(id)))
+	if v == nil {
+		return c, storage.ErrEntryNotExist
+	}
+	err := json.Unmarshal(v, &c)
+	return c, err
+}
+
+// putComment writes the comment and its index entries.
+func putComment(tx *bolt.Tx, c storage.Comment) error {
+	v, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(commentsBucket).Put(key(int64(c.ID)), v)
+	if err != nil {
+		return err
+	}
+	if c.ParentID != 0 {
+		err = tx.Bucket(commentsByParentBucket).Put(key(int64(c.ParentID), int64(c.ID)), nil)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Bucket(commentsByAuthorBucket).Put(key(int64(c.AuthorID), int64(c.ID)), nil)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(commentsByPostBucket).Put(key(int64(c.PostID), int64(c.ID)), nil)
+}
+
+// deleteComment removes the comment and its index entries.
+func deleteComment(tx *bolt.Tx, c storage.Comment) error {
+	err := tx.Bucket(commentsBucket).Delete(key(int64(c.ID)))
+	if err != nil {
+		return err
+	}
+	if c.ParentID != 0 {
+		err = tx.Bucket(commentsByParentBucket).Delete(key(int64(c.ParentID), int64(c.ID)))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Bucket(commentsByAuthorBucket).Delete(key(int64(c.AuthorID), int64(c.ID)))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(commentsByPostBucket).Delete(key(int64(c.PostID), int64(c.ID)))
+}
+
+// indexCommentAuthors adds the stored comments to the author index.
+func indexCommentAuthors(tx *bolt.Tx) error {
+	b := tx.Bucket(commentsByAuthorBucket)
+	return tx.Bucket(commentsBucket).ForEach(func(_, v []byte) error {
+		var c storage.Comment
+		err := json.Unmarshal(v, &c)
+		if err != nil {
+			return err
+		}
+		return b.Put(key(int64(c.AuthorID), int64(c.ID)), nil)
+	})
+}
+
+// hasComments reports whether the author has written any comments.
+func hasComments(tx *bolt.Tx, authorID int) bool {
+	prefix := key(int64(authorID))
+	k, _ := tx.Bucket(commentsByAuthorBucket).Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// indexedIDs returns the trailing IDs of the index keys with the prefix.
+// They are collected before any deletion, since a bbolt cursor must not
+// walk a bucket that is being changed.
+func indexedIDs(b *bolt.Bucket, prefix []byte) []int {
+	var ids []int
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, lastID(k))
+	}
+	return ids
+}
+
+// deleteThread removes the comment and, recursively, the replies to it.
+func deleteThread(tx *bolt.Tx, c storage.Comment) error {
+	for _, id := range indexedIDs(tx.Bucket(commentsByParentBucket), key(int64(c.ID))) {
+		reply, err := getComment(tx, id)
+		if err != nil {
+			return err
+		}
+		err = deleteThread(tx, reply)
+		if err != nil {
+			return err
+		}
+	}
+	return deleteComment(tx, c)
+}
+
+// deletePostComments removes the comments of the post.
+func deletePostComments(tx *bolt.Tx, postID int) error {
+	for _, id := range indexedIDs(tx.Bucket(commentsByPostBucket), key(int64(postID))) {
+		c, err := getComment(tx, id)
+		if err != nil {
+			return err
+		}
+		err = deleteComment(tx, c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Comments returns the comments of the post by its index,
+// in the order they were added.
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	var comments []storage.Comment
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(postsBucket).Get(key(int64(postID))) == nil {
+			return storage.ErrEntryNotExist
+		}
+		for _, id := range indexedIDs(tx.Bucket(commentsByPostBucket), key(int64(postID))) {
+			c, err := getComment(tx, id)
+			if err != nil {
+				return err
+			}
+			comments = append(comments, c)
+		}
+		return nil
+	})
+	if err != nil && err != storage.ErrEntryNotExist {
+		log.Errorf("error requesting comments: %v", err)
+	}
+	return comments, err
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		c, err = getComment(tx, id)
+		return err
+	})
+	if err != nil && err != storage.ErrEntryNotExist {
+		log.Errorf("error requesting comment: %v", err)
+	}
+	return c, err
+}
+
+// AddComment adds the comment to the post. A comment with zero ID gets
+// the next free ID. A reply must belong to the same post as the comment
+// it answers.
+func (s *Store) AddComment(comment storage.Comment) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(commentsBucket)
+		if comment.ID != 0 && b.Get(key(int64(comment.ID))) != nil {
+			return storage.ErrEntryExists
+		}
+		if tx.Bucket(postsBucket).Get(key(int64(comment.PostID))) == nil {
+			return storage.ErrEntryNotExist
+		}
+		if tx.Bucket(authorsBucket).Get(key(int64(comment.AuthorID))) == nil {
+			return storage.ErrEntryNotExist
+		}
+		if comment.ParentID != 0 {
+			parent, err := getComment(tx, comment.ParentID)
+			if err != nil {
+				return err
+			}
+			if parent.PostID != comment.PostID {
+				return storage.ErrEntryNotExist
+			}
+		}
+		id, err := assignID(b, comment.ID)
+		if err != nil {
+			return err
+		}
+		comment.ID = id
+		return putComment(tx, comment)
+	})
+	switch err {
+	case nil:
+	case storage.ErrEntryExists:
+		log.Errorf("error adding comment: comment with ID %v already exists", comment.ID)
+		return err
+	case storage.ErrEntryNotExist:
+		log.Errorf("error adding comment: post ID %v, comment ID %v or author ID %v not found", comment.PostID, comment.ParentID, comment.AuthorID)
+		return err
+	default:
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v added successfully", comment.ID)
+	return nil
+}
+
+// UpdateComment changes the text of the comment and the time
+// of the change; the other fields stay as they were.
+func (s *Store) UpdateComment(comment storage.Comment) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c, err := getComment(tx, comment.ID)
+		if err != nil {
+			return err
+		}
+		c.Content = comment.Content
+		c.UpdatedAt = comment.UpdatedAt
+		return putComment(tx, c)
+	})
+	if err == storage.ErrEntryNotExist {
+		log.Errorf("error updating comment: comment with ID %v not found", comment.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v updated successfully", comment.ID)
+	return nil
+}
+
+// DeleteComment removes the comment together with the replies to it.
+func (s *Store) DeleteComment(comment storage.Comment) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c, err := getComment(tx, comment.ID)
+		if err != nil {
+			return err
+		}
+		return deleteThread(tx, c)
+	})
+	if err == storage.ErrEntryNotExist {
+		log.Errorf("error deleting comment: comment with ID %v not found", comment.ID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v deleted successfully", comment.ID)
+	return nil
+}
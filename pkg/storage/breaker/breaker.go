@@ -0,0 +1,330 @@
+// Package breaker прекращает обращения к недоступной БД: после серии
+// ошибок операции хранилища сразу завершаются ошибкой, пока пробный
+// запрос не покажет, что БД снова отвечает.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// State - состояние выключателя.
+type State int
+
+const (
+	Closed   State = iota // запросы передаются хранилищу
+	Open                  // запросы сразу завершаются ошибкой
+	HalfOpen              // выполняется пробный запрос
+)
+
+func (st State) String() string {
+	switch st {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(st))
+	}
+}
+
+// ErrOpen возвращается, пока выключатель разомкнут.
+// Является storage.ErrDBNotResponding.
+var ErrOpen = fmt.Errorf("%w: circuit breaker is open", storage.ErrDBNotResponding)
+
+// Config задаёт параметры выключателя.
+type Config struct {
+	Failures    int           // число ошибок подряд, после которого выключатель размыкается
+	OpenTimeout time.Duration // время до пробного запроса
+
+	// Failure сообщает, говорит ли ошибка о неисправности БД.
+	// Если nil, неисправностью считается любая ошибка, кроме
+	// ошибок данных: storage.ErrEntryNotExist и подобных.
+	Failure func(error) bool
+}
+
+// DefaultConfig возвращает параметры выключателя по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		Failures:    5,
+		OpenTimeout: 10 * time.Second,
+	}
+}
+
+// Status - состояние выключателя для проверки работоспособности.
+type Status struct {
+	State     string `json:"state"`
+	Failures  int    `json:"failures"`             // ошибок подряд
+	OpenedAt  int64  `json:"opened_at,omitempty"`  // время размыкания
+	LastError string `json:"last_error,omitempty"` // последняя ошибка БД
+}
+
+// Store пропускает операции к обёрнутому хранилищу,
+// пока выключатель замкнут.
+type Store struct {
+	storage.Interface
+	*circuit
+}
+
+// circuit - выключатель, общий для Store и хранилищ,
+// привязанных к запросам.
+type circuit struct {
+	conf Config
+	now  func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	lastError error
+	// Число размыканий. Операция, начатая до последнего размыкания,
+	// ничего не говорит о текущем состоянии БД.
+	opened int
+}
+
+// New оборачивает хранилище db выключателем.
+func New(db storage.Interface, conf Config) *Store {
+	if conf.Failure == nil {
+		conf.Failure = dbFailure
+	}
+	return &Store{Interface: db, circuit: &circuit{conf: conf, now: time.Now}}
+}
+
+// Bind привязывает к запросу обёрнутое хранилище.
+func (s *Store) Bind(ctx context.Context) storage.Interface {
+	return &Store{Interface: storage.Bind(s.Interface, ctx), circuit: s.circuit}
+}
+
+// dbFailure отличает неисправность БД от ошибок данных.
+func dbFailure(err error) bool {
+	return !errors.Is(err, storage.ErrEntryNotExist) &&
+		!errors.Is(err, storage.ErrEntryExists) &&
+		!errors.Is(err, storage.ErrEntryInUse)
+}
+
+// SetBus передаёт шину событий обёрнутому хранилищу.
+func (s *Store) SetBus(bus *storage.Bus) {
+	if p, ok := s.Interface.(storage.Publisher); ok {
+		p.SetBus(bus)
+	}
+}
+
+// State возвращает состояние выключателя.
+func (s *Store) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current()
+}
+
+// current учитывает истечение времени размыкания: по его
+// окончании выключатель готов пропустить пробный запрос.
+func (s *Store) current() State {
+	if s.state == Open && s.now().Sub(s.openedAt) >= s.conf.OpenTimeout {
+		return HalfOpen
+	}
+	return s.state
+}
+
+// Health сообщает состояние выключателя. Хранилище считается
+// недоступным, пока выключатель разомкнут.
+func (s *Store) Health() (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.current()
+	status := Status{State: st.String(), Failures: s.failures}
+	if st != Closed {
+		status.OpenedAt = s.openedAt.Unix()
+	}
+	if s.lastError != nil {
+		status.LastError = s.lastError.Error()
+	}
+	return status, st != Open
+}
+
+// allow решает, можно ли выполнить операцию, и возвращает число
+// размыканий к её началу. Разомкнутый выключатель по истечении
+// времени пропускает один пробный запрос.
+func (s *Store) allow() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.current() {
+	case Closed:
+		return s.opened, true
+	case HalfOpen:
+		if s.state == Open {
+			s.state = HalfOpen
+			log.Info("circuit breaker is half-open, probing the database")
+			return s.opened, true
+		}
+		// Пробный запрос уже выполняется.
+		return s.opened, false
+	default:
+		return s.opened, false
+	}
+}
+
+// done учитывает результат операции, начатой после opened размыканий.
+// Результаты операций, начатых до последнего размыкания, не учитываются:
+// запоздалый успех не замыкает выключатель, а запоздалая ошибка
+// не продлевает размыкание.
+func (s *Store) done(opened int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if opened != s.opened {
+		return
+	}
+	if err == nil || !s.conf.Failure(err) {
+		switch s.state {
+		case HalfOpen:
+			log.Info("circuit breaker is closed, the database responds")
+			s.state = Closed
+			s.failures = 0
+		case Closed:
+			s.failures = 0
+		}
+		return
+	}
+
+	s.failures++
+	s.lastError = err
+	if s.state == HalfOpen || s.failures >= s.conf.Failures {
+		if s.state != Open {
+			log.Errorf("circuit breaker is open after %d failures: %v", s.failures, err)
+		}
+		s.state = Open
+		s.openedAt = s.now()
+		s.opened++
+	}
+}
+
+// do выполняет операцию, если выключатель замкнут.
+func (s *Store) do(f func() error) error {
+	opened, ok := s.allow()
+	if !ok {
+		return ErrOpen
+	}
+	err := f()
+	s.done(opened, err)
+	return err
+}
+
+func (s *Store) Posts() ([]storage.Post, error) {
+	var posts []storage.Post
+	err := s.do(func() (err error) {
+		posts, err = s.Interface.Posts()
+		return err
+	})
+	return posts, err
+}
+
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	err := s.do(func() (err error) {
+		p, err = s.Interface.Post(id)
+		return err
+	})
+	return p, err
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	var posts []storage.Post
+	err := s.do(func() (err error) {
+		posts, err = s.Interface.FilterPosts(f)
+		return err
+	})
+	return posts, err
+}
+
+func (s *Store) AddPost(p storage.Post) error {
+	return s.do(func() error { return s.Interface.AddPost(p) })
+}
+
+func (s *Store) UpdatePost(p storage.Post) error {
+	return s.do(func() error { return s.Interface.UpdatePost(p) })
+}
+
+func (s *Store) DeletePost(p storage.Post) error {
+	return s.do(func() error { return s.Interface.DeletePost(p) })
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	var authors []storage.Author
+	err := s.do(func() (err error) {
+		authors, err = s.Interface.Authors()
+		return err
+	})
+	return authors, err
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	err := s.do(func() (err error) {
+		a, err = s.Interface.Author(id)
+		return err
+	})
+	return a, err
+}
+
+func (s *Store) AddAuthor(a storage.Author) error {
+	return s.do(func() error { return s.Interface.AddAuthor(a) })
+}
+
+func (s *Store) DeleteAuthor(a storage.Author) error {
+	return s.do(func() error { return s.Interface.DeleteAuthor(a) })
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	var tags []storage.Tag
+	err := s.do(func() (err error) {
+		tags, err = s.Interface.Tags()
+		return err
+	})
+	return tags, err
+}
+
+func (s *Store) AddTag(t storage.Tag) error {
+	return s.do(func() error { return s.Interface.AddTag(t) })
+}
+
+func (s *Store) DeleteTag(t storage.Tag) error {
+	return s.do(func() error { return s.Interface.DeleteTag(t) })
+}
+
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	var comments []storage.Comment
+	err := s.do(func() (err error) {
+		comments, err = s.Interface.Comments(postID)
+		return err
+	})
+	return comments, err
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	err := s.do(func() (err error) {
+		c, err = s.Interface.Comment(id)
+		return err
+	})
+	return c, err
+}
+
+func (s *Store) AddComment(c storage.Comment) error {
+	return s.do(func() error { return s.Interface.AddComment(c) })
+}
+
+func (s *Store) UpdateComment(c storage.Comment) error {
+	return s.do(func() error { return s.Interface.UpdateComment(c) })
+}
+
+func (s *Store) DeleteComment(c storage.Comment) error {
+	return s.do(func() error { return s.Interface.DeleteComment(c) })
+}
@@ -0,0 +1,162 @@
+package breaker
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+var errDown = errors.New("connection refused")
+
+// flakyDB fails reads while err is set.
+type flakyDB struct {
+	*memdb.Store
+	err   error
+	calls int
+}
+
+func (db *flakyDB) Posts() ([]storage.Post, error) {
+	db.calls++
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.Store.Posts()
+}
+
+func newStore() (*Store, *flakyDB, *time.Time) {
+	db := &flakyDB{Store: memdb.New()}
+	s := New(db, Config{Failures: 3, OpenTimeout: time.Second})
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	return s, db, &now
+}
+
+func TestStore_open(t *testing.T) {
+	s, db, now := newStore()
+	db.err = errDown
+	for i := 0; i < 3; i++ {
+		if _, err := s.Posts(); err != errDown {
+			t.Fatalf("expected the database error, got %v", err)
+		}
+	}
+	if s.State() != Open {
+		t.Fatalf("expected the breaker to open, got %v", s.State())
+	}
+
+	// An open breaker fails fast.
+	_, err := s.Posts()
+	if !errors.Is(err, storage.ErrDBNotResponding) || db.calls != 3 {
+		t.Errorf("expected ErrDBNotResponding without a call, got %v after %d calls", err, db.calls)
+	}
+	if _, ok := s.Health(); ok {
+		t.Error("expected an open breaker to be unhealthy")
+	}
+
+	// A failed probe opens the breaker again.
+	*now = now.Add(time.Second)
+	if s.State() != HalfOpen {
+		t.Fatalf("expected the breaker to be half-open, got %v", s.State())
+	}
+	if _, err := s.Posts(); err != errDown || db.calls != 4 {
+		t.Errorf("expected a probe, got %v after %d calls", err, db.calls)
+	}
+	if s.State() != Open {
+		t.Fatalf("expected the breaker to open after a failed probe, got %v", s.State())
+	}
+
+	// A successful probe closes it.
+	*now = now.Add(time.Second)
+	db.err = nil
+	if _, err := s.Posts(); err != nil || s.State() != Closed {
+		t.Errorf("expected the breaker to close, got %v in state %v", err, s.State())
+	}
+	status, ok := s.Health()
+	if st := status.(Status); !ok || st.Failures != 0 {
+		t.Errorf("expected a healthy breaker, got %+v", st)
+	}
+}
+
+func TestStore_halfOpen(t *testing.T) {
+	s, db, now := newStore()
+	db.err = errDown
+	for i := 0; i < 3; i++ {
+		s.Posts()
+	}
+	*now = now.Add(time.Second)
+
+	// Only one request probes the database.
+	opened, ok := s.allow()
+	if !ok {
+		t.Fatal("expected the probe to be allowed")
+	}
+	if _, ok := s.allow(); ok {
+		t.Error("expected a second request to fail fast during the probe")
+	}
+	s.done(opened, nil)
+	if _, ok := s.allow(); !ok {
+		t.Error("expected requests to pass after a successful probe")
+	}
+}
+
+func TestStore_lateResults(t *testing.T) {
+	s, db, now := newStore()
+	slow, _ := s.allow() // a call that outlives the failures below
+	db.err = errDown
+	for i := 0; i < 3; i++ {
+		s.Posts()
+	}
+
+	// A late success does not close the breaker.
+	s.done(slow, nil)
+	if s.State() != Open {
+		t.Fatalf("expected the breaker to stay open, got %v", s.State())
+	}
+
+	// A late failure neither extends the opening nor fails the probe.
+	*now = now.Add(time.Second)
+	probe, ok := s.allow()
+	if !ok {
+		t.Fatal("expected the probe to be allowed")
+	}
+	s.done(slow, errDown)
+	if s.State() != HalfOpen {
+		t.Errorf("expected the breaker to stay half-open, got %v", s.State())
+	}
+	s.done(probe, nil)
+	if s.State() != Closed {
+		t.Errorf("expected the probe to close the breaker, got %v", s.State())
+	}
+}
+
+func TestStore_dataErrors(t *testing.T) {
+	s, db, _ := newStore()
+	db.err = storage.ErrEntryNotExist
+	for i := 0; i < 5; i++ {
+		s.Posts()
+	}
+	if s.State() != Closed {
+		t.Errorf("expected data errors to keep the breaker closed, got %v", s.State())
+	}
+
+	// A success resets the count of consecutive failures.
+	db.err = errDown
+	s.Posts()
+	s.Posts()
+	db.err = nil
+	s.Posts()
+	db.err = errDown
+	s.Posts()
+	if s.State() != Closed {
+		t.Errorf("expected the breaker to stay closed, got %v", s.State())
+	}
+}
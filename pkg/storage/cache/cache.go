@@ -0,0 +1,384 @@
+// Package cache кэширует чтение публикаций из любого хранилища.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"GoNews/pkg/storage"
+)
+
+// Config задаёт параметры кэша.
+type Config struct {
+	TTL      time.Duration // время жизни записи
+	MaxPosts int           // число кэшируемых публикаций
+	MaxLists int           // число кэшируемых выборок публикаций
+}
+
+// DefaultConfig возвращает параметры кэша по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		TTL:      10 * time.Second,
+		MaxPosts: 10000,
+		MaxLists: 1000,
+	}
+}
+
+// Stats - статистика обращений к кэшу.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`     // вытеснено из-за ограничения размера
+	Invalidations uint64 `json:"invalidations"` // удалено из-за изменения публикаций
+	Posts         int    `json:"posts"`         // публикаций в кэше
+	Lists         int    `json:"lists"`         // выборок в кэше
+}
+
+// Store кэширует публикации и выборки публикаций хранилища.
+// Изменения публикаций через Store удаляют из кэша только
+// затронутые записи; изменения в обход Store становятся
+// видны по истечении TTL.
+type Store struct {
+	storage.Interface
+	*state
+
+	// primary - хранилище привязано к запросу, который должен
+	// читать данные с основного сервера, минуя кэш.
+	primary bool
+}
+
+// state - кэш, общий для Store и хранилищ, привязанных к запросам.
+type state struct {
+	conf Config
+	now  func() time.Time
+
+	mu    sync.Mutex
+	posts *lru // публикации по ID
+	lists *lru // выборки по listKey
+	// gen увеличивается при каждом изменении, чтобы чтение,
+	// начатое до изменения, не записало в кэш устаревшие данные.
+	gen   uint64
+	stats Stats
+}
+
+// listKey - ключ выборки. all соответствует Posts(). Ключ повторяет
+// поля storage.Filter, но хранит метки строкой, поскольку срез
+// не может быть частью ключа map.
+type listKey struct {
+	all            bool
+	authorID       int
+	tags           string
+	publishedUntil int64
+	offset, limit  int
+}
+
+func filterKey(f storage.Filter) listKey {
+	return listKey{
+		authorID:       f.AuthorID,
+		tags:           strings.Join(storage.NormalizeTags(f.Tags), ","),
+		publishedUntil: f.PublishedUntil,
+		offset:         f.Offset,
+		limit:          f.Limit,
+	}
+}
+
+// match сообщает, может ли изменение публикации p затронуть выборку.
+func (k listKey) match(p storage.Post) bool {
+	if k.all {
+		return true
+	}
+	f := storage.Filter{AuthorID: k.authorID, PublishedUntil: k.publishedUntil}
+	if k.tags != "" {
+		f.Tags = strings.Split(k.tags, ",")
+	}
+	return f.Match(p)
+}
+
+// New оборачивает хранилище db кэшем.
+func New(db storage.Interface, conf Config) *Store {
+	return &Store{
+		Interface: db,
+		state: &state{
+			conf:  conf,
+			now:   time.Now,
+			posts: newLRU(conf.MaxPosts),
+			lists: newLRU(conf.MaxLists),
+		},
+	}
+}
+
+// Bind привязывает к запросу обёрнутое хранилище. Кэш остаётся
+// общим; запрос с storage.WithPrimary читает в обход кэша.
+func (s *Store) Bind(ctx context.Context) storage.Interface {
+	return &Store{
+		Interface: storage.Bind(s.Interface, ctx),
+		state:     s.state,
+		primary:   storage.PrimaryFrom(ctx),
+	}
+}
+
+// SetBus передаёт шину событий обёрнутому хранилищу.
+func (s *Store) SetBus(bus *storage.Bus) {
+	if p, ok := s.Interface.(storage.Publisher); ok {
+		p.SetBus(bus)
+	}
+}
+
+// Stats возвращает статистику обращений к кэшу.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Posts = s.posts.len()
+	st.Lists = s.lists.len()
+	return st
+}
+
+func (s *Store) Posts() ([]storage.Post, error) {
+	return s.list(listKey{all: true}, s.Interface.Posts)
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	f = s.roundUntil(f)
+	return s.list(filterKey(f), func() ([]storage.Post, error) {
+		return s.Interface.FilterPosts(f)
+	})
+}
+
+// roundUntil округляет вниз до TTL значение PublishedUntil, близкое
+// к текущему моменту. Ленты передают в нём текущее время, и без
+// округления каждая секунда давала бы новую выборку, вытесняющую
+// из кэша полезные. Публикация с более поздним временем появится
+// в выборке не позже чем через TTL, как и при любом кэшировании.
+func (s *Store) roundUntil(f storage.Filter) storage.Filter {
+	ttl := int64(s.conf.TTL / time.Second)
+	if ttl <= 1 || f.PublishedUntil == 0 {
+		return f
+	}
+	now := s.now().Unix()
+	if f.PublishedUntil > now || f.PublishedUntil <= now-ttl {
+		return f
+	}
+	f.PublishedUntil -= f.PublishedUntil % ttl
+	return f
+}
+
+func (s *Store) Post(id int) (storage.Post, error) {
+	s.mu.Lock()
+	if e, ok := s.get(s.posts, id); ok {
+		s.mu.Unlock()
+		return e.post, nil
+	}
+	gen := s.gen
+	s.mu.Unlock()
+
+	p, err := s.Interface.Post(id)
+	if err != nil {
+		// Ошибки не кэшируются: отсутствующая публикация
+		// может появиться при следующем AddPost.
+		return p, err
+	}
+	s.mu.Lock()
+	if gen == s.gen {
+		s.put(s.posts, &entry{key: id, post: p})
+	}
+	s.mu.Unlock()
+	return p, nil
+}
+
+// list возвращает выборку из кэша или загружает её функцией load.
+func (s *Store) list(key listKey, load func() ([]storage.Post, error)) ([]storage.Post, error) {
+	s.mu.Lock()
+	if e, ok := s.get(s.lists, key); ok {
+		s.mu.Unlock()
+		return clone(e.posts), nil
+	}
+	gen := s.gen
+	s.mu.Unlock()
+
+	posts, err := load()
+	if err != nil {
+		return posts, err
+	}
+	s.mu.Lock()
+	if gen == s.gen {
+		s.put(s.lists, &entry{key: key, posts: clone(posts)})
+	}
+	s.mu.Unlock()
+	return posts, nil
+}
+
+func (s *Store) AddPost(p storage.Post) error {
+	err := s.Interface.AddPost(p)
+	s.invalidate(p)
+	return err
+}
+
+func (s *Store) UpdatePost(p storage.Post) error {
+	old, oldErr := s.Post(p.ID)
+	err := s.Interface.UpdatePost(p)
+	if oldErr == nil {
+		s.invalidate(old, p)
+	} else {
+		s.invalidateAll()
+	}
+	return err
+}
+
+func (s *Store) DeletePost(p storage.Post) error {
+	old, oldErr := s.Post(p.ID)
+	err := s.Interface.DeletePost(p)
+	if oldErr == nil {
+		s.invalidate(old)
+	} else {
+		s.invalidateAll()
+	}
+	return err
+}
+
+// invalidate удаляет из кэша записи, которые могут содержать
+// публикации posts: саму публикацию и выборки, условиям которых
+// она удовлетворяет. Смещение выборки не учитывается, поскольку
+// изменение на предыдущей странице сдвигает следующие.
+func (s *Store) invalidate(posts ...storage.Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	for i, p := range posts {
+		if p.ID != 0 && s.posts.remove(p.ID) {
+			s.stats.Invalidations++
+		}
+		// Ключи выборок хранят метки в нормализованном виде,
+		// а переданная публикация может содержать их как угодно.
+		posts[i].Tags = storage.NormalizeTags(p.Tags)
+	}
+	s.lists.each(func(e *entry) {
+		key := e.key.(listKey)
+		for _, p := range posts {
+			if key.match(p) {
+				s.lists.remove(key)
+				s.stats.Invalidations++
+				return
+			}
+		}
+	})
+}
+
+// invalidateAll очищает кэш, если затронутые записи неизвестны.
+func (s *Store) invalidateAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gen++
+	s.stats.Invalidations += uint64(s.posts.len() + s.lists.len())
+	s.posts = newLRU(s.conf.MaxPosts)
+	s.lists = newLRU(s.conf.MaxLists)
+}
+
+// get ищет действующую запись и учитывает обращение в статистике.
+func (s *Store) get(l *lru, key interface{}) (*entry, bool) {
+	if s.primary {
+		s.stats.Misses++
+		return nil, false
+	}
+	e, ok := l.get(key)
+	if ok && !s.now().Before(e.expires) {
+		l.remove(key)
+		ok = false
+	}
+	if ok {
+		s.stats.Hits++
+	} else {
+		s.stats.Misses++
+	}
+	return e, ok
+}
+
+func (s *Store) put(l *lru, e *entry) {
+	e.expires = s.now().Add(s.conf.TTL)
+	if l.put(e) {
+		s.stats.Evictions++
+	}
+}
+
+// clone копирует выборку, чтобы вызывающий код
+// не мог изменить содержимое кэша.
+func clone(posts []storage.Post) []storage.Post {
+	if posts == nil {
+		return nil
+	}
+	return append([]storage.Post{}, posts...)
+}
+
+// entry - запись кэша.
+type entry struct {
+	key     interface{}
+	post    storage.Post
+	posts   []storage.Post
+	expires time.Time
+}
+
+// lru - набор записей ограниченного размера, из которого
+// вытесняются давно не использованные записи.
+type lru struct {
+	max   int
+	order *list.List // от недавно использованных к давним
+	items map[interface{}]*list.Element
+}
+
+func newLRU(max int) *lru {
+	return &lru{max: max, order: list.New(), items: make(map[interface{}]*list.Element)}
+}
+
+func (l *lru) len() int {
+	return l.order.Len()
+}
+
+func (l *lru) get(key interface{}) (*entry, bool) {
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*entry), true
+}
+
+// put добавляет запись и сообщает, пришлось ли вытеснить другую.
+func (l *lru) put(e *entry) bool {
+	if l.max <= 0 {
+		return false
+	}
+	if el, ok := l.items[e.key]; ok {
+		el.Value = e
+		l.order.MoveToFront(el)
+		return false
+	}
+	l.items[e.key] = l.order.PushFront(e)
+	if l.order.Len() <= l.max {
+		return false
+	}
+	oldest := l.order.Back()
+	l.order.Remove(oldest)
+	delete(l.items, oldest.Value.(*entry).key)
+	return true
+}
+
+func (l *lru) remove(key interface{}) bool {
+	el, ok := l.items[key]
+	if ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+	return ok
+}
+
+// each вызывает f для каждой записи. f может удалять записи.
+func (l *lru) each(f func(*entry)) {
+	for el := l.order.Front(); el != nil; {
+		next := el.Next()
+		f(el.Value.(*entry))
+		el = next
+	}
+}
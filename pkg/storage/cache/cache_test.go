@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+// countingDB counts reads that reach the backend.
+type countingDB struct {
+	*memdb.Store
+
+	mu    sync.Mutex
+	reads int
+}
+
+func (db *countingDB) count() {
+	db.mu.Lock()
+	db.reads++
+	db.mu.Unlock()
+}
+
+func (db *countingDB) Posts() ([]storage.Post, error) {
+	db.count()
+	return db.Store.Posts()
+}
+
+func (db *countingDB) Post(id int) (storage.Post, error) {
+	db.count()
+	return db.Store.Post(id)
+}
+
+func (db *countingDB) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	db.count()
+	return db.Store.FilterPosts(f)
+}
+
+func newStore(t *testing.T, conf Config) (*Store, *countingDB) {
+	t.Helper()
+	db := &countingDB{Store: memdb.New()}
+	for _, name := range []string{"Mark", "Tom", "Travis"} {
+		db.AddAuthor(storage.Author{Name: name})
+	}
+	for _, p := range storage.TestPosts {
+		err := db.Store.AddPost(p)
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+	return New(db, conf), db
+}
+
+func TestStore_hits(t *testing.T) {
+	s, db := newStore(t, DefaultConfig())
+
+	for i := 0; i < 3; i++ {
+		s.Posts()
+		s.Post(1)
+		s.FilterPosts(storage.Filter{AuthorID: 1})
+	}
+	if db.reads != 3 {
+		t.Errorf("expected 3 backend reads, got %d", db.reads)
+	}
+	st := s.Stats()
+	if st.Hits != 6 || st.Misses != 3 || st.Posts != 1 || st.Lists != 2 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// Callers cannot modify cached listings.
+	posts, _ := s.Posts()
+	posts[0].Title = "Changed"
+	if posts, _ = s.Posts(); posts[0].Title != "Post 1" {
+		t.Errorf("expected cached title %q, got %q", "Post 1", posts[0].Title)
+	}
+
+	// Missing posts are not cached.
+	s.Post(42)
+	s.Post(42)
+	if db.reads != 5 {
+		t.Errorf("expected 5 backend reads, got %d", db.reads)
+	}
+}
+
+func TestStore_Bind(t *testing.T) {
+	s, db := newStore(t, DefaultConfig())
+	s.Post(1)
+
+	// Permission checks read past the cache.
+	primary := storage.Bind(s, storage.WithPrimary(context.Background()))
+	primary.Post(1)
+	primary.Post(1)
+	if db.reads != 3 {
+		t.Errorf("expected 3 backend reads, got %d", db.reads)
+	}
+
+	// Other requests share the cache, including its invalidation.
+	bound := storage.Bind(s, context.Background())
+	bound.Post(1)
+	if db.reads != 3 {
+		t.Errorf("expected a cache hit, got %d backend reads", db.reads)
+	}
+	p, _ := db.Store.Post(1)
+	p.Title = "Changed"
+	if err := bound.UpdatePost(p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p, _ = s.Post(1); p.Title != "Changed" {
+		t.Errorf("expected title %q, got %q", "Changed", p.Title)
+	}
+}
+
+func TestStore_invalidate(t *testing.T) {
+	s, db := newStore(t, DefaultConfig())
+	mark := storage.Filter{AuthorID: 1}
+	tom := storage.Filter{AuthorID: 2}
+	load := func() {
+		s.Posts()
+		s.Post(1)
+		s.Post(2)
+		s.FilterPosts(mark)
+		s.FilterPosts(tom)
+	}
+	load()
+
+	// A post by Tom leaves Mark's listing and posts cached.
+	db.reads = 0
+	s.AddPost(storage.Post{Title: "New", Content: "Text", AuthorID: 2})
+	load()
+	if db.reads != 2 {
+		t.Errorf("expected 2 backend reads after AddPost, got %d", db.reads)
+	}
+	if posts, _ := s.FilterPosts(tom); len(posts) != 3 {
+		t.Errorf("expected 3 posts by Tom, got %d", len(posts))
+	}
+
+	// Moving a post from Tom to Mark invalidates both authors.
+	db.reads = 0
+	p := storage.TestPosts[1]
+	p.AuthorID = 1
+	err := s.UpdatePost(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	load()
+	if db.reads != 4 {
+		t.Errorf("expected 4 backend reads after UpdatePost, got %d", db.reads)
+	}
+	if got, _ := s.Post(2); got.AuthorID != 1 {
+		t.Errorf("expected updated post, got %+v", got)
+	}
+
+	db.reads = 0
+	s.DeletePost(storage.Post{ID: 1})
+	load()
+	if _, err := s.Post(1); err != storage.ErrEntryNotExist {
+		t.Errorf("expected ErrEntryNotExist, got %v", err)
+	}
+	if posts, _ := s.FilterPosts(mark); len(posts) != 2 {
+		t.Errorf("expected 2 posts by Mark, got %d", len(posts))
+	}
+}
+
+func TestStore_tags(t *testing.T) {
+	s, db := newStore(t, DefaultConfig())
+	politics := storage.Filter{Tags: []string{"politics"}}
+	if posts, _ := s.FilterPosts(politics); len(posts) != 0 {
+		t.Fatalf("expected no tagged posts, got %+v", posts)
+	}
+	s.FilterPosts(storage.Filter{Tags: []string{"Politics"}})
+	if db.reads != 1 {
+		t.Errorf("expected tags to share a cached listing, got %d backend reads", db.reads)
+	}
+
+	// Tagging a post invalidates the listings of its tags,
+	// however the tags are written.
+	p := storage.TestPosts[0]
+	p.Tags = []string{" Politics"}
+	s.UpdatePost(p)
+	if posts, _ := s.FilterPosts(politics); len(posts) != 1 || posts[0].ID != p.ID {
+		t.Errorf("expected the tagged post, got %+v", posts)
+	}
+	s.AddPost(storage.Post{ID: 20, Title: "T", Content: "C", AuthorID: 1, Tags: []string{"POLITICS"}})
+	if posts, _ := s.FilterPosts(politics); len(posts) != 2 {
+		t.Errorf("expected 2 tagged posts, got %+v", posts)
+	}
+}
+
+func TestStore_publishedUntil(t *testing.T) {
+	s, db := newStore(t, Config{TTL: 10 * time.Second, MaxPosts: 10, MaxLists: 10})
+	now := time.Unix(1700000005, 0)
+	s.now = func() time.Time { return now }
+
+	// Feeds ask for posts published until now; requests within
+	// one TTL share a listing.
+	for i := 0; i < 5; i++ {
+		s.FilterPosts(storage.Filter{PublishedUntil: now.Unix()})
+		now = now.Add(time.Second)
+	}
+	if db.reads != 1 {
+		t.Errorf("expected one backend read, got %d", db.reads)
+	}
+	if st := s.Stats(); st.Lists != 1 {
+		t.Errorf("expected one cached listing, got %d", st.Lists)
+	}
+
+	// Times in the past are kept as they are.
+	db.reads = 0
+	s.FilterPosts(storage.Filter{PublishedUntil: 1643723401})
+	s.FilterPosts(storage.Filter{PublishedUntil: 1643723402})
+	if db.reads != 2 {
+		t.Errorf("expected 2 backend reads, got %d", db.reads)
+	}
+}
+
+func TestStore_limits(t *testing.T) {
+	conf := Config{TTL: time.Minute, MaxPosts: 2, MaxLists: 1}
+	s, db := newStore(t, conf)
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	s.Post(1)
+	s.Post(2)
+	s.Post(1)
+	s.Post(3) // evicts post 2
+	s.Post(1)
+	s.Post(2)
+	if db.reads != 4 {
+		t.Errorf("expected 4 backend reads, got %d", db.reads)
+	}
+	s.FilterPosts(storage.Filter{AuthorID: 1})
+	s.FilterPosts(storage.Filter{AuthorID: 2})
+	if st := s.Stats(); st.Evictions != 3 || st.Posts != 2 || st.Lists != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	db.reads = 0
+	now = now.Add(time.Minute)
+	s.Post(1)
+	if db.reads != 1 {
+		t.Errorf("expected expired post to be reloaded, got %d reads", db.reads)
+	}
+}
+
+func TestStore_SetBus(t *testing.T) {
+	s, _ := newStore(t, DefaultConfig())
+	bus := storage.NewBus(10)
+	s.SetBus(bus)
+	sub := bus.Subscribe()
+	defer sub.Close()
+
+	s.DeletePost(storage.Post{ID: 1})
+	if e := <-sub.C; e.Type != storage.EventDeleted || e.Post.ID != 1 {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
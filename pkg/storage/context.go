@@ -0,0 +1,60 @@
+package storage
+
+import "context"
+
+// Binder - хранилище, которое может обслуживать отдельный запрос:
+// учитывать, кто его выполняет и какие требования к чтению заданы.
+// Обёртки хранилищ передают привязку обёрнутому хранилищу.
+type Binder interface {
+	// Bind возвращает хранилище с общими данными и соединениями,
+	// операции которого относятся к запросу ctx.
+	Bind(ctx context.Context) Interface
+}
+
+// Bind привязывает хранилище к запросу, если оно это поддерживает,
+// а иначе возвращает его без изменений.
+func Bind(db Interface, ctx context.Context) Interface {
+	if b, ok := db.(Binder); ok {
+		return b.Bind(ctx)
+	}
+	return db
+}
+
+type ctxKey int
+
+const (
+	callerKey ctxKey = iota
+	primaryKey
+)
+
+// WithCaller сообщает хранилищу, кто выполняет запрос. Хранилища
+// с репликами читают данные клиента с основного сервера сразу
+// после его изменений, не затрагивая чтение других клиентов.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFrom возвращает клиента, выполняющего запрос.
+func CallerFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+// WithPrimary требует читать данные только с основного сервера,
+// минуя реплики и кэш, например для проверки прав доступа.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// PrimaryFrom сообщает, что запрос должен читать данные
+// только с основного сервера.
+func PrimaryFrom(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return primary
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы событий об изменении публикаций.
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventPublished = "published" // черновик опубликован или публикация создана опубликованной
+	EventDeleted   = "deleted"
+)
+
+// EventTypes перечисляет все типы событий.
+var EventTypes = []string{EventCreated, EventUpdated, EventPublished, EventDeleted}
+
+// CreateEvents возвращает типы событий о создании публикации p.
+// Публикация, созданная уже опубликованной, кроме created даёт
+// и published; запланированная на будущее - только created.
+func CreateEvents(p Post) []string {
+	if p.PublishedAt != 0 && p.PublishedAt <= time.Now().Unix() {
+		return []string{EventCreated, EventPublished}
+	}
+	return []string{EventCreated}
+}
+
+// UpdateEvent возвращает тип события об обновлении публикации old до new.
+func UpdateEvent(old, new Post) string {
+	if old.PublishedAt == 0 && new.PublishedAt != 0 {
+		return EventPublished
+	}
+	return EventUpdated
+}
+
+// Event - изменение публикации. У удалённой публикации
+// может быть известен только ID.
+type Event struct {
+	ID   uint64 `json:"id"`
+	Type string `json:"type"`
+	Post Post   `json:"post"`
+	Time int64  `json:"time"`
+}
+
+// Publisher - хранилище, которое сообщает об изменениях публикаций.
+type Publisher interface {
+	SetBus(*Bus)
+}
+
+// DefaultBusHistory - число последних событий, которые шина хранит
+// для возобновления подписки.
+const DefaultBusHistory = 1000
+
+// subscriberBuffer - число событий, которые подписчик может
+// не успеть получить, прежде чем шина отключит его.
+const subscriberBuffer = 64
+
+// Bus - шина событий внутри процесса. Хранилища публикуют в неё
+// изменения, а подписчики получают их по мере появления.
+//
+// Идентификаторы событий возрастают. Нумерация начинается со времени
+// создания шины в микросекундах, поэтому идентификаторы, полученные
+// до перезапуска сервера, распознаются как устаревшие.
+type Bus struct {
+	mu       sync.Mutex
+	nextID   uint64
+	history  []Event // последние события от старых к новым
+	size     int
+	subs     map[*Subscription]bool
+	modified time.Time
+}
+
+// NewBus создаёт шину, которая хранит size последних событий.
+func NewBus(size int) *Bus {
+	now := time.Now()
+	return &Bus{
+		nextID:   uint64(now.UnixNano() / 1000),
+		size:     size,
+		subs:     make(map[*Subscription]bool),
+		modified: now,
+	}
+}
+
+// Modified возвращает время последнего события. Если событий
+// ещё не было, возвращается время создания шины: об изменениях
+// до её создания шине неизвестно.
+func (b *Bus) Modified() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.modified
+}
+
+// Publish отправляет событие подписчикам. Вызов для nil-шины ничего
+// не делает, поэтому хранилища без шины могут вызывать его без проверки.
+// Подписчик, который не успевает получать события, отключается.
+func (b *Bus) Publish(typ string, p Post) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.modified = time.Now()
+	e := Event{ID: b.nextID, Type: typ, Post: p, Time: b.modified.Unix()}
+	b.nextID++
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = append(b.history[:0], b.history[len(b.history)-b.size:]...)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- e:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscription - подписка на события шины.
+type Subscription struct {
+	// Backlog содержит события, пропущенные с момента, указанного
+	// в Resume. Новые события поступают в C. Канал закрывается,
+	// если подписчик не успевает получать события.
+	Backlog []Event
+	C       <-chan Event
+	// Gap означает, что пропущенные события уже вытеснены из
+	// истории или получены до перезапуска и восстановить их нельзя.
+	Gap bool
+	// Last - ID последнего события на момент подписки.
+	Last uint64
+
+	c   chan Event
+	bus *Bus
+}
+
+// Subscribe подписывается на новые события.
+func (b *Bus) Subscribe() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.add()
+}
+
+// Resume подписывается на события, следующие за событием lastID.
+func (b *Bus) Resume(lastID uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := b.add()
+	switch {
+	case lastID+1 == b.nextID:
+		// Клиент получил все события.
+	case lastID >= b.nextID, len(b.history) == 0, lastID+1 < b.history[0].ID:
+		sub.Gap = true
+	default:
+		i := int(lastID + 1 - b.history[0].ID)
+		sub.Backlog = append([]Event(nil), b.history[i:]...)
+	}
+	return sub
+}
+
+func (b *Bus) add() *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, Last: b.nextID - 1, c: c, bus: b}
+	b.subs[sub] = true
+	return sub
+}
+
+func (b *Bus) remove(sub *Subscription) {
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Close отменяет подписку.
+func (sub *Subscription) Close() {
+	sub.bus.mu.Lock()
+	defer sub.bus.mu.Unlock()
+	sub.bus.remove(sub)
+}
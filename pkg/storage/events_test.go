@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ids(events []Event) []uint64 {
+	var list []uint64
+	for _, e := range events {
+		list = append(list, e.ID)
+	}
+	return list
+}
+
+func TestBus_Resume(t *testing.T) {
+	b := NewBus(3)
+	first := b.Subscribe()
+	defer first.Close()
+	for i := 1; i <= 5; i++ {
+		b.Publish(EventCreated, Post{ID: i})
+	}
+	var got []Event
+	for i := 0; i < 5; i++ {
+		got = append(got, <-first.C)
+	}
+	start := got[0].ID
+
+	tests := []struct {
+		name    string
+		lastID  uint64
+		backlog []uint64
+		gap     bool
+	}{
+		{"up to date", start + 4, nil, false},
+		{"missed two", start + 2, []uint64{start + 3, start + 4}, false},
+		{"oldest kept", start + 1, []uint64{start + 2, start + 3, start + 4}, false},
+		{"evicted", start, nil, true},
+		{"before restart", start + 100, nil, true},
+	}
+	for _, tt := range tests {
+		sub := b.Resume(tt.lastID)
+		if sub.Gap != tt.gap || len(ids(sub.Backlog)) != len(tt.backlog) {
+			t.Errorf("%s: expected backlog %v and gap %v, got %v and %v", tt.name, tt.backlog, tt.gap, ids(sub.Backlog), sub.Gap)
+		} else {
+			for i, id := range ids(sub.Backlog) {
+				if id != tt.backlog[i] {
+					t.Errorf("%s: expected backlog %v, got %v", tt.name, tt.backlog, ids(sub.Backlog))
+					break
+				}
+			}
+		}
+		if sub.Last != start+4 {
+			t.Errorf("%s: expected last ID %d, got %d", tt.name, start+4, sub.Last)
+		}
+		sub.Close()
+	}
+}
+
+func TestBus_slowSubscriber(t *testing.T) {
+	b := NewBus(DefaultBusHistory)
+	sub := b.Subscribe()
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(EventCreated, Post{ID: i})
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("expected %d events before disconnect, got %d", subscriberBuffer, n)
+	}
+	// Closing a dropped subscription is harmless.
+	sub.Close()
+
+	var nilBus *Bus
+	nilBus.Publish(EventCreated, Post{})
+}
+
+func TestCreateEvents(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name string
+		post Post
+		want []string
+	}{
+		{"draft", Post{}, []string{EventCreated}},
+		{"published", Post{PublishedAt: now}, []string{EventCreated, EventPublished}},
+		{"scheduled", Post{PublishedAt: now + 3600}, []string{EventCreated}},
+	}
+	for _, tt := range tests {
+		if got := CreateEvents(tt.post); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestUpdateEvent(t *testing.T) {
+	draft, published := Post{}, Post{PublishedAt: 1}
+	if got := UpdateEvent(draft, published); got != EventPublished {
+		t.Errorf("expected %q, got %q", EventPublished, got)
+	}
+	if got := UpdateEvent(published, published); got != EventUpdated {
+		t.Errorf("expected %q, got %q", EventUpdated, got)
+	}
+}
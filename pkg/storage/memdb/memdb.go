@@ -1,38 +1,543 @@
 package memdb
 
-import "GoNews/pkg/storage"
+import (
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
 
 // Хранилище данных.
-type Store struct{}
+type Store struct {
+	mu     sync.RWMutex
+	posts  map[int]storage.Post
+	nextID int
+
+	authors      map[int]storage.Author
+	nextAuthorID int
+
+	// Известные метки, в том числе без публикаций.
+	tags map[string]bool
+
+	comments      map[int]storage.Comment
+	nextCommentID int
+
+	// Журнал упреждающей записи. Равен nil,
+	// если хранилище работает только в памяти.
+	wal *wal
+
+	// Шина событий об изменениях публикаций.
+	bus *storage.Bus
+}
 
 // Конструктор объекта хранилища.
 func New() *Store {
-	return new(Store)
+	return &Store{
+		posts:  make(map[int]storage.Post),
+		nextID: 1,
+
+		authors:      make(map[int]storage.Author),
+		nextAuthorID: 1,
+
+		tags: make(map[string]bool),
+
+		comments:      make(map[int]storage.Comment),
+		nextCommentID: 1,
+	}
+}
+
+// NewSample создаёт хранилище в памяти с примерами публикаций.
+func NewSample() *Store {
+	s := New()
+	s.apply(record{Op: opAddAuthor, Author: &sampleAuthor})
+	for i := range samplePosts {
+		s.apply(record{Op: opAdd, Post: &samplePosts[i]})
+	}
+	return s
+}
+
+// SetBus задаёт шину, в которую хранилище публикует изменения.
+func (s *Store) SetBus(bus *storage.Bus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bus = bus
 }
 
 func (s *Store) Posts() ([]storage.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []storage.Post
+	for _, p := range s.posts {
+		posts = append(posts, p)
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].ID < posts[j].ID })
+
+	log.Infof("retrieved %d posts", len(posts))
 	return posts, nil
 }
 
-func (s *Store) AddPost(storage.Post) error {
+func (s *Store) Post(id int) (storage.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return p, storage.ErrEntryNotExist
+	}
+	return p, nil
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var posts []storage.Post
+	for _, p := range s.posts {
+		if f.Match(p) {
+			posts = append(posts, p)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].PublishedAt != posts[j].PublishedAt {
+			return posts[i].PublishedAt > posts[j].PublishedAt
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	if f.Offset >= len(posts) {
+		return nil, nil
+	}
+	posts = posts[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(posts) {
+		posts = posts[:f.Limit]
+	}
+	return posts, nil
+}
+
+// AddPost adds the post to the store. A post with zero ID gets the next
+// free ID, like a serial column would assign it.
+func (s *Store) AddPost(post storage.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if post.ID == 0 {
+		post.ID = s.nextID
+	}
+	post.Tags = storage.NormalizeTags(post.Tags)
+	if _, ok := s.posts[post.ID]; ok {
+		log.Errorf("error adding post: post with ID %v already exists", post.ID)
+		return storage.ErrEntryExists
+	}
+
+	err := s.commit(record{Op: opAdd, Post: &post})
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	for _, typ := range storage.CreateEvents(post) {
+		s.bus.Publish(typ, post)
+	}
+
+	log.Infof("post ID:%v added successfully", post.ID)
 	return nil
 }
-func (s *Store) UpdatePost(storage.Post) error {
+
+func (s *Store) UpdatePost(post storage.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.posts[post.ID]
+	if !ok {
+		log.Errorf("error updating post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
+	post.Tags = storage.NormalizeTags(post.Tags)
+
+	err := s.commit(record{Op: opUpdate, Post: &post})
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.UpdateEvent(old, post), post)
+
+	log.Infof("post ID:%v updated successfully", post.ID)
 	return nil
 }
-func (s *Store) DeletePost(storage.Post) error {
+
+func (s *Store) DeletePost(post storage.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.posts[post.ID]
+	if !ok {
+		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	err := s.commit(record{Op: opDelete, Post: &storage.Post{ID: post.ID}})
+	if err != nil {
+		log.Errorf("error deleting post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.EventDeleted, old)
+
+	log.Infof("post ID:%v deleted successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var authors []storage.Author
+	for _, a := range s.authors {
+		authors = append(authors, a)
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i].ID < authors[j].ID })
+
+	return authors, nil
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.authors[id]
+	if !ok {
+		return a, storage.ErrEntryNotExist
+	}
+	return a, nil
+}
+
+// AddAuthor adds the author to the store. An author with zero ID
+// gets the next free ID.
+func (s *Store) AddAuthor(author storage.Author) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if author.ID == 0 {
+		author.ID = s.nextAuthorID
+	}
+	if _, ok := s.authors[author.ID]; ok {
+		log.Errorf("error adding author: author with ID %v already exists", author.ID)
+		return storage.ErrEntryExists
+	}
+
+	err := s.commit(record{Op: opAddAuthor, Author: &author})
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v added successfully", author.ID)
 	return nil
 }
 
-var posts = []storage.Post{
+// DeleteAuthor removes the author. Authors of existing posts
+// cannot be removed.
+func (s *Store) DeleteAuthor(author storage.Author) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.authors[author.ID]; !ok {
+		log.Errorf("error deleting author: author with ID %v not found", author.ID)
+		return storage.ErrEntryNotExist
+	}
+	for _, p := range s.posts {
+		if p.AuthorID == author.ID {
+			log.Errorf("error deleting author: author ID %v has posts", author.ID)
+			return storage.ErrEntryInUse
+		}
+	}
+	for _, c := range s.comments {
+		if c.AuthorID == author.ID {
+			log.Errorf("error deleting author: author ID %v has comments", author.ID)
+			return storage.ErrEntryInUse
+		}
+	}
+
+	err := s.commit(record{Op: opDeleteAuthor, Author: &storage.Author{ID: author.ID}})
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v deleted successfully", author.ID)
+	return nil
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, p := range s.posts {
+		for _, t := range p.Tags {
+			counts[t]++
+		}
+	}
+	tags := make([]storage.Tag, 0, len(s.tags))
+	for name := range s.tags {
+		tags = append(tags, storage.Tag{Name: name, Posts: counts[name]})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	return tags, nil
+}
+
+func (s *Store) AddTag(tag storage.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag = storage.Tag{Name: storage.NormalizeTag(tag.Name)}
+	if s.tags[tag.Name] {
+		log.Errorf("error adding tag: tag %q already exists", tag.Name)
+		return storage.ErrEntryExists
+	}
+
+	err := s.commit(record{Op: opAddTag, Tag: &tag})
+	if err != nil {
+		log.Errorf("error adding tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q added successfully", tag.Name)
+	return nil
+}
+
+// DeleteTag removes the tag. Tags of existing posts cannot be removed.
+func (s *Store) DeleteTag(tag storage.Tag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tag = storage.Tag{Name: storage.NormalizeTag(tag.Name)}
+	if !s.tags[tag.Name] {
+		log.Errorf("error deleting tag: tag %q not found", tag.Name)
+		return storage.ErrEntryNotExist
+	}
+	for _, p := range s.posts {
+		if p.HasTags([]string{tag.Name}) {
+			log.Errorf("error deleting tag: tag %q has posts", tag.Name)
+			return storage.ErrEntryInUse
+		}
+	}
+
+	err := s.commit(record{Op: opDeleteTag, Tag: &tag})
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q deleted successfully", tag.Name)
+	return nil
+}
+
+// Comments returns the comments of the post ordered by ID,
+// which is the order they were added in.
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return nil, storage.ErrEntryNotExist
+	}
+	var comments []storage.Comment
+	for _, c := range s.comments {
+		if c.PostID == postID {
+			comments = append(comments, c)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+
+	return comments, nil
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.comments[id]
+	if !ok {
+		return c, storage.ErrEntryNotExist
+	}
+	return c, nil
+}
+
+// AddComment adds the comment to the post. A comment with zero ID
+// gets the next free ID. A reply must belong to the same post as
+// the comment it answers.
+func (s *Store) AddComment(comment storage.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if comment.ID == 0 {
+		comment.ID = s.nextCommentID
+	}
+	if _, ok := s.comments[comment.ID]; ok {
+		log.Errorf("error adding comment: comment with ID %v already exists", comment.ID)
+		return storage.ErrEntryExists
+	}
+	if _, ok := s.posts[comment.PostID]; !ok {
+		log.Errorf("error adding comment: post with ID %v not found", comment.PostID)
+		return storage.ErrEntryNotExist
+	}
+	if _, ok := s.authors[comment.AuthorID]; !ok {
+		log.Errorf("error adding comment: author with ID %v not found", comment.AuthorID)
+		return storage.ErrEntryNotExist
+	}
+	if comment.ParentID != 0 {
+		parent, ok := s.comments[comment.ParentID]
+		if !ok || parent.PostID != comment.PostID {
+			log.Errorf("error adding comment: comment with ID %v not found in post ID %v", comment.ParentID, comment.PostID)
+			return storage.ErrEntryNotExist
+		}
+	}
+
+	err := s.commit(record{Op: opAddComment, Comment: &comment})
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v added successfully", comment.ID)
+	return nil
+}
+
+// UpdateComment changes the text of the comment and the time
+// of the change; the other fields stay as they were.
+func (s *Store) UpdateComment(comment storage.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[comment.ID]
+	if !ok {
+		log.Errorf("error updating comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+	c.Content = comment.Content
+	c.UpdatedAt = comment.UpdatedAt
+
+	err := s.commit(record{Op: opUpdateComment, Comment: &c})
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v updated successfully", comment.ID)
+	return nil
+}
+
+// DeleteComment removes the comment together with the replies to it.
+func (s *Store) DeleteComment(comment storage.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.comments[comment.ID]; !ok {
+		log.Errorf("error deleting comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	err := s.commit(record{Op: opDeleteComment, Comment: &storage.Comment{ID: comment.ID}})
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v deleted successfully", comment.ID)
+	return nil
+}
+
+// deleteThread removes the comment and, recursively, the replies to it.
+func (s *Store) deleteThread(id int) {
+	delete(s.comments, id)
+	for _, c := range s.comments {
+		if c.ParentID == id {
+			s.deleteThread(c.ID)
+		}
+	}
+}
+
+// commit writes the record to the log, if there is one, and then applies
+// it to the in-memory state. Must be called with s.mu held for writing.
+func (s *Store) commit(rec record) error {
+	if s.wal != nil {
+		err := s.wal.append(&rec)
+		if err != nil {
+			return err
+		}
+	}
+	s.apply(rec)
+
+	if s.wal != nil && s.wal.needSnapshot() {
+		err := s.snapshot()
+		if err != nil {
+			// The record is already durable, so the mutation succeeded;
+			// the log just stays longer until the next attempt.
+			log.Errorf("error taking memdb snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+// apply changes the in-memory state according to the record.
+// Applying the same record twice leaves the state unchanged,
+// which keeps the log replay safe.
+func (s *Store) apply(rec record) {
+	switch rec.Op {
+	case opAdd, opUpdate:
+		s.posts[rec.Post.ID] = *rec.Post
+		for _, t := range rec.Post.Tags {
+			s.tags[t] = true
+		}
+	case opDelete:
+		delete(s.posts, rec.Post.ID)
+		for id, c := range s.comments {
+			if c.PostID == rec.Post.ID {
+				delete(s.comments, id)
+			}
+		}
+	case opAddAuthor:
+		s.authors[rec.Author.ID] = *rec.Author
+	case opDeleteAuthor:
+		delete(s.authors, rec.Author.ID)
+	case opAddTag:
+		s.tags[rec.Tag.Name] = true
+	case opDeleteTag:
+		delete(s.tags, rec.Tag.Name)
+	case opAddComment, opUpdateComment:
+		s.comments[rec.Comment.ID] = *rec.Comment
+	case opDeleteComment:
+		s.deleteThread(rec.Comment.ID)
+	}
+	if rec.Post != nil && rec.Post.ID >= s.nextID {
+		s.nextID = rec.Post.ID + 1
+	}
+	if rec.Author != nil && rec.Author.ID >= s.nextAuthorID {
+		s.nextAuthorID = rec.Author.ID + 1
+	}
+	if rec.Comment != nil && rec.Comment.ID >= s.nextCommentID {
+		s.nextCommentID = rec.Comment.ID + 1
+	}
+}
+
+// Автор примеров публикаций.
+var sampleAuthor = storage.Author{ID: 1, Name: "The Go Authors"}
+
+// Примеры публикаций для хранилища в памяти.
+var samplePosts = []storage.Post{
 	{
-		ID:      1,
-		Title:   "Effective Go",
-		Content: "Go is a new language. Although it borrows ideas from existing languages, it has unusual properties that make effective Go programs different in character from programs written in its relatives. A straightforward translation of a C++ or Java program into Go is unlikely to produce a satisfactory result—Java programs are written in Java, not Go. On the other hand, thinking about the problem from a Go perspective could produce a successful but quite different program. In other words, to write Go well, it's important to understand its properties and idioms. It's also important to know the established conventions for programming in Go, such as naming, formatting, program construction, and so on, so that programs you write will be easy for other Go programmers to understand.",
+		ID:       1,
+		AuthorID: 1,
+		Title:    "Effective Go",
+		Content:  "Go is a new language. Although it borrows ideas from existing languages, it has unusual properties that make effective Go programs different in character from programs written in its relatives. A straightforward translation of a C++ or Java program into Go is unlikely to produce a satisfactory result—Java programs are written in Java, not Go. On the other hand, thinking about the problem from a Go perspective could produce a successful but quite different program. In other words, to write Go well, it's important to understand its properties and idioms. It's also important to know the established conventions for programming in Go, such as naming, formatting, program construction, and so on, so that programs you write will be easy for other Go programmers to understand.",
 	},
 	{
-		ID:      2,
-		Title:   "The Go Memory Model",
-		Content: "The Go memory model specifies the conditions under which reads of a variable in one goroutine can be guaranteed to observe values produced by writes to the same variable in a different goroutine.",
+		ID:       2,
+		AuthorID: 1,
+		Title:    "The Go Memory Model",
+		Content:  "The Go memory model specifies the conditions under which reads of a variable in one goroutine can be guaranteed to observe values produced by writes to the same variable in a different goroutine.",
 	},
 }
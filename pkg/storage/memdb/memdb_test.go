@@ -0,0 +1,443 @@
+package memdb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/storagetest"
+)
+
+func addTestPosts(t *testing.T, db *Store) {
+	t.Helper()
+	for _, tp := range storage.TestPosts {
+		err := db.AddPost(tp)
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+}
+
+func TestStore_Posts(t *testing.T) {
+	db := New()
+	addTestPosts(t, db)
+
+	posts, err := db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(posts, storage.TestPosts) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts)
+	}
+}
+
+func TestStore_AddPost_assignsID(t *testing.T) {
+	db := New()
+	addTestPosts(t, db)
+
+	err := db.AddPost(storage.Post{Title: "New post"})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	posts, _ := db.Posts()
+	last := posts[len(posts)-1]
+	if last.ID != len(storage.TestPosts)+1 || last.Title != "New post" {
+		t.Errorf("expected new post with ID %d, got %+v", len(storage.TestPosts)+1, last)
+	}
+
+	err = db.AddPost(storage.TestPosts[0])
+	if !errors.Is(err, storage.ErrEntryExists) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryExists, err)
+	}
+}
+
+func TestStore_UpdateDelete_postNotExist(t *testing.T) {
+	db := New()
+	addTestPosts(t, db)
+
+	err := db.UpdatePost(storage.Post{ID: 999999})
+	if !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
+	}
+	err = db.DeletePost(storage.Post{ID: 999999})
+	if !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
+	}
+}
+
+// mutate performs a fixed sequence of changes and returns the expected state.
+func mutate(t *testing.T, db *Store) []storage.Post {
+	t.Helper()
+	addTestPosts(t, db)
+
+	updated := storage.TestPosts[1]
+	updated.Title = "Updated title"
+	err := db.UpdatePost(updated)
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	err = db.DeletePost(storage.TestPosts[0])
+	if err != nil {
+		t.Fatalf("unexpected error deleting post: %v", err)
+	}
+
+	want := append([]storage.Post{updated}, storage.TestPosts[2:]...)
+	return want
+}
+
+func TestOpen_recoversState(t *testing.T) {
+	for _, every := range []int{1, 3, 1000} {
+		dir := t.TempDir()
+		db, err := Open(Config{Dir: dir, SnapshotEvery: every})
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		want := mutate(t, db)
+
+		// Simulate a crash: drop the store without Close.
+		db.wal.f.Close()
+
+		db, err = Open(Config{Dir: dir, SnapshotEvery: every})
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %v", err)
+		}
+		got, _ := db.Posts()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("snapshot every %d: recovered posts do not match. Expected: %+v, Got: %+v", every, want, got)
+		}
+
+		// IDs must continue after the recovered ones.
+		err = db.AddPost(storage.Post{Title: "After restart"})
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+		got, _ = db.Posts()
+		if id := got[len(got)-1].ID; id != len(storage.TestPosts)+1 {
+			t.Errorf("snapshot every %d: expected next ID %d, got %d", every, len(storage.TestPosts)+1, id)
+		}
+		db.Close()
+	}
+}
+
+func TestOpen_recoversTags(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	for _, name := range []string{"sport", "politics"} {
+		err = db.AddTag(storage.Tag{Name: name})
+		if err != nil {
+			t.Fatalf("unexpected error adding tag: %v", err)
+		}
+	}
+	err = db.DeleteTag(storage.Tag{Name: "politics"})
+	if err != nil {
+		t.Fatalf("unexpected error deleting tag: %v", err)
+	}
+	err = db.AddPost(storage.Post{Title: "Tagged", Tags: []string{"news"}})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	db.wal.f.Close()
+
+	db, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	defer db.Close()
+	tags, _ := db.Tags()
+	want := []storage.Tag{{Name: "news", Posts: 1}, {Name: "sport"}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tags %+v, got %+v", want, tags)
+	}
+	posts, _ := db.Posts()
+	if len(posts) != 1 {
+		t.Errorf("expected 1 post after recovery, got %d", len(posts))
+	}
+}
+
+func TestOpen_recoversComments(t *testing.T) {
+	for _, every := range []int{1, 1000} {
+		dir := t.TempDir()
+		db, err := Open(Config{Dir: dir, SnapshotEvery: every})
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		for _, a := range storage.TestAuthors {
+			err = db.AddAuthor(a)
+			if err != nil {
+				t.Fatalf("unexpected error adding author: %v", err)
+			}
+		}
+		addTestPosts(t, db)
+		comments := []storage.Comment{
+			{PostID: 1, AuthorID: 1, Content: "First"},
+			{PostID: 1, ParentID: 1, AuthorID: 2, Content: "Reply"},
+			{PostID: 2, AuthorID: 2, Content: "Other"},
+		}
+		for _, c := range comments {
+			err = db.AddComment(c)
+			if err != nil {
+				t.Fatalf("unexpected error adding comment: %v", err)
+			}
+		}
+		err = db.UpdateComment(storage.Comment{ID: 3, Content: "Edited", UpdatedAt: 1644159000})
+		if err != nil {
+			t.Fatalf("unexpected error updating comment: %v", err)
+		}
+		err = db.DeletePost(storage.Post{ID: 1})
+		if err != nil {
+			t.Fatalf("unexpected error deleting post: %v", err)
+		}
+		db.wal.f.Close()
+
+		db, err = Open(Config{Dir: dir, SnapshotEvery: every})
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %v", err)
+		}
+		got, _ := db.Comments(2)
+		want := []storage.Comment{{ID: 3, PostID: 2, AuthorID: 2, Content: "Edited", UpdatedAt: 1644159000}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("snapshot every %d: expected comments %+v, got %+v", every, want, got)
+		}
+
+		// IDs must continue after the recovered ones.
+		err = db.AddComment(storage.Comment{PostID: 2, AuthorID: 1, Content: "After restart"})
+		if err != nil {
+			t.Fatalf("unexpected error adding comment: %v", err)
+		}
+		got, _ = db.Comments(2)
+		if id := got[len(got)-1].ID; id != 4 {
+			t.Errorf("snapshot every %d: expected next comment ID 4, got %d", every, id)
+		}
+		db.Close()
+	}
+}
+
+func TestOpen_tornRecord(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	want := mutate(t, db)
+	db.wal.f.Close()
+
+	// Append half of a record, as if the process died mid-write.
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 0xde, 0xad, '{', '"'})
+	f.Close()
+
+	db, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	got, _ := db.Posts()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recovered posts do not match. Expected: %+v, Got: %+v", want, got)
+	}
+
+	// The log must stay usable after the torn tail is cut off.
+	err = db.AddPost(storage.Post{Title: "After recovery"})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	db.wal.f.Close()
+
+	db, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	got, _ = db.Posts()
+	if len(got) != len(want)+1 {
+		t.Errorf("expected %d posts after recovery, got %d", len(want)+1, len(got))
+	}
+	db.Close()
+}
+
+// failingFile fails to sync the log and, if asked, to cut it back.
+type failingFile struct {
+	logFile
+	truncate bool
+}
+
+func (f *failingFile) Sync() error {
+	return errors.New("sync failed")
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.truncate {
+		return errors.New("truncate failed")
+	}
+	return f.logFile.Truncate(size)
+}
+
+func TestOpen_appendFailure(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	addTestPosts(t, db)
+
+	f := db.wal.f
+	db.wal.f = &failingFile{logFile: f}
+	if err := db.AddPost(storage.Post{Title: "Not synced"}); err == nil {
+		t.Fatal("expected error adding post")
+	}
+	db.wal.f = f
+	err = db.AddPost(storage.Post{Title: "After failure"})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	want, _ := db.Posts()
+	f.Close()
+
+	// The failed record is neither replayed nor followed by garbage.
+	db, err = Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	got, _ := db.Posts()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recovered posts do not match. Expected: %+v, Got: %+v", want, got)
+	}
+
+	// A log that cannot be cut back refuses further records.
+	f = db.wal.f
+	db.wal.f = &failingFile{logFile: f, truncate: true}
+	db.AddPost(storage.Post{Title: "Not synced"})
+	db.wal.f = f
+	if err := db.AddPost(storage.Post{Title: "After damage"}); err == nil {
+		t.Error("expected error adding post to a damaged log")
+	}
+	f.Close()
+}
+
+func TestNewSample(t *testing.T) {
+	db := NewSample()
+	posts, _ := db.Posts()
+	if len(posts) != 2 || posts[0].Title != "Effective Go" {
+		t.Errorf("expected sample posts, got %+v", posts)
+	}
+	if a, err := db.Author(posts[0].AuthorID); err != nil || a.Name == "" {
+		t.Errorf("expected the author of sample posts, got %+v, %v", a, err)
+	}
+	err := db.AddPost(storage.Post{Title: "New post"})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	if p, err := db.Post(3); err != nil || p.Title != "New post" {
+		t.Errorf("expected new post with ID 3, got %+v, %v", p, err)
+	}
+}
+
+func TestStore_FilterPosts(t *testing.T) {
+	db := New()
+	addTestPosts(t, db)
+
+	tp := storage.TestPosts
+	tests := []struct {
+		name   string
+		filter storage.Filter
+		want   []storage.Post
+	}{
+		{"all newest first", storage.Filter{}, []storage.Post{tp[4], tp[3], tp[2], tp[1], tp[0]}},
+		{"by author", storage.Filter{AuthorID: 1}, []storage.Post{tp[2], tp[0]}},
+		{"published until", storage.Filter{PublishedUntil: tp[1].PublishedAt}, []storage.Post{tp[1], tp[0]}},
+		{"page", storage.Filter{Offset: 1, Limit: 2}, []storage.Post{tp[3], tp[2]}},
+		{"offset past end", storage.Filter{Offset: 10}, nil},
+	}
+	for _, tt := range tests {
+		got, err := db.FilterPosts(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func addTestAuthors(t *testing.T, db *Store) {
+	t.Helper()
+	for _, a := range storage.TestAuthors {
+		err := db.AddAuthor(a)
+		if err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+}
+
+func TestStore_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		db := New()
+		addTestAuthors(t, db)
+		return db
+	})
+}
+
+func TestOpen_conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		db, err := Open(Config{Dir: t.TempDir(), SnapshotEvery: 10})
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		addTestAuthors(t, db)
+		return db
+	})
+}
+
+func TestTenants(t *testing.T) {
+	tenants, err := NewTenants(Config{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	storagetest.RunTenants(t, tenants)
+}
+
+func TestNewTenants_dir(t *testing.T) {
+	dir := t.TempDir()
+	tenants, err := NewTenants(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Run("conformance", func(t *testing.T) {
+		storagetest.RunTenants(t, tenants)
+	})
+
+	tenants.AddTenant("initech")
+	db, _ := tenants.Tenant("initech")
+	db.AddAuthor(storage.Author{Name: "Mark"})
+	tenants.Close()
+
+	// Tenants found in the data directory are reopened with their data.
+	tenants, err = NewTenants(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error reopening tenants: %v", err)
+	}
+	defer tenants.Close()
+	ids, _ := tenants.Tenants()
+	if !reflect.DeepEqual(ids, []string{"initech"}) {
+		t.Fatalf("expected tenant initech after reopening, got %v", ids)
+	}
+	db, _ = tenants.Tenant("initech")
+	if authors, _ := db.Authors(); len(authors) != 1 {
+		t.Errorf("expected the author of the tenant to be kept, got %+v", authors)
+	}
+}
+
+func init() {
+	log.SetOutput(io.Discard)
+}
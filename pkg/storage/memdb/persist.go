@@ -0,0 +1,445 @@
+package memdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.json"
+
+	// DefaultSnapshotEvery is the number of log records after which
+	// the log is compacted into a snapshot, unless Config says otherwise.
+	DefaultSnapshotEvery = 1000
+
+	// maxRecordSize guards the replay from allocating huge buffers
+	// when a torn header contains garbage instead of a length.
+	maxRecordSize = 64 << 20
+)
+
+// Config задаёт параметры хранения данных на диске.
+type Config struct {
+	Dir           string // каталог данных
+	SnapshotEvery int    // число записей журнала между снимками
+	NoSync        bool   // не вызывать fsync после каждой записи
+}
+
+// Open creates a store whose state is kept in conf.Dir. Every mutation is
+// appended to the write-ahead log before it is applied, the log is
+// periodically compacted into a snapshot, and the state is recovered from
+// both on startup. A torn last record left by a crash is discarded.
+func Open(conf Config) (*Store, error) {
+	if conf.SnapshotEvery <= 0 {
+		conf.SnapshotEvery = DefaultSnapshotEvery
+	}
+
+	err := os.MkdirAll(conf.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	s := New()
+	snapSeq, err := s.loadSnapshot(filepath.Join(conf.Dir, snapshotFile))
+	if err != nil {
+		return nil, fmt.Errorf("error loading memdb snapshot: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(conf.Dir, walFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &wal{
+		f:             f,
+		dir:           conf.Dir,
+		seq:           snapSeq,
+		snapshotEvery: conf.SnapshotEvery,
+		noSync:        conf.NoSync,
+	}
+	err = s.replay(w, snapSeq)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error replaying memdb log: %w", err)
+	}
+	s.wal = w
+
+	log.Infof("memdb recovered %d posts from %s", len(s.posts), conf.Dir)
+	return s, nil
+}
+
+// Snapshot writes the current state to disk and truncates the log.
+// It does nothing for a store without a data directory.
+func (s *Store) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	return s.snapshot()
+}
+
+// Close takes a final snapshot and releases the log file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return nil
+	}
+	err := s.snapshot()
+	if err != nil {
+		log.Errorf("error taking memdb snapshot: %v", err)
+	}
+	cerr := s.wal.f.Close()
+	s.wal = nil
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// Операции журнала.
+const (
+	opAdd    = "add"
+	opUpdate = "update"
+	opDelete = "delete"
+
+	opAddAuthor    = "add_author"
+	opDeleteAuthor = "delete_author"
+
+	opAddTag    = "add_tag"
+	opDeleteTag = "delete_tag"
+
+	opAddComment    = "add_comment"
+	opUpdateComment = "update_comment"
+	opDeleteComment = "delete_comment"
+)
+
+// record - запись журнала упреждающей записи.
+type record struct {
+	Seq     uint64           `json:"seq"`
+	Op      string           `json:"op"`
+	Post    *storage.Post    `json:"post,omitempty"`
+	Author  *storage.Author  `json:"author,omitempty"`
+	Tag     *storage.Tag     `json:"tag,omitempty"`
+	Comment *storage.Comment `json:"comment,omitempty"`
+}
+
+// entities returns the number of entities the record carries.
+// Every complete record carries exactly one.
+func (rec *record) entities() int {
+	n := 0
+	if rec.Post != nil {
+		n++
+	}
+	if rec.Author != nil {
+		n++
+	}
+	if rec.Tag != nil {
+		n++
+	}
+	if rec.Comment != nil {
+		n++
+	}
+	return n
+}
+
+// snapshot - снимок состояния хранилища.
+type snapshot struct {
+	Seq    uint64         `json:"seq"` // последняя запись журнала, вошедшая в снимок
+	NextID int            `json:"next_id"`
+	Posts  []storage.Post `json:"posts"`
+
+	NextAuthorID int              `json:"next_author_id"`
+	Authors      []storage.Author `json:"authors"`
+
+	// Известные метки, в том числе без публикаций.
+	Tags []string `json:"tags,omitempty"`
+
+	NextCommentID int               `json:"next_comment_id,omitempty"`
+	Comments      []storage.Comment `json:"comments,omitempty"`
+}
+
+// wal is an append-only file of length-prefixed, checksummed records:
+//
+//	| length uint32 | crc32 uint32 | JSON payload |
+type wal struct {
+	f   logFile
+	dir string
+
+	seq           uint64 // номер последней записи
+	offset        int64  // конец последней целой записи
+	err           error  // журнал повреждён, запись невозможна
+	sinceSnapshot int    // записей после последнего снимка
+	snapshotEvery int
+	noSync        bool
+}
+
+// logFile is the part of *os.File the log uses.
+type logFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+	Stat() (os.FileInfo, error)
+}
+
+// append writes the record and syncs it. A record that failed to be
+// written or synced is cut off, so it is neither replayed after a
+// restart nor followed by the next record. If that fails as well,
+// the log refuses further records.
+func (w *wal) append(rec *record) error {
+	if w.err != nil {
+		return w.err
+	}
+	rec.Seq = w.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[8:], payload)
+
+	_, err = w.f.Write(buf)
+	if err == nil && !w.noSync {
+		err = w.f.Sync()
+	}
+	if err != nil {
+		w.rollback()
+		return err
+	}
+
+	w.offset += int64(len(buf))
+	w.seq = rec.Seq
+	w.sinceSnapshot++
+	return nil
+}
+
+// rollback cuts the log back to the last complete record.
+func (w *wal) rollback() {
+	err := w.f.Truncate(w.offset)
+	if err == nil {
+		_, err = w.f.Seek(w.offset, io.SeekStart)
+	}
+	if err != nil {
+		w.err = fmt.Errorf("memdb log is damaged at offset %d: %w", w.offset, err)
+		log.Error(w.err)
+	}
+}
+
+func (w *wal) needSnapshot() bool {
+	return w.sinceSnapshot >= w.snapshotEvery
+}
+
+// errTornRecord reports a record that was not completely written.
+var errTornRecord = errors.New("torn record")
+
+func readRecord(r io.Reader) (record, int, error) {
+	var rec record
+
+	var hdr [8]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err == io.EOF {
+		return rec, 0, io.EOF
+	}
+	if err != nil {
+		return rec, 0, errTornRecord
+	}
+
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	if size > maxRecordSize {
+		return rec, 0, errTornRecord
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return rec, 0, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return rec, 0, errTornRecord
+	}
+	err = json.Unmarshal(payload, &rec)
+	if err != nil || rec.entities() != 1 {
+		return rec, 0, errTornRecord
+	}
+
+	return rec, len(hdr) + int(size), nil
+}
+
+// replay applies the log records that are newer than the snapshot.
+// Everything after the first damaged record is cut off, so the next
+// append starts right after the last good one.
+func (s *Store) replay(w *wal, snapSeq uint64) error {
+	r := bufio.NewReader(w.f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err == errTornRecord {
+			info, serr := w.f.Stat()
+			if serr != nil {
+				return serr
+			}
+			log.Warnf("memdb log: discarding %d bytes of torn record at offset %d", info.Size()-offset, offset)
+			err = w.f.Truncate(offset)
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		offset += int64(n)
+		w.sinceSnapshot++
+		if rec.Seq <= snapSeq {
+			continue
+		}
+		s.apply(rec)
+		w.seq = rec.Seq
+	}
+
+	w.offset = offset
+	_, err := w.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (s *Store) loadSnapshot(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var snap snapshot
+	err = json.Unmarshal(data, &snap)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range snap.Posts {
+		s.posts[p.ID] = p
+		for _, t := range p.Tags {
+			s.tags[t] = true
+		}
+	}
+	for _, t := range snap.Tags {
+		s.tags[t] = true
+	}
+	for _, c := range snap.Comments {
+		s.comments[c.ID] = c
+	}
+	if snap.NextCommentID > s.nextCommentID {
+		s.nextCommentID = snap.NextCommentID
+	}
+	if snap.NextID > s.nextID {
+		s.nextID = snap.NextID
+	}
+	for _, a := range snap.Authors {
+		s.authors[a.ID] = a
+	}
+	if snap.NextAuthorID > s.nextAuthorID {
+		s.nextAuthorID = snap.NextAuthorID
+	}
+	return snap.Seq, nil
+}
+
+// snapshot atomically replaces the snapshot file and empties the log.
+// Records that survive a crash between the two steps are skipped on
+// replay by their sequence numbers. Must be called with s.mu held.
+func (s *Store) snapshot() error {
+	w := s.wal
+	snap := snapshot{
+		Seq:          w.seq,
+		NextID:       s.nextID,
+		NextAuthorID: s.nextAuthorID,
+
+		NextCommentID: s.nextCommentID,
+	}
+	for _, p := range s.posts {
+		snap.Posts = append(snap.Posts, p)
+	}
+	for _, a := range s.authors {
+		snap.Authors = append(snap.Authors, a)
+	}
+	for t := range s.tags {
+		snap.Tags = append(snap.Tags, t)
+	}
+	for _, c := range s.comments {
+		snap.Comments = append(snap.Comments, c)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(w.dir, snapshotFile+".tmp")
+	err = writeFileSync(tmp, data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(w.dir, snapshotFile))
+	if err != nil {
+		return err
+	}
+	err = syncDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	err = w.f.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	w.offset = 0
+	w.sinceSnapshot = 0
+
+	log.Infof("memdb snapshot taken at record %d", snap.Seq)
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,148 @@
+package memdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// Tenants - хранилища арендаторов, у каждого из которых свои карты
+// публикаций и авторов. Если задан каталог данных, хранилище
+// арендатора ведёт журнал и снимки в подкаталоге с его идентификатором.
+type Tenants struct {
+	conf Config
+
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+// NewTenants создаёт хранилища арендаторов. Если conf.Dir не пуст,
+// открываются хранилища всех арендаторов, найденных в каталоге.
+func NewTenants(conf Config) (*Tenants, error) {
+	t := Tenants{
+		conf:   conf,
+		stores: make(map[string]*Store),
+	}
+	if conf.Dir == "" {
+		return &t, nil
+	}
+
+	err := os.MkdirAll(conf.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || storage.CheckTenant(e.Name()) != nil {
+			continue
+		}
+		s, err := t.open(e.Name())
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.stores[e.Name()] = s
+	}
+	return &t, nil
+}
+
+// open создаёт хранилище арендатора.
+func (t *Tenants) open(id string) (*Store, error) {
+	if t.conf.Dir == "" {
+		return New(), nil
+	}
+	conf := t.conf
+	conf.Dir = filepath.Join(t.conf.Dir, id)
+	return Open(conf)
+}
+
+// Close закрывает хранилища всех арендаторов.
+func (t *Tenants) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	for _, s := range t.stores {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (t *Tenants) Tenants() ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]string, 0, len(t.stores))
+	for id := range t.stores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (t *Tenants) Tenant(id string) (storage.Interface, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stores[id]
+	if !ok {
+		return nil, storage.ErrEntryNotExist
+	}
+	return s, nil
+}
+
+func (t *Tenants) AddTenant(id string) error {
+	err := storage.CheckTenant(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.stores[id]; ok {
+		return storage.ErrEntryExists
+	}
+	s, err := t.open(id)
+	if err != nil {
+		log.Errorf("error adding tenant %s: %v", id, err)
+		return err
+	}
+	t.stores[id] = s
+
+	log.Infof("tenant %s added successfully", id)
+	return nil
+}
+
+func (t *Tenants) DeleteTenant(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.stores[id]
+	if !ok {
+		return storage.ErrEntryNotExist
+	}
+	delete(t.stores, id)
+	s.Close()
+	if t.conf.Dir != "" {
+		err := os.RemoveAll(filepath.Join(t.conf.Dir, id))
+		if err != nil {
+			log.Errorf("error deleting tenant %s: %v", id, err)
+			return err
+		}
+	}
+
+	log.Infof("tenant %s deleted successfully", id)
+	return nil
+}
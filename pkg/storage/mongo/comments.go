@@ -0,0 +1,182 @@
+package mongo
+
+import (
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"GoNews/pkg/storage"
+)
+
+// Comments keep the IDs of their post and parent comment. There are no
+// transactions, so the post and the parent are checked before the insert
+// and the replies of a deleted comment are found level by level.
+
+// Comments returns the comments of the post in the order they were added.
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	collection := s.client.Database(s.dbName).Collection("comments")
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cur, err := collection.Find(s.ctx, bson.D{{Key: "post_id", Value: postID}}, opts)
+	if err != nil {
+		log.Errorf("error requesting comments: %v", err)
+		return nil, err
+	}
+	defer cur.Close(s.ctx)
+
+	var comments []storage.Comment
+	for cur.Next(s.ctx) {
+		var c storage.Comment
+		err := cur.Decode(&c)
+		if err != nil {
+			log.Errorf("error requesting comments: %v", err)
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := cur.Err(); err != nil || len(comments) > 0 {
+		return comments, err
+	}
+
+	// A post without comments is told from a missing one.
+	_, err = s.Post(postID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	collection := s.client.Database(s.dbName).Collection("comments")
+	err := collection.FindOne(s.ctx, bson.D{{Key: "id", Value: id}}).Decode(&c)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting comment: %v", err)
+		return c, err
+	}
+
+	return c, nil
+}
+
+// AddComment adds the comment to the post. A comment with zero ID gets
+// the ID following the largest one in the collection. A reply must
+// belong to the same post as the comment it answers.
+func (s *Store) AddComment(comment storage.Comment) error {
+	_, err := s.Post(comment.PostID)
+	if errors.Is(err, storage.ErrEntryNotExist) {
+		log.Errorf("error adding comment: post with ID %v not found", comment.PostID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+	_, err = s.Author(comment.AuthorID)
+	if errors.Is(err, storage.ErrEntryNotExist) {
+		log.Errorf("error adding comment: author with ID %v not found", comment.AuthorID)
+		return err
+	}
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+	if comment.ParentID != 0 {
+		parent, err := s.Comment(comment.ParentID)
+		if err == nil && parent.PostID != comment.PostID {
+			err = storage.ErrEntryNotExist
+		}
+		if errors.Is(err, storage.ErrEntryNotExist) {
+			log.Errorf("error adding comment: comment with ID %v not found in post ID %v", comment.ParentID, comment.PostID)
+			return err
+		}
+		if err != nil {
+			log.Errorf("error adding comment: %v", err)
+			return err
+		}
+	}
+
+	collection := s.client.Database(s.dbName).Collection("comments")
+	id, err := insertWithID(s.ctx, collection, comment.ID, func(id int) interface{} {
+		comment.ID = id
+		return comment
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		log.Errorf("error adding comment: comment with ID %v already exists", id)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v added successfully", comment.ID)
+	return nil
+}
+
+// UpdateComment changes the text of the comment and the time
+// of the change; the other fields stay as they were.
+func (s *Store) UpdateComment(comment storage.Comment) error {
+	collection := s.client.Database(s.dbName).Collection("comments")
+	filter := bson.D{{Key: "id", Value: comment.ID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "content", Value: comment.Content},
+		{Key: "updated_at", Value: comment.UpdatedAt},
+	}}}
+	result, err := collection.UpdateOne(s.ctx, filter, update)
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		log.Errorf("error updating comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("comment ID:%v updated successfully", comment.ID)
+	return nil
+}
+
+// DeleteComment removes the comment together with the replies to it.
+func (s *Store) DeleteComment(comment storage.Comment) error {
+	collection := s.client.Database(s.dbName).Collection("comments")
+	result, err := collection.DeleteOne(s.ctx, bson.D{{Key: "id", Value: comment.ID}})
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		log.Errorf("error deleting comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	// The comment is gone at this point, so a failed cleanup leaves
+	// orphaned replies behind rather than failing the deletion.
+	parents := []interface{}{comment.ID}
+	for len(parents) > 0 {
+		filter := bson.D{{Key: "parent_id", Value: bson.D{{Key: "$in", Value: parents}}}}
+		replies, err := collection.Distinct(s.ctx, "id", filter)
+		if err == nil {
+			_, err = collection.DeleteMany(s.ctx, filter)
+		}
+		if err != nil {
+			log.Errorf("error deleting replies to comment ID %v: %v", comment.ID, err)
+			break
+		}
+		parents = replies
+	}
+
+	log.Infof("comment ID:%v deleted successfully", comment.ID)
+	return nil
+}
+
+// deleteComments removes the comments of the post.
+func (s *Store) deleteComments(postID int) error {
+	collection := s.client.Database(s.dbName).Collection("comments")
+	_, err := collection.DeleteMany(s.ctx, bson.D{{Key: "post_id", Value: postID}})
+	return err
+}
@@ -0,0 +1,35 @@
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+
+	"GoNews/pkg/storage"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{storage.ErrEntryNotExist, false},
+		{mongo.ErrNoDocuments, false},
+		{mongo.CommandError{Code: 11000}, false},
+		{mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}, true},
+		{mongo.CommandError{Labels: []string{"NetworkError"}}, true},
+		{mongo.CommandError{Labels: []string{"RetryableWriteError"}}, true},
+		{topology.ServerSelectionError{Wrapped: errors.New("no servers")}, true},
+	}
+	for _, tt := range tests {
+		if got := Transient(tt.err); got != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.want, got)
+		}
+	}
+	if !Unsent(topology.ServerSelectionError{}) || Unsent(mongo.CommandError{Labels: []string{"NetworkError"}}) {
+		t.Error("expected only server selection errors to be unsent")
+	}
+}
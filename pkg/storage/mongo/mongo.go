@@ -3,6 +3,7 @@ package mongo
 import (
 	"GoNews/pkg/storage"
 	"context"
+	"errors"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
@@ -14,20 +15,26 @@ import (
 type Store struct {
 	client *mongo.Client
 	dbName string
+	bus    *storage.Bus
+	ctx    context.Context // request the store is bound to, or context.Background
 }
 
 func New(conf Config) (*Store, error) {
-	s := Store{
-		dbName: conf.DBName,
-	}
-
 	opt := conf.Options()
 	client, err := mongo.Connect(context.Background(), opt)
 	if err != nil {
 		return nil, err
 	}
+	return open(client, conf.DBName)
+}
 
-	s.client = client
+// open prepares the collections of the database dbName.
+func open(client *mongo.Client, dbName string) (*Store, error) {
+	s := Store{
+		client: client,
+		dbName: dbName,
+		ctx:    context.Background(),
+	}
 
 	// Create the posts collection in advance if not exist.
 	collExists, err := collectionExists(s.client.Database(s.dbName), "posts")
@@ -46,6 +53,22 @@ func New(conf Config) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = s.createUniqueIndexOnID("authors")
+	if err != nil {
+		return nil, err
+	}
+	err = s.createUniqueIndex("tags", "name")
+	if err != nil {
+		return nil, err
+	}
+	err = s.createUniqueIndexOnID("comments")
+	if err != nil {
+		return nil, err
+	}
+	err = s.createIndex("comments", "post_id")
+	if err != nil {
+		return nil, err
+	}
 
 	return &s, nil
 }
@@ -58,13 +81,45 @@ func (s *Store) Close() {
 	s.client.Disconnect(context.Background())
 }
 
+// Bind returns the store serving the request ctx, whose queries
+// end when the request is cancelled.
+func (s *Store) Bind(ctx context.Context) storage.Interface {
+	b := *s
+	b.ctx = ctx
+	return &b
+}
+
+// SetBus sets the bus post changes are published to.
+// It must be called before the store is used.
+func (s *Store) SetBus(bus *storage.Bus) {
+	s.bus = bus
+}
+
+// AddPost adds the post. A post with zero ID gets the ID
+// following the largest one in the collection.
 func (s *Store) AddPost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	err := s.addTags(post.Tags)
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
 	collection := s.client.Database(s.dbName).Collection("posts")
-	_, err := collection.InsertOne(context.Background(), post)
+	id, err := insertWithID(s.ctx, collection, post.ID, func(id int) interface{} {
+		post.ID = id
+		return post
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		log.Errorf("error adding post: post with ID %v already exists", id)
+		return storage.ErrEntryExists
+	}
 	if err != nil {
 		log.Errorf("error adding post: %v", err)
 		return err
 	}
+	for _, typ := range storage.CreateEvents(post) {
+		s.bus.Publish(typ, post)
+	}
 
 	log.Infof("post ID:%v added successfully", post.ID)
 	return nil
@@ -72,15 +127,16 @@ func (s *Store) AddPost(post storage.Post) error {
 
 func (s *Store) Posts() ([]storage.Post, error) {
 	collection := s.client.Database(s.dbName).Collection("posts")
-	cur, err := collection.Find(context.Background(), bson.D{})
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cur, err := collection.Find(s.ctx, bson.D{}, opts)
 	if err != nil {
 		log.Errorf("error requesting posts: %v", err)
 		return nil, err
 	}
-	defer cur.Close(context.Background())
+	defer cur.Close(s.ctx)
 
 	var posts []storage.Post
-	for cur.Next(context.Background()) {
+	for cur.Next(s.ctx) {
 		var p storage.Post
 		err := cur.Decode(&p)
 		if err != nil {
@@ -94,7 +150,72 @@ func (s *Store) Posts() ([]storage.Post, error) {
 	return posts, cur.Err()
 }
 
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	collection := s.client.Database(s.dbName).Collection("posts")
+	filter := bson.D{{Key: "id", Value: id}}
+	err := collection.FindOne(s.ctx, filter).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return p, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting post: %v", err)
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	filter := bson.D{}
+	if f.AuthorID != 0 {
+		filter = append(filter, bson.E{Key: "author_id", Value: f.AuthorID})
+	}
+	if f.PublishedUntil != 0 {
+		filter = append(filter, bson.E{Key: "published_at", Value: bson.D{
+			{Key: "$gt", Value: 0},
+			{Key: "$lte", Value: f.PublishedUntil},
+		}})
+	}
+	if tags := storage.NormalizeTags(f.Tags); len(tags) > 0 {
+		filter = append(filter, bson.E{Key: "tags", Value: bson.D{{Key: "$all", Value: tags}}})
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "published_at", Value: -1}, {Key: "id", Value: -1}}).
+		SetSkip(int64(f.Offset))
+	if f.Limit > 0 {
+		opts.SetLimit(int64(f.Limit))
+	}
+
+	collection := s.client.Database(s.dbName).Collection("posts")
+	cur, err := collection.Find(s.ctx, filter, opts)
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+	defer cur.Close(s.ctx)
+
+	var posts []storage.Post
+	for cur.Next(s.ctx) {
+		var p storage.Post
+		err := cur.Decode(&p)
+		if err != nil {
+			log.Errorf("error requesting posts: %v", err)
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, cur.Err()
+}
+
 func (s *Store) UpdatePost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	err := s.addTags(post.Tags)
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
 	collection := s.client.Database(s.dbName).Collection("posts")
 	filter := bson.D{{Key: "id", Value: post.ID}}
 	update := bson.D{{Key: "$set", Value: bson.M{
@@ -104,17 +225,21 @@ func (s *Store) UpdatePost(post storage.Post) error {
 		"author_name":  post.AuthorName,
 		"created_at":   post.CreatedAt,
 		"published_at": post.PublishedAt,
+		"tags":         post.Tags,
 	}}}
-	result, err := collection.UpdateOne(context.Background(), filter, update)
+	// The previous document tells an update from a publication.
+	var old storage.Post
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err = collection.FindOneAndUpdate(s.ctx, filter, update, opts).Decode(&old)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Errorf("error updating post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
 	if err != nil {
 		log.Errorf("error updating post: %v", err)
 		return err
 	}
-
-	if result.ModifiedCount == 0 {
-		log.Errorf("error updating post: post with ID %v not found", post.ID)
-		return storage.ErrEntryNotExist
-	}
+	s.bus.Publish(storage.UpdateEvent(old, post), post)
 
 	log.Infof("post ID:%v updated successfully", post.ID)
 	return nil
@@ -123,24 +248,167 @@ func (s *Store) UpdatePost(post storage.Post) error {
 func (s *Store) DeletePost(post storage.Post) error {
 	collection := s.client.Database(s.dbName).Collection("posts")
 	filter := bson.D{{Key: "id", Value: post.ID}}
-	result, err := collection.DeleteOne(context.Background(), filter)
+	var old storage.Post
+	err := collection.FindOneAndDelete(s.ctx, filter).Decode(&old)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
 	if err != nil {
 		log.Errorf("error deleting post: %v", err)
 		return err
 	}
+	// The post is gone at this point, so a failed cleanup leaves
+	// orphaned comments behind rather than failing the deletion.
+	err = s.deleteComments(post.ID)
+	if err != nil {
+		log.Errorf("error deleting comments of post ID %v: %v", post.ID, err)
+	}
+	s.bus.Publish(storage.EventDeleted, old)
+
+	log.Infof("post ID:%v deleted successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	collection := s.client.Database(s.dbName).Collection("authors")
+	opts := options.Find().SetSort(bson.D{{Key: "id", Value: 1}})
+	cur, err := collection.Find(s.ctx, bson.D{}, opts)
+	if err != nil {
+		log.Errorf("error requesting authors: %v", err)
+		return nil, err
+	}
+	defer cur.Close(s.ctx)
+
+	var authors []storage.Author
+	for cur.Next(s.ctx) {
+		var a storage.Author
+		err := cur.Decode(&a)
+		if err != nil {
+			log.Errorf("error requesting authors: %v", err)
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+
+	return authors, cur.Err()
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	collection := s.client.Database(s.dbName).Collection("authors")
+	filter := bson.D{{Key: "id", Value: id}}
+	err := collection.FindOne(s.ctx, filter).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return a, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting author: %v", err)
+		return a, err
+	}
+
+	return a, nil
+}
+
+// AddAuthor adds the author. An author with zero ID gets the ID
+// following the largest one in the collection.
+func (s *Store) AddAuthor(author storage.Author) error {
+	collection := s.client.Database(s.dbName).Collection("authors")
+	id, err := insertWithID(s.ctx, collection, author.ID, func(id int) interface{} {
+		author.ID = id
+		return author
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		log.Errorf("error adding author: author with ID %v already exists", id)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v added successfully", author.ID)
+	return nil
+}
+
+// insertWithID inserts the document built by doc for the given ID.
+// A zero ID is replaced with the one following the largest ID in the
+// collection; if a concurrent insert takes that ID first, the next
+// one is tried. It returns the ID of the document.
+func insertWithID(ctx context.Context, collection *mongo.Collection, id int, doc func(id int) interface{}) (int, error) {
+	assign := id == 0
+	for {
+		if assign {
+			var last struct {
+				ID int `bson:"id"`
+			}
+			opts := options.FindOne().SetSort(bson.D{{Key: "id", Value: -1}})
+			err := collection.FindOne(ctx, bson.D{}, opts).Decode(&last)
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				return 0, err
+			}
+			id = last.ID + 1
+		}
+
+		_, err := collection.InsertOne(ctx, doc(id))
+		if assign && mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		return id, err
+	}
+}
+
+// DeleteAuthor removes the author. Authors of existing posts
+// cannot be removed.
+func (s *Store) DeleteAuthor(author storage.Author) error {
+	posts := s.client.Database(s.dbName).Collection("posts")
+	cnt, err := posts.CountDocuments(s.ctx, bson.D{{Key: "author_id", Value: author.ID}})
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+	if cnt > 0 {
+		log.Errorf("error deleting author: author ID %v has posts", author.ID)
+		return storage.ErrEntryInUse
+	}
+	comments := s.client.Database(s.dbName).Collection("comments")
+	cnt, err = comments.CountDocuments(s.ctx, bson.D{{Key: "author_id", Value: author.ID}})
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+	if cnt > 0 {
+		log.Errorf("error deleting author: author ID %v has comments", author.ID)
+		return storage.ErrEntryInUse
+	}
 
+	collection := s.client.Database(s.dbName).Collection("authors")
+	result, err := collection.DeleteOne(s.ctx, bson.D{{Key: "id", Value: author.ID}})
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
 	if result.DeletedCount == 0 {
-		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		log.Errorf("error deleting author: author with ID %v not found", author.ID)
 		return storage.ErrEntryNotExist
 	}
 
-	log.Infof("post ID:%v deleted successfully", post.ID)
+	log.Infof("author ID:%v deleted successfully", author.ID)
 	return nil
 }
 
 // CreateUniqueIndexOnID creates a unique index on the id field if not exists.
 func (s *Store) CreateUniqueIndexOnID() error {
-	collection := s.client.Database(s.dbName).Collection("posts")
+	return s.createUniqueIndexOnID("posts")
+}
+
+func (s *Store) createUniqueIndexOnID(collName string) error {
+	return s.createUniqueIndex(collName, "id")
+}
+
+// createUniqueIndex creates a unique index on the field if not exists.
+func (s *Store) createUniqueIndex(collName, field string) error {
+	collection := s.client.Database(s.dbName).Collection(collName)
 	cur, err := collection.Indexes().List(context.Background())
 	if err != nil {
 		return err
@@ -154,7 +422,7 @@ func (s *Store) CreateUniqueIndexOnID() error {
 			return err
 		}
 		// Mongo automatically names the index on the "id" as "id_1".
-		if index["name"] == "id_1" {
+		if index["name"] == field+"_1" {
 			return nil
 		}
 	}
@@ -163,7 +431,7 @@ func (s *Store) CreateUniqueIndexOnID() error {
 	}
 
 	_, err = collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "id", Value: 1}},
+		Keys:    bson.D{{Key: field, Value: 1}},
 		Options: options.Index().SetUnique(true),
 	})
 	if err != nil {
@@ -173,6 +441,16 @@ func (s *Store) CreateUniqueIndexOnID() error {
 	return nil
 }
 
+// createIndex creates an index on the field if not exists.
+func (s *Store) createIndex(collName, field string) error {
+	collection := s.client.Database(s.dbName).Collection(collName)
+	// Creating an index that already exists does nothing.
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: field, Value: 1}},
+	})
+	return err
+}
+
 func collectionExists(db *mongo.Database, collName string) (bool, error) {
 	names, err := db.ListCollectionNames(context.Background(), bson.D{})
 	if err != nil {
@@ -2,17 +2,15 @@ package mongo
 
 import (
 	"context"
-	"errors"
 	"io"
-	"reflect"
 	"testing"
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 
 	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/storagetest"
 )
 
 func mongoConf() Config {
@@ -34,305 +32,123 @@ func storageConnect() (*Store, error) {
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, storage.ErrDBNotResponding
 	}
 
 	return db, nil
 }
 
-// restoreDB restores the original state of DB for further testing.
-func restoreDB(db *Store) error {
-	collection := db.client.Database(db.dbName).Collection("posts")
-	return collection.Drop(context.Background())
-}
-
-func TestStore_AddPost(t *testing.T) {
-	db, err := storageConnect()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
-		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
-		}
-	}
-
-	collection := db.client.Database(db.dbName).Collection("posts")
-	postCnt, err := collection.CountDocuments(context.Background(), bson.M{})
+// available reports whether a local MongoDB instance responds,
+// waiting a few seconds instead of the default server selection timeout.
+func available() bool {
+	conf := mongoConf()
+	opts := conf.Options().SetServerSelectionTimeout(2 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		t.Fatalf("unexpected error counting post in DB: %v", err)
-	}
-	if postCnt != int64(len(storage.TestPosts)) {
-		t.Errorf("expected %d posts in DB, but got %d", len(storage.TestPosts), postCnt)
+		return false
 	}
+	defer client.Disconnect(context.Background())
+	return client.Ping(ctx, nil) == nil
 }
 
-func TestStore_AddPost_duplicatedID(t *testing.T) {
-	db, err := storageConnect()
+// restoreDB restores the original state of DB for further testing:
+// no posts, tags or comments and only the authors of the test posts.
+func restoreDB(db *Store) error {
+	ctx := context.Background()
+	err := db.client.Database(db.dbName).Collection("posts").Drop(ctx)
 	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
-		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
-		}
-	}
-
-	dupPost := storage.TestPosts[0]
-	err = db.AddPost(dupPost)
-	if !mongo.IsDuplicateKeyError(err) {
-		t.Errorf("expected error inserting document with duplicate ID, got %v", err)
+		return err
 	}
-}
-
-func TestStore_Posts(t *testing.T) {
-	db, err := storageConnect()
+	err = db.client.Database(db.dbName).Collection("authors").Drop(ctx)
 	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
-		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
-		}
+		return err
 	}
-
-	collection := db.client.Database(db.dbName).Collection("posts")
-	postCnt, err := collection.CountDocuments(context.Background(), bson.M{})
+	err = db.client.Database(db.dbName).Collection("tags").Drop(ctx)
 	if err != nil {
-		t.Fatalf("unexpected error counting post in DB: %v", err)
-	}
-	if postCnt != int64(len(storage.TestPosts)) {
-		t.Fatalf("expected %d posts in DB, but got %d", len(storage.TestPosts), postCnt)
+		return err
 	}
-
-	posts, err := db.Posts()
+	err = db.client.Database(db.dbName).Collection("comments").Drop(ctx)
 	if err != nil {
-		t.Errorf("unexpected error: %v", err)
-	}
-	postCnt = int64(len(posts))
-	if postCnt != int64(len(storage.TestPosts)) {
-		t.Errorf("expected %d posts, but got %d posts", len(storage.TestPosts), postCnt)
-	}
-	if !reflect.DeepEqual(posts, storage.TestPosts) {
-		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts)
+		return err
 	}
-}
-
-func TestStore_UpdatePost_postExists(t *testing.T) {
-	db, err := storageConnect()
+	// Dropping a collection drops its indexes too.
+	err = db.CreateUniqueIndexOnID()
 	if err != nil {
-		t.Fatal(err)
+		return err
 	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
-		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
-		}
-	}
-
-	collection := db.client.Database(db.dbName).Collection("posts")
-	postCnt, err := collection.CountDocuments(context.Background(), bson.M{})
+	err = db.createUniqueIndexOnID("authors")
 	if err != nil {
-		t.Fatalf("unexpected error counting post in DB: %v", err)
-	}
-	if postCnt != int64(len(storage.TestPosts)) {
-		t.Fatalf("expected %d posts in DB, but got %d", len(storage.TestPosts), postCnt)
+		return err
 	}
-
-	targetPost := storage.TestPosts[0]
-	targetPost.Title = "Updated title"
-	targetPost.Content = "Updated content"
-	targetPost.AuthorID = 3
-	targetPost.AuthorName = "Travis"
-	targetPost.CreatedAt = time.Now().Unix()
-	targetPost.PublishedAt = time.Now().Add(time.Hour).Unix()
-
-	err = db.UpdatePost(targetPost)
+	err = db.createUniqueIndex("tags", "name")
 	if err != nil {
-		t.Errorf("unexpected error updating post: %v", err)
+		return err
 	}
-
-	var updatedPost storage.Post
-	collection = db.client.Database(db.dbName).Collection("posts")
-	filter := bson.D{{Key: "id", Value: targetPost.ID}}
-	err = collection.FindOne(context.Background(), filter).Decode(&updatedPost)
+	err = db.createUniqueIndexOnID("comments")
 	if err != nil {
-		t.Errorf("unexpected error: %v", err)
+		return err
 	}
-
-	if !reflect.DeepEqual(updatedPost, targetPost) {
-		t.Errorf("updated post do not match target post. Expected: %+v, Got: %+v", targetPost, updatedPost)
-	}
-}
-
-func TestStore_UpdatePost_postNotExist(t *testing.T) {
-	db, err := storageConnect()
+	err = db.createIndex("comments", "post_id")
 	if err != nil {
-		t.Fatal(err)
+		return err
 	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
+	for _, a := range storage.TestAuthors {
+		err := db.AddAuthor(a)
 		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
+			return err
 		}
 	}
-
-	targetPost := storage.Post{}
-	targetPost.ID = 999999
-	targetPost.Title = "Updated title"
-	targetPost.Content = "Updated content"
-	targetPost.AuthorID = 3
-	targetPost.AuthorName = "Travis"
-	targetPost.CreatedAt = time.Now().Unix()
-	targetPost.PublishedAt = time.Now().Add(time.Hour).Unix()
-
-	err = db.UpdatePost(targetPost)
-	if !errors.Is(err, storage.ErrEntryNotExist) {
-		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
-	}
+	return nil
 }
 
-func TestStore_DeletePost_postExists(t *testing.T) {
-	db, err := storageConnect()
-	if err != nil {
-		t.Fatal(err)
+// TestStore runs the storage conformance suite when a local
+// MongoDB instance is available.
+func TestStore(t *testing.T) {
+	if !available() {
+		t.Skip("mongo is not available")
 	}
 
-	t.Cleanup(func() {
-		err := restoreDB(db)
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		db, err := storageConnect()
 		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
+			t.Fatal(err)
 		}
-
-		db.Close()
-	})
-
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
+		err = restoreDB(db)
 		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
+			t.Fatalf("unexpected error restoring DB: %v", err)
 		}
-	}
 
-	collection := db.client.Database(db.dbName).Collection("posts")
-	postCnt, err := collection.CountDocuments(context.Background(), bson.M{})
-	if err != nil {
-		t.Fatalf("unexpected error counting post in DB: %v", err)
-	}
-	if postCnt != int64(len(storage.TestPosts)) {
-		t.Fatalf("expected %d posts in DB, but got %d", len(storage.TestPosts), postCnt)
-	}
-
-	for _, post := range storage.TestPosts {
-		err := db.DeletePost(post)
-		if err != nil {
-			t.Errorf("unexpected error: %v", err)
-		}
-		postsRemain, err := db.Posts()
-		if err != nil {
-			t.Fatalf("unexpected error retrieving posts: %v", err)
-		}
-		for _, remPost := range postsRemain {
-			if remPost.ID == post.ID {
-				t.Errorf("post ID:%v wasn't deleted from DB", post.ID)
+		t.Cleanup(func() {
+			err := restoreDB(db)
+			if err != nil {
+				t.Errorf("unexpected error restoring DB: %v", err)
 			}
-		}
-	}
 
-	collection = db.client.Database(db.dbName).Collection("posts")
-	postCnt, err = collection.CountDocuments(context.Background(), bson.M{})
-	if err != nil {
-		t.Fatalf("unexpected error counting post in DB: %v", err)
-	}
-	if postCnt > 0 {
-		t.Errorf("expected %d posts in DB, but got %d", len(storage.TestPosts), postCnt)
-	}
-}
+			db.Close()
+		})
 
-func TestStore_DeletePost_postNotExist(t *testing.T) {
-	db, err := storageConnect()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Cleanup(func() {
-		err := restoreDB(db)
-		if err != nil {
-			t.Errorf("unexpected error clearing posts table: %v", err)
-		}
-
-		db.Close()
+		return db
 	})
+}
 
-	for _, tp := range storage.TestPosts {
-		err := db.AddPost(tp)
-		if err != nil {
-			t.Fatalf("unexpected error adding post: %v", err)
-		}
+// TestTenants runs the tenant conformance suite when a local
+// MongoDB instance is available.
+func TestTenants(t *testing.T) {
+	if !available() {
+		t.Skip("mongo is not available")
 	}
 
-	nonExistentPost := storage.Post{ID: 999999}
-	err = db.DeletePost(nonExistentPost)
-	if !errors.Is(err, storage.ErrEntryNotExist) {
-		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
+	tenants, err := NewTenants(mongoConf())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
+	t.Cleanup(tenants.Close)
+	storagetest.RunTenants(t, tenants)
 }
 
 func init() {
 	log.SetOutput(io.Discard)
-	db, _ := storageConnect()
-	restoreDB(db)
 }
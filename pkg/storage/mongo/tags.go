@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"GoNews/pkg/storage"
+)
+
+// Posts keep their tag names in the tags array field. The tags
+// collection lists every known tag, including the unused ones.
+
+// addTags adds the tags missing from the tags collection.
+func (s *Store) addTags(tags []string) error {
+	collection := s.client.Database(s.dbName).Collection("tags")
+	for _, name := range tags {
+		filter := bson.D{{Key: "name", Value: name}}
+		update := bson.D{{Key: "$setOnInsert", Value: filter}}
+		_, err := collection.UpdateOne(s.ctx, filter, update, options.Update().SetUpsert(true))
+		// A concurrent upsert of the same tag may win the race.
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	collection := s.client.Database(s.dbName).Collection("tags")
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := collection.Find(s.ctx, bson.D{}, opts)
+	if err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+	defer cur.Close(s.ctx)
+
+	var tags []storage.Tag
+	for cur.Next(s.ctx) {
+		var t storage.Tag
+		err := cur.Decode(&t)
+		if err != nil {
+			log.Errorf("error requesting tags: %v", err)
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err := cur.Err(); err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+
+	counts, err := s.tagCounts()
+	if err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+	for i := range tags {
+		tags[i].Posts = counts[tags[i].Name]
+	}
+	return tags, nil
+}
+
+// tagCounts returns the number of posts with each tag.
+func (s *Store) tagCounts() (map[string]int, error) {
+	collection := s.client.Database(s.dbName).Collection("posts")
+	pipeline := mongo.Pipeline{
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "posts", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	cur, err := collection.Aggregate(s.ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(s.ctx)
+
+	counts := make(map[string]int)
+	for cur.Next(s.ctx) {
+		var c struct {
+			Name  string `bson:"_id"`
+			Posts int    `bson:"posts"`
+		}
+		err := cur.Decode(&c)
+		if err != nil {
+			return nil, err
+		}
+		counts[c.Name] = c.Posts
+	}
+	return counts, cur.Err()
+}
+
+func (s *Store) AddTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	collection := s.client.Database(s.dbName).Collection("tags")
+	_, err := collection.InsertOne(s.ctx, bson.D{{Key: "name", Value: tag.Name}})
+	if mongo.IsDuplicateKeyError(err) {
+		log.Errorf("error adding tag: tag %q already exists", tag.Name)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q added successfully", tag.Name)
+	return nil
+}
+
+// DeleteTag removes the tag. Tags of existing posts cannot be removed.
+func (s *Store) DeleteTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	posts := s.client.Database(s.dbName).Collection("posts")
+	cnt, err := posts.CountDocuments(s.ctx, bson.D{{Key: "tags", Value: tag.Name}})
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+	if cnt > 0 {
+		log.Errorf("error deleting tag: tag %q has posts", tag.Name)
+		return storage.ErrEntryInUse
+	}
+
+	collection := s.client.Database(s.dbName).Collection("tags")
+	result, err := collection.DeleteOne(s.ctx, bson.D{{Key: "name", Value: tag.Name}})
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		log.Errorf("error deleting tag: tag %q not found", tag.Name)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("tag %q deleted successfully", tag.Name)
+	return nil
+}
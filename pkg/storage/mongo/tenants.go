@@ -0,0 +1,163 @@
+package mongo
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"GoNews/pkg/storage"
+)
+
+// Tenants keeps every tenant in its own database named
+// <DBName>_<tenant>. The tenant stores share one client, so they
+// are closed only together with Tenants.
+type Tenants struct {
+	client *mongo.Client
+	prefix string
+
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+func NewTenants(conf Config) (*Tenants, error) {
+	client, err := mongo.Connect(context.Background(), conf.Options())
+	if err != nil {
+		return nil, err
+	}
+	t := Tenants{
+		client: client,
+		prefix: conf.DBName + "_",
+		stores: make(map[string]*Store),
+	}
+	return &t, nil
+}
+
+func (t *Tenants) Ping() error {
+	return t.client.Ping(context.Background(), nil)
+}
+
+func (t *Tenants) Close() {
+	t.client.Disconnect(context.Background())
+}
+
+// databases returns the tenant IDs of the existing tenant databases.
+// A database exists once it has a collection.
+func (t *Tenants) databases() ([]string, error) {
+	filter := bson.D{{Key: "name", Value: bson.D{{Key: "$regex", Value: "^" + regexp.QuoteMeta(t.prefix)}}}}
+	names, err := t.client.ListDatabaseNames(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, name := range names {
+		id := strings.TrimPrefix(name, t.prefix)
+		if storage.CheckTenant(id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (t *Tenants) exists(id string) (bool, error) {
+	ids, err := t.databases()
+	if err != nil {
+		return false, err
+	}
+	for _, tid := range ids {
+		if tid == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *Tenants) Tenants() ([]string, error) {
+	ids, err := t.databases()
+	if err != nil {
+		log.Errorf("error requesting tenants: %v", err)
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (t *Tenants) Tenant(id string) (storage.Interface, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.stores[id]; ok {
+		return s, nil
+	}
+	ok, err := t.exists(id)
+	if err != nil {
+		log.Errorf("error opening tenant %s: %v", id, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, storage.ErrEntryNotExist
+	}
+	s, err := open(t.client, t.prefix+id)
+	if err != nil {
+		log.Errorf("error opening tenant %s: %v", id, err)
+		return nil, err
+	}
+	t.stores[id] = s
+	return s, nil
+}
+
+// AddTenant creates the tenant database with its collections and indexes.
+func (t *Tenants) AddTenant(id string) error {
+	err := storage.CheckTenant(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ok, err := t.exists(id)
+	if err != nil {
+		log.Errorf("error adding tenant %s: %v", id, err)
+		return err
+	}
+	if ok {
+		return storage.ErrEntryExists
+	}
+	s, err := open(t.client, t.prefix+id)
+	if err != nil {
+		log.Errorf("error adding tenant %s: %v", id, err)
+		return err
+	}
+	t.stores[id] = s
+
+	log.Infof("tenant %s added successfully", id)
+	return nil
+}
+
+// DeleteTenant drops the tenant database.
+func (t *Tenants) DeleteTenant(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ok, err := t.exists(id)
+	if err != nil {
+		log.Errorf("error deleting tenant %s: %v", id, err)
+		return err
+	}
+	if !ok {
+		return storage.ErrEntryNotExist
+	}
+	delete(t.stores, id)
+	err = t.client.Database(t.prefix + id).Drop(context.Background())
+	if err != nil {
+		log.Errorf("error deleting tenant %s: %v", id, err)
+		return err
+	}
+
+	log.Infof("tenant %s deleted successfully", id)
+	return nil
+}
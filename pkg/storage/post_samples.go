@@ -47,3 +47,10 @@ var TestPosts = []Post{
 		PublishedAt: 1644069000, // 2022-02-05 12:00:00
 	},
 }
+
+// TestAuthors - авторы публикаций TestPosts.
+var TestAuthors = []Author{
+	{ID: 1, Name: "Mark"},
+	{ID: 2, Name: "Tom"},
+	{ID: 3, Name: "Travis"},
+}
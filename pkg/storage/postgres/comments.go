@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// commentColumns are the columns of a storage.Comment in field order.
+const commentColumns = `
+			id,
+			post_id,
+			COALESCE(parent_id, 0),
+			author_id,
+			content,
+			created_at,
+			updated_at
+`
+
+// Comments returns the comments of the post in the order they were added.
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	ctx := s.ctx
+	db := s.reader()
+	rows, err := db.Query(ctx, `
+		SELECT`+commentColumns+`
+		FROM comments
+		WHERE post_id = $1
+		ORDER BY id
+	`, postID)
+	if err != nil {
+		log.Errorf("error requesting comments: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []storage.Comment
+	for rows.Next() {
+		var c storage.Comment
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.AuthorID, &c.Content, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			log.Errorf("error requesting comments: %v", err)
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil || len(comments) > 0 {
+		return comments, err
+	}
+
+	// A post without comments is told from a missing one.
+	var exists bool
+	err = db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)
+	`, postID).Scan(&exists)
+	if err != nil {
+		log.Errorf("error requesting comments: %v", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrEntryNotExist
+	}
+	return nil, nil
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	err := s.reader().QueryRow(s.ctx, `
+		SELECT`+commentColumns+`
+		FROM comments
+		WHERE id = $1
+	`, id).Scan(&c.ID, &c.PostID, &c.ParentID, &c.AuthorID, &c.Content, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting comment: %v", err)
+		return c, err
+	}
+
+	return c, nil
+}
+
+// AddComment adds the comment to the post. A missing post, parent or
+// author is reported by the foreign keys, and a parent of another post is
+// filtered out by the insert itself; both are storage.ErrEntryNotExist.
+func (s *Store) AddComment(comment storage.Comment) error {
+	defer s.wrote()
+	var commentID int
+	err := s.db.QueryRow(s.ctx, `
+		INSERT INTO comments (post_id, parent_id, author_id, content, created_at, updated_at)
+		SELECT $1::BIGINT, NULLIF($2::BIGINT, 0), $3::BIGINT, $4::TEXT, $5::BIGINT, $6::BIGINT
+		WHERE $2::BIGINT = 0 OR EXISTS (
+			SELECT 1 FROM comments WHERE id = $2::BIGINT AND post_id = $1::BIGINT
+		)
+		RETURNING id
+	`,
+		comment.PostID,
+		comment.ParentID,
+		comment.AuthorID,
+		comment.Content,
+		comment.CreatedAt,
+		comment.UpdatedAt,
+	).Scan(&commentID)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation) {
+		log.Errorf("error adding comment: post ID %v, comment ID %v or author ID %v not found", comment.PostID, comment.ParentID, comment.AuthorID)
+		return storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v added successfully", commentID)
+	return nil
+}
+
+// UpdateComment changes the text of the comment and the time
+// of the change; the other fields stay as they were.
+func (s *Store) UpdateComment(comment storage.Comment) error {
+	defer s.wrote()
+	result, err := s.db.Exec(s.ctx, `
+		UPDATE comments
+		SET
+			content = $2,
+			updated_at = $3
+		WHERE id = $1
+	`,
+		comment.ID,
+		comment.Content,
+		comment.UpdatedAt,
+	)
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		log.Errorf("error updating comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("comment ID:%v updated successfully", comment.ID)
+	return nil
+}
+
+// DeleteComment removes the comment. The replies to it are removed
+// by the cascading foreign key.
+func (s *Store) DeleteComment(comment storage.Comment) error {
+	defer s.wrote()
+	result, err := s.db.Exec(s.ctx, `
+		DELETE FROM comments
+		WHERE id = $1
+	`,
+		comment.ID,
+	)
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		log.Errorf("error deleting comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("comment ID:%v deleted successfully", comment.ID)
+	return nil
+}
@@ -2,7 +2,11 @@ package postgres
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,10 +15,51 @@ type Config struct {
 	Host     string
 	Port     string
 	DBName   string
+	// Schema, if set, is the only schema on the search path,
+	// so that the store works with the tables of that schema.
+	Schema string
+
+	// Replicas lists read replicas as host:port. They share the
+	// credentials and database name of the primary.
+	Replicas []string
+	// ReadYourWrites is how long reads go to the primary after a write,
+	// so that a client sees its own changes despite replication lag.
+	ReadYourWrites time.Duration
+	// HealthCheck is the interval between replica health checks.
+	// Zero means DefaultHealthCheck.
+	HealthCheck time.Duration
+	// MaxConns caps the connections of the primary pool and of every
+	// replica pool. Zero means the pgxpool default.
+	MaxConns int
 }
 
+// DefaultHealthCheck is the default interval between replica health checks.
+const DefaultHealthCheck = 5 * time.Second
+
 func (c *Config) ConString() string {
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s", c.User, c.Password, c.Host, c.Port, c.DBName)
+	s := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", c.User, c.Password, c.Host, c.Port, c.DBName)
+	params := url.Values{}
+	if c.Schema != "" {
+		params.Set("search_path", c.Schema)
+	}
+	if c.MaxConns > 0 {
+		params.Set("pool_max_conns", strconv.Itoa(c.MaxConns))
+	}
+	if len(params) > 0 {
+		s += "?" + params.Encode()
+	}
+	return s
+}
+
+// ReplicaConString returns the connection string of the replica at addr.
+func (c *Config) ReplicaConString(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("replica %q: %w", addr, err)
+	}
+	r := *c
+	r.Host, r.Port = host, port
+	return r.ConString(), nil
 }
 
 func (c Config) String() string {
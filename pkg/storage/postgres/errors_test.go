@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"GoNews/pkg/storage"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{pgx.ErrNoRows, false},
+		{storage.ErrEntryNotExist, false},
+		{&pgconn.PgError{Code: foreignKeyViolation}, false},
+		{&pgconn.PgError{Code: "08006"}, true},
+		{&pgconn.PgError{Code: "40001"}, true},
+		{&pgconn.PgError{Code: "57P01"}, true},
+		{fmt.Errorf("query: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "read", Err: fmt.Errorf("connection reset by peer")}, true},
+	}
+	for _, tt := range tests {
+		if got := Transient(tt.err); got != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.want, got)
+		}
+	}
+}
@@ -2,15 +2,47 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 
 	"GoNews/pkg/storage"
 )
 
+// SQLSTATEs of constraint errors.
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+// Store is a postgres storage. Stores returned by Bind share
+// the connections and serve the requests they are bound to.
 type Store struct {
-	db *pgxpool.Pool
+	*conn
+	ctx context.Context // request the store is bound to, or context.Background
+}
+
+// conn holds the connections shared by the bound stores.
+type conn struct {
+	db  *pgxpool.Pool // primary
+	bus *storage.Bus
+
+	replicas []*replica
+	next     uint32        // round robin counter
+	ryw      time.Duration // read-your-writes window
+	quit     chan struct{}
+	done     sync.WaitGroup
+
+	mu     sync.Mutex
+	writes map[string]time.Time // last write of every caller
+	swept  time.Time
 }
 
 func New(constr string) (*Store, error) {
@@ -19,22 +51,53 @@ func New(constr string) (*Store, error) {
 		return nil, err
 	}
 	s := Store{
-		db: db,
+		conn: &conn{db: db},
+		ctx:  context.Background(),
 	}
 	return &s, nil
 }
 
+// Bind returns the store serving the request ctx. Its queries end
+// when the request is cancelled, and its reads follow the caller
+// of the request and storage.WithPrimary.
+func (s *Store) Bind(ctx context.Context) storage.Interface {
+	return &Store{conn: s.conn, ctx: ctx}
+}
+
 func (s *Store) Ping() error {
 	return s.db.Ping(context.Background())
 }
 
 func (s *Store) Close() {
+	if s.quit != nil {
+		close(s.quit)
+		s.done.Wait()
+	}
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
 	s.db.Close()
 }
 
+// SetBus sets the bus post changes are published to.
+// It must be called before the store is used.
+func (s *Store) SetBus(bus *storage.Bus) {
+	s.bus = bus
+}
+
 func (s *Store) AddPost(post storage.Post) error {
+	defer s.wrote()
+	post.Tags = storage.NormalizeTags(post.Tags)
+	ctx := s.ctx
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	var postID int
-	err := s.db.QueryRow(context.Background(), `
+	err = tx.QueryRow(ctx, `
 		INSERT INTO posts (author_id, title, content, created_at, published_at)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
@@ -45,17 +108,27 @@ func (s *Store) AddPost(post storage.Post) error {
 		post.CreatedAt,
 		post.PublishedAt,
 	).Scan(&postID)
+	if err == nil {
+		err = setTags(ctx, tx, postID, post.Tags)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
 	if err != nil {
 		log.Errorf("error adding post: %v", err)
 		return err
 	}
+	post.ID = postID
+	for _, typ := range storage.CreateEvents(post) {
+		s.bus.Publish(typ, post)
+	}
 
 	log.Infof("post ID:%v added successfully", postID)
 	return nil
 }
 
 func (s *Store) Posts() ([]storage.Post, error) {
-	rows, err := s.db.Query(context.Background(), `
+	rows, err := s.reader().Query(s.ctx, `
 		SELECT
 			p.id,
 			p.title,
@@ -63,10 +136,12 @@ func (s *Store) Posts() ([]storage.Post, error) {
 			p.author_id,
 			a.name,
 			p.created_at,
-			p.published_at
+			p.published_at,
+			`+postTags+`
 		FROM posts AS p
 		JOIN authors AS a
 		ON p.author_id = a.id
+		ORDER BY p.id
 	`)
 	if err != nil {
 		log.Errorf("error requesting posts: %v", err)
@@ -84,11 +159,13 @@ func (s *Store) Posts() ([]storage.Post, error) {
 			&p.AuthorName,
 			&p.CreatedAt,
 			&p.PublishedAt,
+			&p.Tags,
 		)
 		if err != nil {
 			log.Errorf("error requesting posts: %v", err)
 			return nil, err
 		}
+		p.Tags = storage.NormalizeTags(p.Tags)
 		posts = append(posts, p)
 	}
 
@@ -96,8 +173,144 @@ func (s *Store) Posts() ([]storage.Post, error) {
 	return posts, rows.Err()
 }
 
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	err := s.reader().QueryRow(s.ctx, `
+		SELECT
+			p.id,
+			p.title,
+			p.content,
+			p.author_id,
+			a.name,
+			p.created_at,
+			p.published_at,
+			`+postTags+`
+		FROM posts AS p
+		JOIN authors AS a
+		ON p.author_id = a.id
+		WHERE p.id = $1
+	`, id).Scan(
+		&p.ID,
+		&p.Title,
+		&p.Content,
+		&p.AuthorID,
+		&p.AuthorName,
+		&p.CreatedAt,
+		&p.PublishedAt,
+		&p.Tags,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting post: %v", err)
+		return p, err
+	}
+	p.Tags = storage.NormalizeTags(p.Tags)
+
+	return p, nil
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.AuthorID != 0 {
+		args = append(args, f.AuthorID)
+		where = append(where, fmt.Sprintf("p.author_id = $%d", len(args)))
+	}
+	if f.PublishedUntil != 0 {
+		args = append(args, f.PublishedUntil)
+		where = append(where, fmt.Sprintf("p.published_at > 0 AND p.published_at <= $%d", len(args)))
+	}
+	if tags := storage.NormalizeTags(f.Tags); len(tags) > 0 {
+		args = append(args, tags, len(tags))
+		where = append(where, fmt.Sprintf(`p.id IN (
+			SELECT pt.post_id
+			FROM post_tags AS pt
+			JOIN tags AS t
+			ON pt.tag_id = t.id
+			WHERE t.name = ANY($%d)
+			GROUP BY pt.post_id
+			HAVING COUNT(*) = $%d
+		)`, len(args)-1, len(args)))
+	}
+	query := `
+		SELECT
+			p.id,
+			p.title,
+			p.content,
+			p.author_id,
+			a.name,
+			p.created_at,
+			p.published_at,
+			` + postTags + `
+		FROM posts AS p
+		JOIN authors AS a
+		ON p.author_id = a.id
+	`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY p.published_at DESC, p.id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if f.Offset > 0 {
+		args = append(args, f.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := s.reader().Query(s.ctx, query, args...)
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []storage.Post
+	for rows.Next() {
+		var p storage.Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.AuthorID,
+			&p.AuthorName,
+			&p.CreatedAt,
+			&p.PublishedAt,
+			&p.Tags,
+		)
+		if err != nil {
+			log.Errorf("error requesting posts: %v", err)
+			return nil, err
+		}
+		p.Tags = storage.NormalizeTags(p.Tags)
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
 func (s *Store) UpdatePost(post storage.Post) error {
-	result, err := s.db.Exec(context.Background(), `
+	defer s.wrote()
+	post.Tags = storage.NormalizeTags(post.Tags)
+	ctx := s.ctx
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// The previous publication time tells an update from a publication.
+	var old storage.Post
+	err = tx.QueryRow(ctx, `
+		WITH old AS (
+			SELECT published_at FROM posts WHERE id = $1 FOR UPDATE
+		)
 		UPDATE posts
 		SET
 			title = $2,
@@ -105,7 +318,9 @@ func (s *Store) UpdatePost(post storage.Post) error {
 			author_id = $4,
 			created_at = $5,
 			published_at = $6
+		FROM old
 		WHERE id = $1
+		RETURNING old.published_at
 	`,
 		post.ID,
 		post.Title,
@@ -113,36 +328,135 @@ func (s *Store) UpdatePost(post storage.Post) error {
 		post.AuthorID,
 		post.CreatedAt,
 		post.PublishedAt,
-	)
+	).Scan(&old.PublishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Errorf("error updating post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
+	if err == nil {
+		err = setTags(ctx, tx, post.ID, post.Tags)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
 	if err != nil {
 		log.Errorf("error updating post: %v", err)
 		return err
 	}
-	if result.RowsAffected() == 0 {
-		log.Errorf("error updating post: post with ID %v not found", post.ID)
-		return storage.ErrEntryNotExist
-	}
+	s.bus.Publish(storage.UpdateEvent(old, post), post)
 
 	log.Infof("post ID:%v updated successfully", post.ID)
 	return nil
 }
 
 func (s *Store) DeletePost(post storage.Post) error {
-	result, err := s.db.Exec(context.Background(), `
+	defer s.wrote()
+	var old storage.Post
+	err := s.db.QueryRow(s.ctx, `
 		DELETE FROM posts
 		WHERE id = $1
+		RETURNING id, title, content, author_id, created_at, published_at
 	`,
 		post.ID,
-	)
+	).Scan(&old.ID, &old.Title, &old.Content, &old.AuthorID, &old.CreatedAt, &old.PublishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
 	if err != nil {
 		log.Errorf("error deleting post: %v", err)
 		return err
 	}
+	s.bus.Publish(storage.EventDeleted, old)
+
+	log.Infof("post ID:%v deleted successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	rows, err := s.reader().Query(s.ctx, `
+		SELECT id, name FROM authors ORDER BY id
+	`)
+	if err != nil {
+		log.Errorf("error requesting authors: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []storage.Author
+	for rows.Next() {
+		var a storage.Author
+		err := rows.Scan(&a.ID, &a.Name)
+		if err != nil {
+			log.Errorf("error requesting authors: %v", err)
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+
+	return authors, rows.Err()
+}
+
+// Author returns the author with the given ID.
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	err := s.reader().QueryRow(s.ctx, `
+		SELECT id, name FROM authors WHERE id = $1
+	`, id).Scan(&a.ID, &a.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting author: %v", err)
+		return a, err
+	}
+
+	return a, nil
+}
+
+func (s *Store) AddAuthor(author storage.Author) error {
+	defer s.wrote()
+	var authorID int
+	err := s.db.QueryRow(s.ctx, `
+		INSERT INTO authors (name)
+		VALUES ($1)
+		RETURNING id
+	`,
+		author.Name,
+	).Scan(&authorID)
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v added successfully", authorID)
+	return nil
+}
+
+// DeleteAuthor removes the author. Authors of existing posts and comments
+// are kept by the foreign keys, which is reported as storage.ErrEntryInUse.
+func (s *Store) DeleteAuthor(author storage.Author) error {
+	defer s.wrote()
+	result, err := s.db.Exec(s.ctx, `
+		DELETE FROM authors
+		WHERE id = $1
+	`,
+		author.ID,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		log.Errorf("error deleting author: author ID %v has posts or comments", author.ID)
+		return storage.ErrEntryInUse
+	}
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
 	if result.RowsAffected() == 0 {
-		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		log.Errorf("error deleting author: author with ID %v not found", author.ID)
 		return storage.ErrEntryNotExist
 	}
 
-	log.Infof("post ID:%v deleted successfully", post.ID)
+	log.Infof("author ID:%v deleted successfully", author.ID)
 	return nil
 }
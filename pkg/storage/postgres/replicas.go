@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// replica is a read replica of the primary.
+type replica struct {
+	addr    string
+	pool    *pgxpool.Pool
+	healthy int32 // 1 if the last health check succeeded
+}
+
+// Open connects to the primary and the replicas of conf and brings
+// the schema up to date. Replicas are connected lazily, so an
+// unavailable replica does not prevent start; it receives reads
+// once a health check succeeds.
+func Open(conf Config) (*Store, error) {
+	s, err := New(conf.ConString())
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(s.db)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("error migrating postgres schema: %w", err)
+	}
+	s.ryw = conf.ReadYourWrites
+
+	for _, addr := range conf.Replicas {
+		r, err := connectReplica(conf, addr)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.replicas = append(s.replicas, r)
+	}
+	if len(s.replicas) == 0 {
+		return s, nil
+	}
+
+	interval := conf.HealthCheck
+	if interval <= 0 {
+		interval = DefaultHealthCheck
+	}
+	s.checkReplicas(interval)
+	s.quit = make(chan struct{})
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-ticker.C:
+				s.checkReplicas(interval)
+			}
+		}
+	}()
+	return s, nil
+}
+
+func connectReplica(conf Config, addr string) (*replica, error) {
+	constr, err := conf.ReplicaConString(addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := pgxpool.ParseConfig(constr)
+	if err != nil {
+		return nil, err
+	}
+	pc.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), pc)
+	if err != nil {
+		return nil, err
+	}
+	return &replica{addr: addr, pool: pool}, nil
+}
+
+// checkReplicas pings every replica and marks it healthy or not.
+func (s *Store) checkReplicas(timeout time.Duration) {
+	for _, r := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.pool.Ping(ctx)
+		cancel()
+
+		var healthy int32
+		if err == nil {
+			healthy = 1
+		}
+		if atomic.SwapInt32(&r.healthy, healthy) != healthy {
+			if err != nil {
+				log.Errorf("replica %s is unhealthy: %v", r.addr, err)
+			} else {
+				log.Infof("replica %s is healthy", r.addr)
+			}
+		}
+	}
+}
+
+// reader returns the pool for a read-only query: the next healthy
+// replica in round robin, or the primary if there is none, the request
+// needs the primary or its caller wrote within the read-your-writes
+// window.
+func (s *Store) reader() *pgxpool.Pool {
+	n := len(s.replicas)
+	if n == 0 || storage.PrimaryFrom(s.ctx) {
+		return s.db
+	}
+	caller := storage.CallerFrom(s.ctx)
+	s.mu.Lock()
+	last, ok := s.writes[caller]
+	s.mu.Unlock()
+	if ok && time.Since(last) < s.ryw {
+		return s.db
+	}
+	healthy := make([]*replica, 0, n)
+	for _, r := range s.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.db
+	}
+	i := atomic.AddUint32(&s.next, 1)
+	return healthy[int(i%uint32(len(healthy)))].pool
+}
+
+// wrote starts the read-your-writes window of the caller. Reads
+// of other callers keep going to the replicas.
+func (s *Store) wrote() {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writes == nil {
+		s.writes = make(map[string]time.Time)
+	}
+	s.writes[storage.CallerFrom(s.ctx)] = now
+	// Callers whose window has passed are forgotten.
+	if now.Sub(s.swept) > s.ryw {
+		for caller, t := range s.writes {
+			if now.Sub(t) >= s.ryw {
+				delete(s.writes, caller)
+			}
+		}
+		s.swept = now
+	}
+}
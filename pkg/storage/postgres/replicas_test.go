@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"GoNews/pkg/storage"
+)
+
+// lazyPool returns a pool that never connects unless queried.
+func lazyPool(t *testing.T, addr string) *pgxpool.Pool {
+	t.Helper()
+	conf := postgresConf()
+	constr, err := conf.ReplicaConString(addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc, err := pgxpool.ParseConfig(constr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pc.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), pc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestStore_reader(t *testing.T) {
+	s := &Store{conn: &conn{db: lazyPool(t, "primary:5432"), ryw: time.Minute}}
+	if s.reader() != s.db {
+		t.Error("expected reads to go to the primary without replicas")
+	}
+
+	a := &replica{addr: "a:5432", pool: lazyPool(t, "a:5432"), healthy: 1}
+	b := &replica{addr: "b:5432", pool: lazyPool(t, "b:5432"), healthy: 1}
+	c := &replica{addr: "c:5432", pool: lazyPool(t, "c:5432")}
+	s.replicas = []*replica{a, b, c}
+
+	seen := make(map[*pgxpool.Pool]int)
+	for i := 0; i < 6; i++ {
+		seen[s.reader()]++
+	}
+	if seen[a.pool] != 3 || seen[b.pool] != 3 {
+		t.Errorf("expected reads to alternate between healthy replicas, got %v", seen)
+	}
+
+	s.wrote()
+	if s.reader() != s.db {
+		t.Error("expected reads to go to the primary right after a write")
+	}
+	s.ryw = 0
+	if s.reader() == s.db {
+		t.Error("expected reads to go to a replica after the window")
+	}
+
+	a.healthy, b.healthy = 0, 0
+	if s.reader() != s.db {
+		t.Error("expected reads to go to the primary without healthy replicas")
+	}
+}
+
+func TestStore_readerCallers(t *testing.T) {
+	s := &Store{conn: &conn{db: lazyPool(t, "primary:5432"), ryw: time.Minute}}
+	s.replicas = []*replica{{addr: "a:5432", pool: lazyPool(t, "a:5432"), healthy: 1}}
+	alice := s.Bind(storage.WithCaller(context.Background(), "alice")).(*Store)
+	bob := s.Bind(storage.WithCaller(context.Background(), "bob")).(*Store)
+
+	alice.wrote()
+	if alice.reader() != s.db {
+		t.Error("expected the writer to read from the primary")
+	}
+	if bob.reader() == s.db {
+		t.Error("expected other callers to keep reading from replicas")
+	}
+
+	primary := bob.Bind(storage.WithPrimary(context.Background())).(*Store)
+	if primary.reader() != s.db {
+		t.Error("expected primary reads to go to the primary")
+	}
+}
+
+func TestConfig_ReplicaConString(t *testing.T) {
+	conf := Config{User: "u", Password: "p", Host: "primary", Port: "5432", DBName: "gonews"}
+	got, err := conf.ReplicaConString("replica:5434")
+	if err != nil || got != "postgres://u:p@replica:5434/gonews" {
+		t.Errorf("unexpected connection string %q, error %v", got, err)
+	}
+	if _, err := conf.ReplicaConString("replica"); err == nil {
+		t.Error("expected error for an address without port")
+	}
+}
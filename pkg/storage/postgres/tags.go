@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// postTags selects the tag names of the post p in order.
+const postTags = `ARRAY(
+				SELECT t.name
+				FROM post_tags AS pt
+				JOIN tags AS t
+				ON pt.tag_id = t.id
+				WHERE pt.post_id = p.id
+				ORDER BY t.name
+			)`
+
+// setTags replaces the tags of the post, creating missing ones.
+func setTags(ctx context.Context, tx pgx.Tx, postID int, tags []string) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM post_tags WHERE post_id = $1
+	`, postID)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tags (name)
+		SELECT unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING
+	`, tags)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2)
+	`, postID, tags)
+	return err
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	rows, err := s.reader().Query(s.ctx, `
+		SELECT t.name, COUNT(pt.post_id)
+		FROM tags AS t
+		LEFT JOIN post_tags AS pt
+		ON pt.tag_id = t.id
+		GROUP BY t.name
+		ORDER BY t.name
+	`)
+	if err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []storage.Tag
+	for rows.Next() {
+		var t storage.Tag
+		err := rows.Scan(&t.Name, &t.Posts)
+		if err != nil {
+			log.Errorf("error requesting tags: %v", err)
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *Store) AddTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	defer s.wrote()
+	_, err := s.db.Exec(s.ctx, `
+		INSERT INTO tags (name)
+		VALUES ($1)
+	`,
+		tag.Name,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		log.Errorf("error adding tag: tag %q already exists", tag.Name)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q added successfully", tag.Name)
+	return nil
+}
+
+// DeleteTag removes the tag. Tags of existing posts are kept
+// by the foreign key, which is reported as storage.ErrEntryInUse.
+func (s *Store) DeleteTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	defer s.wrote()
+	result, err := s.db.Exec(s.ctx, `
+		DELETE FROM tags
+		WHERE name = $1
+	`,
+		tag.Name,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+		log.Errorf("error deleting tag: tag %q has posts", tag.Name)
+		return storage.ErrEntryInUse
+	}
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		log.Errorf("error deleting tag: tag %q not found", tag.Name)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("tag %q deleted successfully", tag.Name)
+	return nil
+}
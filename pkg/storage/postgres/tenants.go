@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// SQLSTATEs of schema errors.
+const (
+	duplicateSchema   = "42P06"
+	invalidSchemaName = "3F000"
+)
+
+// schemaPrefix keeps tenant schemas apart from the public schema
+// and any other schemas of the database.
+const schemaPrefix = "tenant_"
+
+// DefaultTenantMaxConns caps the connections of every pool of a tenant
+// store unless Config.MaxConns is set. Tenant stores are never closed
+// while the tenant exists, so the default pool size of every tenant
+// would add up to more connections than the server allows.
+const DefaultTenantMaxConns = 2
+
+// Tenants keeps every tenant in its own schema of one database.
+// A tenant store has its own connection pool whose search path is
+// the tenant schema, so the queries of Store work unchanged. Each pool
+// of a tenant holds at most MaxConns connections of the config, or
+// DefaultTenantMaxConns if it is not set.
+type Tenants struct {
+	conf Config
+	db   *pgxpool.Pool // manages the schemas
+
+	mu     sync.Mutex
+	stores map[string]*Store
+}
+
+// OpenTenants connects to the database of conf. Tenant stores share
+// its credentials and replicas and are opened on first use.
+func OpenTenants(conf Config) (*Tenants, error) {
+	conf.Schema = ""
+	db, err := pgxpool.Connect(context.Background(), conf.ConString())
+	if err != nil {
+		return nil, err
+	}
+	t := Tenants{
+		conf:   conf,
+		db:     db,
+		stores: make(map[string]*Store),
+	}
+	return &t, nil
+}
+
+func (t *Tenants) Ping() error {
+	return t.db.Ping(context.Background())
+}
+
+// Close closes the tenant stores and the database connection.
+func (t *Tenants) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.stores {
+		s.Close()
+	}
+	t.db.Close()
+}
+
+func schemaOf(id string) string {
+	return pgx.Identifier{schemaPrefix + id}.Sanitize()
+}
+
+func schemaError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+func (t *Tenants) Tenants() ([]string, error) {
+	rows, err := t.db.Query(context.Background(), `
+		SELECT nspname
+		FROM pg_namespace
+		WHERE nspname LIKE $1
+		ORDER BY nspname
+	`, strings.ReplaceAll(schemaPrefix, "_", `\_`)+"%")
+	if err != nil {
+		log.Errorf("error requesting tenants: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			log.Errorf("error requesting tenants: %v", err)
+			return nil, err
+		}
+		ids = append(ids, strings.TrimPrefix(name, schemaPrefix))
+	}
+	return ids, rows.Err()
+}
+
+func (t *Tenants) Tenant(id string) (storage.Interface, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.stores[id]; ok {
+		return s, nil
+	}
+	if storage.CheckTenant(id) != nil {
+		return nil, storage.ErrEntryNotExist
+	}
+	var exists bool
+	err := t.db.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)
+	`, schemaPrefix+id).Scan(&exists)
+	if err != nil {
+		log.Errorf("error opening tenant %s: %v", id, err)
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrEntryNotExist
+	}
+
+	s, err := t.open(id)
+	if err != nil {
+		log.Errorf("error opening tenant %s: %v", id, err)
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens the store of the tenant schema; Open migrates it, so
+// the tables of a new schema are created here. The caller holds t.mu.
+func (t *Tenants) open(id string) (*Store, error) {
+	conf := t.conf
+	conf.Schema = schemaPrefix + id
+	if conf.MaxConns <= 0 {
+		conf.MaxConns = DefaultTenantMaxConns
+	}
+	s, err := Open(conf)
+	if err != nil {
+		return nil, err
+	}
+	t.stores[id] = s
+	return s, nil
+}
+
+// AddTenant creates the tenant schema and opens its store, which
+// creates the tables. If they cannot be created, the schema is dropped.
+func (t *Tenants) AddTenant(id string) error {
+	err := storage.CheckTenant(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ctx := context.Background()
+	_, err = t.db.Exec(ctx, "CREATE SCHEMA "+schemaOf(id))
+	if schemaError(err, duplicateSchema) {
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding tenant %s: %v", id, err)
+		return err
+	}
+	_, err = t.open(id)
+	if err != nil {
+		log.Errorf("error adding tenant %s: %v", id, err)
+		_, dropErr := t.db.Exec(ctx, "DROP SCHEMA "+schemaOf(id)+" CASCADE")
+		if dropErr != nil {
+			log.Errorf("error dropping schema of tenant %s: %v", id, dropErr)
+		}
+		return err
+	}
+
+	log.Infof("tenant %s added successfully", id)
+	return nil
+}
+
+// DeleteTenant drops the tenant schema with all its tables.
+func (t *Tenants) DeleteTenant(id string) error {
+	if storage.CheckTenant(id) != nil {
+		return storage.ErrEntryNotExist
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if s, ok := t.stores[id]; ok {
+		s.Close()
+		delete(t.stores, id)
+	}
+	_, err := t.db.Exec(context.Background(), "DROP SCHEMA "+schemaOf(id)+" CASCADE")
+	if schemaError(err, invalidSchemaName) {
+		return storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error deleting tenant %s: %v", id, err)
+		return err
+	}
+
+	log.Infof("tenant %s deleted successfully", id)
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package retry повторяет операции хранилища при временных ошибках БД.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// Policy задаёт правила повтора операций.
+type Policy struct {
+	MaxAttempts int           // число попыток, включая первую
+	Backoff     time.Duration // пауза перед второй попыткой, далее удваивается
+	MaxBackoff  time.Duration // максимальная пауза между попытками
+	// Общее время на операцию вместе с паузами. Повтор, который
+	// не укладывается в это время, не выполняется, чтобы ответить
+	// клиенту раньше, чем истечёт время ожидания запроса. Если
+	// у запроса есть свой срок (см. Bind), время ограничено и им.
+	MaxElapsed time.Duration
+
+	// Transient сообщает, может ли операция, завершившаяся ошибкой,
+	// выполниться при повторе. Идемпотентные операции - чтение
+	// и обновление публикации - повторяются при таких ошибках.
+	Transient func(error) bool
+	// Unsent сообщает, что ошибка возникла до отправки запроса в БД.
+	// Только при таких ошибках повторяются операции, повтор которых
+	// может изменить результат: создание и удаление.
+	// Если nil, такие операции не повторяются.
+	Unsent func(error) bool
+}
+
+// DefaultPolicy возвращает правила повтора по умолчанию
+// с заданной классификацией ошибок.
+func DefaultPolicy(transient, unsent func(error) bool) Policy {
+	return Policy{
+		MaxAttempts: 4,
+		Backoff:     50 * time.Millisecond,
+		MaxBackoff:  time.Second,
+		MaxElapsed:  3 * time.Second,
+		Transient:   transient,
+		Unsent:      unsent,
+	}
+}
+
+// Stats - статистика повторов.
+type Stats struct {
+	Retries   uint64 `json:"retries"`   // выполнено повторов
+	Recovered uint64 `json:"recovered"` // операций, успешных после повтора
+	Exhausted uint64 `json:"exhausted"` // операций, для которых повторы не помогли
+}
+
+// Store повторяет операции обёрнутого хранилища
+// при временных ошибках с экспоненциальной паузой.
+type Store struct {
+	storage.Interface
+	*state
+
+	ctx context.Context // запрос, который обслуживает хранилище
+}
+
+// state - правила и статистика, общие для Store и хранилищ,
+// привязанных к запросам.
+type state struct {
+	policy Policy
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New оборачивает хранилище db повтором операций.
+func New(db storage.Interface, policy Policy) *Store {
+	return &Store{
+		Interface: db,
+		state: &state{
+			policy: policy,
+			now:    time.Now,
+			sleep:  wait,
+		},
+		ctx: context.Background(),
+	}
+}
+
+// Bind привязывает к запросу обёрнутое хранилище. Повторы
+// прекращаются, если запрос отменён или не успеет завершиться
+// до своего срока.
+func (s *Store) Bind(ctx context.Context) storage.Interface {
+	return &Store{Interface: storage.Bind(s.Interface, ctx), state: s.state, ctx: ctx}
+}
+
+// wait ждёт d или отмены запроса ctx.
+func wait(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetBus передаёт шину событий обёрнутому хранилищу.
+func (s *Store) SetBus(bus *storage.Bus) {
+	if p, ok := s.Interface.(storage.Publisher); ok {
+		p.SetBus(bus)
+	}
+}
+
+// Stats возвращает статистику повторов.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// do выполняет операцию op, повторяя её при ошибках, после которых
+// повтор допустим: retryable для идемпотентных операций - Transient,
+// для остальных - Unsent.
+func (s *Store) do(op string, retryable func(error) bool, f func() error) error {
+	end := s.now().Add(s.policy.MaxElapsed)
+	if deadline, ok := s.ctx.Deadline(); ok && deadline.Before(end) {
+		end = deadline
+	}
+	delay := s.policy.Backoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			if attempt > 1 {
+				s.count(func(st *Stats) { st.Recovered++ })
+				log.Infof("%s succeeded after %d attempts", op, attempt)
+			}
+			return nil
+		}
+		if retryable == nil || !retryable(err) {
+			return err
+		}
+
+		// Пауза со случайным разбросом, чтобы клиенты,
+		// потерявшие соединение одновременно, не повторяли
+		// запросы тоже одновременно.
+		pause := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		if attempt >= s.policy.MaxAttempts || s.now().Add(pause).After(end) || s.ctx.Err() != nil {
+			s.count(func(st *Stats) { st.Exhausted++ })
+			log.Errorf("%s failed after %d attempts: %v", op, attempt, err)
+			return err
+		}
+		log.Warnf("%s failed (attempt %d), retrying in %v: %v", op, attempt, pause, err)
+		if s.sleep(s.ctx, pause) != nil {
+			s.count(func(st *Stats) { st.Exhausted++ })
+			log.Errorf("%s failed after %d attempts, request cancelled: %v", op, attempt, err)
+			return err
+		}
+		s.count(func(st *Stats) { st.Retries++ })
+
+		delay *= 2
+		if delay > s.policy.MaxBackoff {
+			delay = s.policy.MaxBackoff
+		}
+	}
+}
+
+func (s *Store) count(f func(*Stats)) {
+	s.mu.Lock()
+	f(&s.stats)
+	s.mu.Unlock()
+}
+
+func (s *Store) Posts() ([]storage.Post, error) {
+	var posts []storage.Post
+	err := s.do("Posts", s.policy.Transient, func() (err error) {
+		posts, err = s.Interface.Posts()
+		return err
+	})
+	return posts, err
+}
+
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	err := s.do("Post", s.policy.Transient, func() (err error) {
+		p, err = s.Interface.Post(id)
+		return err
+	})
+	return p, err
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	var posts []storage.Post
+	err := s.do("FilterPosts", s.policy.Transient, func() (err error) {
+		posts, err = s.Interface.FilterPosts(f)
+		return err
+	})
+	return posts, err
+}
+
+func (s *Store) AddPost(p storage.Post) error {
+	return s.do("AddPost", s.policy.Unsent, func() error {
+		return s.Interface.AddPost(p)
+	})
+}
+
+func (s *Store) UpdatePost(p storage.Post) error {
+	return s.do("UpdatePost", s.policy.Transient, func() error {
+		return s.Interface.UpdatePost(p)
+	})
+}
+
+// DeletePost повторяется только до отправки запроса: повтор
+// выполненного удаления сообщил бы, что публикации нет.
+func (s *Store) DeletePost(p storage.Post) error {
+	return s.do("DeletePost", s.policy.Unsent, func() error {
+		return s.Interface.DeletePost(p)
+	})
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	var authors []storage.Author
+	err := s.do("Authors", s.policy.Transient, func() (err error) {
+		authors, err = s.Interface.Authors()
+		return err
+	})
+	return authors, err
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	err := s.do("Author", s.policy.Transient, func() (err error) {
+		a, err = s.Interface.Author(id)
+		return err
+	})
+	return a, err
+}
+
+func (s *Store) AddAuthor(a storage.Author) error {
+	return s.do("AddAuthor", s.policy.Unsent, func() error {
+		return s.Interface.AddAuthor(a)
+	})
+}
+
+func (s *Store) DeleteAuthor(a storage.Author) error {
+	return s.do("DeleteAuthor", s.policy.Unsent, func() error {
+		return s.Interface.DeleteAuthor(a)
+	})
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	var tags []storage.Tag
+	err := s.do("Tags", s.policy.Transient, func() (err error) {
+		tags, err = s.Interface.Tags()
+		return err
+	})
+	return tags, err
+}
+
+func (s *Store) AddTag(t storage.Tag) error {
+	return s.do("AddTag", s.policy.Unsent, func() error {
+		return s.Interface.AddTag(t)
+	})
+}
+
+func (s *Store) DeleteTag(t storage.Tag) error {
+	return s.do("DeleteTag", s.policy.Unsent, func() error {
+		return s.Interface.DeleteTag(t)
+	})
+}
+
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	var comments []storage.Comment
+	err := s.do("Comments", s.policy.Transient, func() (err error) {
+		comments, err = s.Interface.Comments(postID)
+		return err
+	})
+	return comments, err
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	err := s.do("Comment", s.policy.Transient, func() (err error) {
+		c, err = s.Interface.Comment(id)
+		return err
+	})
+	return c, err
+}
+
+func (s *Store) AddComment(c storage.Comment) error {
+	return s.do("AddComment", s.policy.Unsent, func() error {
+		return s.Interface.AddComment(c)
+	})
+}
+
+func (s *Store) UpdateComment(c storage.Comment) error {
+	return s.do("UpdateComment", s.policy.Transient, func() error {
+		return s.Interface.UpdateComment(c)
+	})
+}
+
+// DeleteComment, как и DeletePost, повторяется только до отправки запроса.
+func (s *Store) DeleteComment(c storage.Comment) error {
+	return s.do("DeleteComment", s.policy.Unsent, func() error {
+		return s.Interface.DeleteComment(c)
+	})
+}
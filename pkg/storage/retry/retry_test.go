@@ -0,0 +1,174 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/memdb"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+var (
+	errTransient = errors.New("connection reset")
+	errUnsent    = errors.New("dial failed")
+)
+
+// flakyDB fails the first calls with the queued errors.
+type flakyDB struct {
+	*memdb.Store
+	errs  []error
+	calls int
+}
+
+func (db *flakyDB) fail() error {
+	db.calls++
+	if len(db.errs) == 0 {
+		return nil
+	}
+	err := db.errs[0]
+	db.errs = db.errs[1:]
+	return err
+}
+
+func (db *flakyDB) Posts() ([]storage.Post, error) {
+	if err := db.fail(); err != nil {
+		return nil, err
+	}
+	return db.Store.Posts()
+}
+
+func (db *flakyDB) AddPost(p storage.Post) error {
+	if err := db.fail(); err != nil {
+		return err
+	}
+	return db.Store.AddPost(p)
+}
+
+func newStore(errs ...error) (*Store, *flakyDB, *[]time.Duration) {
+	db := &flakyDB{Store: memdb.New(), errs: errs}
+	db.Store.AddAuthor(storage.Author{Name: "Mark"})
+	policy := DefaultPolicy(
+		func(err error) bool { return err == errTransient || err == errUnsent },
+		func(err error) bool { return err == errUnsent },
+	)
+	s := New(db, policy)
+
+	// A fake clock advanced by the pauses. It starts at the real
+	// time so that request deadlines can be compared with it.
+	now := time.Now()
+	var pauses []time.Duration
+	s.now = func() time.Time { return now }
+	s.sleep = func(_ context.Context, d time.Duration) error {
+		pauses = append(pauses, d)
+		now = now.Add(d)
+		return nil
+	}
+	return s, db, &pauses
+}
+
+func TestStore_retry(t *testing.T) {
+	s, db, pauses := newStore(errTransient, errTransient)
+	_, err := s.Posts()
+	if err != nil || db.calls != 3 {
+		t.Fatalf("expected success on the third call, got %v after %d calls", err, db.calls)
+	}
+	// Pauses grow exponentially with jitter.
+	p := *pauses
+	if len(p) != 2 || p[0] < 25*time.Millisecond || p[0] > 50*time.Millisecond || p[1] < 50*time.Millisecond || p[1] > 100*time.Millisecond {
+		t.Errorf("unexpected pauses %v", p)
+	}
+	if st := s.Stats(); st.Retries != 2 || st.Recovered != 1 || st.Exhausted != 0 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// Permanent errors are returned at once.
+	s, db, _ = newStore(storage.ErrEntryNotExist)
+	if _, err := s.Posts(); err != storage.ErrEntryNotExist || db.calls != 1 {
+		t.Errorf("expected ErrEntryNotExist after 1 call, got %v after %d calls", err, db.calls)
+	}
+}
+
+func TestStore_exhausted(t *testing.T) {
+	s, db, _ := newStore(errTransient, errTransient, errTransient, errTransient, errTransient)
+	if _, err := s.Posts(); err != errTransient || db.calls != 4 {
+		t.Errorf("expected the error after 4 calls, got %v after %d calls", err, db.calls)
+	}
+	if st := s.Stats(); st.Retries != 3 || st.Exhausted != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+
+	// Retries stop when the time budget is spent.
+	s, db, pauses := newStore(errTransient, errTransient, errTransient)
+	s.policy.MaxElapsed = 100 * time.Millisecond
+	s.policy.Backoff = 80 * time.Millisecond
+	if _, err := s.Posts(); err != errTransient || db.calls != 2 {
+		t.Errorf("expected the error after 2 calls, got %v after %d calls (pauses %v)", err, db.calls, *pauses)
+	}
+}
+
+func TestStore_deadline(t *testing.T) {
+	// Retries stop when the request would miss its deadline,
+	// long before the policy budget is spent.
+	s, db, pauses := newStore(errTransient, errTransient, errTransient)
+	s.policy.Backoff = 80 * time.Millisecond
+	ctx, cancel := context.WithDeadline(context.Background(), s.now().Add(100*time.Millisecond))
+	defer cancel()
+	if _, err := storage.Bind(s, ctx).Posts(); err != errTransient || db.calls != 2 {
+		t.Errorf("expected the error after 2 calls, got %v after %d calls (pauses %v)", err, db.calls, *pauses)
+	}
+
+	// A cancelled request is not retried.
+	s, db, _ = newStore(errTransient)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := storage.Bind(s, ctx).Posts(); err != errTransient || db.calls != 1 {
+		t.Errorf("expected the error after 1 call, got %v after %d calls", err, db.calls)
+	}
+
+	// A request cancelled during a pause stops waiting.
+	s, db, _ = newStore(errTransient, errTransient)
+	s.now, s.sleep = time.Now, wait
+	s.policy.Backoff = 2 * time.Second
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := storage.Bind(s, ctx).Posts(); err != errTransient || db.calls != 1 {
+		t.Errorf("expected the error after 1 call, got %v after %d calls", err, db.calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the pause to end with the request, waited %v", elapsed)
+	}
+
+	// Unbound operations keep the policy budget.
+	s, db, _ = newStore(errTransient, errTransient)
+	if _, err := s.Posts(); err != nil || db.calls != 3 {
+		t.Errorf("expected success after 3 calls, got %v after %d calls", err, db.calls)
+	}
+}
+
+func TestStore_nonIdempotent(t *testing.T) {
+	post := storage.Post{Title: "Title", Content: "Text", AuthorID: 1}
+
+	// A write that may have reached the database is not repeated.
+	s, db, _ := newStore(errTransient)
+	if err := s.AddPost(post); err != errTransient || db.calls != 1 {
+		t.Errorf("expected the error after 1 call, got %v after %d calls", err, db.calls)
+	}
+
+	s, db, _ = newStore(errUnsent)
+	if err := s.AddPost(post); err != nil || db.calls != 2 {
+		t.Errorf("expected success after 2 calls, got %v after %d calls", err, db.calls)
+	}
+	if posts, _ := db.Store.Posts(); len(posts) != 1 {
+		t.Errorf("expected 1 post, got %d", len(posts))
+	}
+}
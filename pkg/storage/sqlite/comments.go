@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+const commentColumns = `
+	id,
+	post_id,
+	COALESCE(parent_id, 0),
+	author_id,
+	content,
+	created_at,
+	updated_at
+`
+
+// Comments returns the comments of the post in the order they were added.
+func (s *Store) Comments(postID int) ([]storage.Comment, error) {
+	ctx := context.Background()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE post_id = ?
+		ORDER BY id
+	`, postID)
+	if err != nil {
+		log.Errorf("error requesting comments: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []storage.Comment
+	for rows.Next() {
+		var c storage.Comment
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.AuthorID, &c.Content, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			log.Errorf("error requesting comments: %v", err)
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil || len(comments) > 0 {
+		return comments, err
+	}
+
+	// A post without comments is told from a missing one.
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)
+	`, postID).Scan(&exists)
+	if err != nil {
+		log.Errorf("error requesting comments: %v", err)
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrEntryNotExist
+	}
+	return nil, nil
+}
+
+func (s *Store) Comment(id int) (storage.Comment, error) {
+	var c storage.Comment
+	err := s.db.QueryRowContext(context.Background(), `
+		SELECT `+commentColumns+`
+		FROM comments
+		WHERE id = ?
+	`, id).Scan(&c.ID, &c.PostID, &c.ParentID, &c.AuthorID, &c.Content, &c.CreatedAt, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting comment: %v", err)
+		return c, err
+	}
+
+	return c, nil
+}
+
+// AddComment adds the comment to the post. A comment with zero ID gets
+// the next free ID. A missing post, parent or author is reported by the
+// foreign keys, and a parent of another post is filtered out by the insert
+// itself; both are storage.ErrEntryNotExist.
+func (s *Store) AddComment(comment storage.Comment) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		INSERT INTO comments (id, post_id, parent_id, author_id, content, created_at, updated_at)
+		SELECT ?1, ?2, NULLIF(?3, 0), ?4, ?5, ?6, ?7
+		WHERE ?3 = 0 OR EXISTS (
+			SELECT 1 FROM comments WHERE id = ?3 AND post_id = ?2
+		)
+	`,
+		nullID(comment.ID),
+		comment.PostID,
+		comment.ParentID,
+		comment.AuthorID,
+		comment.Content,
+		comment.CreatedAt,
+		comment.UpdatedAt,
+	)
+	if constraint(err, sqlite3.ErrConstraintPrimaryKey) {
+		log.Errorf("error adding comment: comment with ID %v already exists", comment.ID)
+		return storage.ErrEntryExists
+	}
+	if constraint(err, sqlite3.ErrConstraintForeignKey) {
+		log.Errorf("error adding comment: post ID %v or author ID %v not found", comment.PostID, comment.AuthorID)
+		return storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+	if n == 0 {
+		log.Errorf("error adding comment: comment with ID %v not found in post ID %v", comment.ParentID, comment.PostID)
+		return storage.ErrEntryNotExist
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Errorf("error adding comment: %v", err)
+		return err
+	}
+
+	log.Infof("comment ID:%v added successfully", id)
+	return nil
+}
+
+// UpdateComment changes the text of the comment and the time
+// of the change; the other fields stay as they were.
+func (s *Store) UpdateComment(comment storage.Comment) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		UPDATE comments
+		SET
+			content = ?,
+			updated_at = ?
+		WHERE id = ?
+	`,
+		comment.Content,
+		comment.UpdatedAt,
+		comment.ID,
+	)
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("error updating comment: %v", err)
+		return err
+	}
+	if n == 0 {
+		log.Errorf("error updating comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("comment ID:%v updated successfully", comment.ID)
+	return nil
+}
+
+// DeleteComment removes the comment. The replies to it are removed
+// by the cascading foreign key.
+func (s *Store) DeleteComment(comment storage.Comment) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		DELETE FROM comments
+		WHERE id = ?
+	`,
+		comment.ID,
+	)
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("error deleting comment: %v", err)
+		return err
+	}
+	if n == 0 {
+		log.Errorf("error deleting comment: comment with ID %v not found", comment.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("comment ID:%v deleted successfully", comment.ID)
+	return nil
+}
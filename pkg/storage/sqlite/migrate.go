@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// migrations bring the schema up to date. Migration i sets the schema
+// version kept in PRAGMA user_version to i+1. Applied migrations must
+// never change; new ones are appended.
+var migrations = []string{
+	// 1: the tables of schema.sql.
+	`
+	CREATE TABLE authors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL
+	);
+
+	CREATE TABLE posts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		author_id INTEGER NOT NULL REFERENCES authors(id),
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		published_at INTEGER NOT NULL DEFAULT 0
+	);
+	`,
+	// 2: indexes for FilterPosts and author checks.
+	`
+	CREATE INDEX posts_published_at ON posts (published_at DESC, id DESC);
+	CREATE INDEX posts_author_id ON posts (author_id);
+	`,
+	// 3: tags of posts.
+	`
+	CREATE TABLE tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+
+	CREATE TABLE post_tags (
+		post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id),
+		PRIMARY KEY (post_id, tag_id)
+	);
+
+	CREATE INDEX post_tags_tag_id ON post_tags (tag_id);
+	`,
+	// 4: comments on posts.
+	`
+	CREATE TABLE comments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+		author_id INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX comments_post_id ON comments (post_id);
+	CREATE INDEX comments_parent_id ON comments (parent_id);
+	`,
+	// 5: authors of comments are kept by a foreign key. SQLite cannot add
+	// a constraint to a table, so the table is rebuilt. The new table
+	// refers to itself by its own name, which the rename updates, so
+	// dropping the old table does not cascade into the copied replies.
+	// Comments whose authors are gone get them back under a placeholder
+	// name rather than being lost.
+	`
+	PRAGMA defer_foreign_keys = ON;
+
+	INSERT INTO authors (id, name)
+	SELECT DISTINCT author_id, 'Deleted author'
+	FROM comments
+	WHERE author_id NOT IN (SELECT id FROM authors);
+
+	CREATE TABLE comments_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+		parent_id INTEGER REFERENCES comments_new(id) ON DELETE CASCADE,
+		author_id INTEGER NOT NULL REFERENCES authors(id),
+		content TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL DEFAULT 0
+	);
+
+	INSERT INTO comments_new SELECT * FROM comments;
+	DROP TABLE comments;
+	ALTER TABLE comments_new RENAME TO comments;
+
+	CREATE INDEX comments_post_id ON comments (post_id);
+	CREATE INDEX comments_parent_id ON comments (parent_id);
+	CREATE INDEX comments_author_id ON comments (author_id);
+	`,
+}
+
+// migrate applies the migrations the database has not seen yet,
+// each in its own transaction.
+func migrate(db *sql.DB) error {
+	ctx := context.Background()
+	var version int
+	err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, migrations[i])
+		if err == nil {
+			// PRAGMA does not accept parameters.
+			_, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		log.Infof("sqlite schema migrated to version %d", i+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,445 @@
+// Package sqlite stores posts, authors, tags and comments in an SQLite
+// database file, for single-node installs that do not run a database server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// options of every connection: foreign keys are checked, the journal
+// is written ahead so that readers do not block the writer, writers
+// wait for each other instead of failing, and transactions take the
+// write lock when they begin, so that a read followed by a write
+// cannot deadlock with another writer.
+const options = "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+const postColumns = `
+	p.id,
+	p.title,
+	p.content,
+	p.author_id,
+	a.name,
+	p.created_at,
+	p.published_at,
+	(
+		SELECT json_group_array(t.name)
+		FROM post_tags AS pt
+		JOIN tags AS t
+		ON pt.tag_id = t.id
+		WHERE pt.post_id = p.id
+	)
+`
+
+type Store struct {
+	db  *sql.DB
+	bus *storage.Bus
+}
+
+// New opens the database file at path, creating it if needed,
+// and migrates it to the current schema.
+func New(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path+"?"+options)
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Ping() error {
+	return s.db.PingContext(context.Background())
+}
+
+func (s *Store) Close() {
+	s.db.Close()
+}
+
+// SetBus sets the bus post changes are published to.
+// It must be called before the store is used.
+func (s *Store) SetBus(bus *storage.Bus) {
+	s.bus = bus
+}
+
+// constraint reports whether err violates the constraint with the given
+// extended code.
+func constraint(err error, code sqlite3.ErrNoExtended) bool {
+	var sqlErr sqlite3.Error
+	return errors.As(err, &sqlErr) && sqlErr.ExtendedCode == code
+}
+
+// nullID stores a zero ID as NULL, so that the database assigns one.
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// AddPost adds the post. A post with zero ID gets the next free ID.
+func (s *Store) AddPost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO posts (id, author_id, title, content, created_at, published_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		nullID(post.ID),
+		post.AuthorID,
+		post.Title,
+		post.Content,
+		post.CreatedAt,
+		post.PublishedAt,
+	)
+	if constraint(err, sqlite3.ErrConstraintPrimaryKey) {
+		log.Errorf("error adding post: post with ID %v already exists", post.ID)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err == nil {
+		err = setTags(ctx, tx, int(id), post.Tags)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Errorf("error adding post: %v", err)
+		return err
+	}
+	post.ID = int(id)
+	for _, typ := range storage.CreateEvents(post) {
+		s.bus.Publish(typ, post)
+	}
+
+	log.Infof("post ID:%v added successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Posts() ([]storage.Post, error) {
+	posts, err := s.queryPosts(`
+		SELECT ` + postColumns + `
+		FROM posts AS p
+		JOIN authors AS a
+		ON p.author_id = a.id
+		ORDER BY p.id
+	`)
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+
+	log.Infof("retrieved %d posts", len(posts))
+	return posts, nil
+}
+
+func (s *Store) Post(id int) (storage.Post, error) {
+	var p storage.Post
+	err := s.db.QueryRowContext(context.Background(), `
+		SELECT `+postColumns+`
+		FROM posts AS p
+		JOIN authors AS a
+		ON p.author_id = a.id
+		WHERE p.id = ?
+	`, id).Scan(
+		&p.ID,
+		&p.Title,
+		&p.Content,
+		&p.AuthorID,
+		&p.AuthorName,
+		&p.CreatedAt,
+		&p.PublishedAt,
+		(*tagList)(&p.Tags),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting post: %v", err)
+		return p, err
+	}
+
+	return p, nil
+}
+
+func (s *Store) FilterPosts(f storage.Filter) ([]storage.Post, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.AuthorID != 0 {
+		where = append(where, "p.author_id = ?")
+		args = append(args, f.AuthorID)
+	}
+	if f.PublishedUntil != 0 {
+		where = append(where, "p.published_at > 0 AND p.published_at <= ?")
+		args = append(args, f.PublishedUntil)
+	}
+	if tags := storage.NormalizeTags(f.Tags); len(tags) > 0 {
+		where = append(where, `p.id IN (
+			SELECT pt.post_id
+			FROM post_tags AS pt
+			JOIN tags AS t
+			ON pt.tag_id = t.id
+			WHERE t.name IN (?`+strings.Repeat(", ?", len(tags)-1)+`)
+			GROUP BY pt.post_id
+			HAVING COUNT(*) = ?
+		)`)
+		for _, t := range tags {
+			args = append(args, t)
+		}
+		args = append(args, len(tags))
+	}
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts AS p
+		JOIN authors AS a
+		ON p.author_id = a.id
+	`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY p.published_at DESC, p.id DESC"
+	// SQLite accepts OFFSET only after LIMIT; -1 means no limit.
+	limit := -1
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, limit, f.Offset)
+
+	posts, err := s.queryPosts(query, args...)
+	if err != nil {
+		log.Errorf("error requesting posts: %v", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (s *Store) queryPosts(query string, args ...interface{}) ([]storage.Post, error) {
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []storage.Post
+	for rows.Next() {
+		var p storage.Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.AuthorID,
+			&p.AuthorName,
+			&p.CreatedAt,
+			&p.PublishedAt,
+			(*tagList)(&p.Tags),
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+func (s *Store) UpdatePost(post storage.Post) error {
+	post.Tags = storage.NormalizeTags(post.Tags)
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	// The previous publication time tells an update from a publication.
+	var old storage.Post
+	err = tx.QueryRowContext(ctx, `
+		SELECT published_at FROM posts WHERE id = ?
+	`, post.ID).Scan(&old.PublishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Errorf("error updating post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE posts
+		SET
+			title = ?,
+			content = ?,
+			author_id = ?,
+			created_at = ?,
+			published_at = ?
+		WHERE id = ?
+	`,
+		post.Title,
+		post.Content,
+		post.AuthorID,
+		post.CreatedAt,
+		post.PublishedAt,
+		post.ID,
+	)
+	if err == nil {
+		err = setTags(ctx, tx, post.ID, post.Tags)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Errorf("error updating post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.UpdateEvent(old, post), post)
+
+	log.Infof("post ID:%v updated successfully", post.ID)
+	return nil
+}
+
+func (s *Store) DeletePost(post storage.Post) error {
+	var old storage.Post
+	err := s.db.QueryRowContext(context.Background(), `
+		DELETE FROM posts
+		WHERE id = ?
+		RETURNING id, title, content, author_id, created_at, published_at
+	`,
+		post.ID,
+	).Scan(&old.ID, &old.Title, &old.Content, &old.AuthorID, &old.CreatedAt, &old.PublishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Errorf("error deleting post: post with ID %v not found", post.ID)
+		return storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error deleting post: %v", err)
+		return err
+	}
+	s.bus.Publish(storage.EventDeleted, old)
+
+	log.Infof("post ID:%v deleted successfully", post.ID)
+	return nil
+}
+
+func (s *Store) Authors() ([]storage.Author, error) {
+	rows, err := s.db.QueryContext(context.Background(), `
+		SELECT id, name FROM authors ORDER BY id
+	`)
+	if err != nil {
+		log.Errorf("error requesting authors: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []storage.Author
+	for rows.Next() {
+		var a storage.Author
+		err := rows.Scan(&a.ID, &a.Name)
+		if err != nil {
+			log.Errorf("error requesting authors: %v", err)
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+
+	return authors, rows.Err()
+}
+
+func (s *Store) Author(id int) (storage.Author, error) {
+	var a storage.Author
+	err := s.db.QueryRowContext(context.Background(), `
+		SELECT id, name FROM authors WHERE id = ?
+	`, id).Scan(&a.ID, &a.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, storage.ErrEntryNotExist
+	}
+	if err != nil {
+		log.Errorf("error requesting author: %v", err)
+		return a, err
+	}
+
+	return a, nil
+}
+
+// AddAuthor adds the author. An author with zero ID gets the next free ID.
+func (s *Store) AddAuthor(author storage.Author) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		INSERT INTO authors (id, name)
+		VALUES (?, ?)
+	`,
+		nullID(author.ID),
+		author.Name,
+	)
+	if constraint(err, sqlite3.ErrConstraintPrimaryKey) {
+		log.Errorf("error adding author: author with ID %v already exists", author.ID)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Errorf("error adding author: %v", err)
+		return err
+	}
+
+	log.Infof("author ID:%v added successfully", id)
+	return nil
+}
+
+// DeleteAuthor removes the author. Authors of existing posts and comments
+// are kept by the foreign keys, which is reported as storage.ErrEntryInUse.
+func (s *Store) DeleteAuthor(author storage.Author) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		DELETE FROM authors
+		WHERE id = ?
+	`,
+		author.ID,
+	)
+	if constraint(err, sqlite3.ErrConstraintForeignKey) {
+		log.Errorf("error deleting author: author ID %v has posts or comments", author.ID)
+		return storage.ErrEntryInUse
+	}
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("error deleting author: %v", err)
+		return err
+	}
+	if n == 0 {
+		log.Errorf("error deleting author: author with ID %v not found", author.ID)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("author ID:%v deleted successfully", author.ID)
+	return nil
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+	"GoNews/pkg/storage/storagetest"
+)
+
+// newStore opens a store in a temporary file with the test authors.
+func newStore(t *testing.T) *Store {
+	t.Helper()
+	db, err := New(filepath.Join(t.TempDir(), "gonews.db"))
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	for _, a := range storage.TestAuthors {
+		err := db.AddAuthor(a)
+		if err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Interface {
+		return newStore(t)
+	})
+}
+
+func TestNew_migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gonews.db")
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	var version int
+	var mode string
+	db.db.QueryRow("PRAGMA user_version").Scan(&version)
+	db.db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+	if version != len(migrations) || mode != "wal" {
+		t.Errorf("expected schema version %d in WAL mode, got %d in %q mode", len(migrations), version, mode)
+	}
+	err = db.AddAuthor(storage.Author{Name: "Mark"})
+	if err != nil {
+		t.Fatalf("unexpected error adding author: %v", err)
+	}
+	db.Close()
+
+	// Reopening a migrated database keeps the data.
+	db, err = New(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	authors, err := db.Authors()
+	if err != nil || len(authors) != 1 {
+		t.Errorf("expected 1 author after reopening, got %+v and error %v", authors, err)
+	}
+	db.Close()
+
+	// A database from a newer build is refused.
+	db, _ = New(path)
+	db.db.ExecContext(context.Background(), "PRAGMA user_version = 100")
+	db.Close()
+	if _, err := New(path); err == nil {
+		t.Error("expected an error opening a database with a newer schema")
+	}
+}
+
+func TestNew_commentAuthors(t *testing.T) {
+	// A database at version 4 whose comment outlived its author.
+	path := filepath.Join(t.TempDir(), "gonews.db")
+	raw, err := sql.Open("sqlite3", path+"?"+options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:4] {
+		if _, err := raw.Exec(m); err != nil {
+			t.Fatalf("unexpected error applying migration: %v", err)
+		}
+	}
+	_, err = raw.Exec(`
+		PRAGMA user_version = 4;
+		INSERT INTO authors (id, name) VALUES (1, 'Mark'), (2, 'Tom');
+		INSERT INTO posts (id, author_id, title, content, created_at) VALUES (1, 1, 'T', 'C', 1);
+		INSERT INTO comments (id, post_id, author_id, content, created_at) VALUES (1, 1, 2, 'First', 1);
+		INSERT INTO comments (id, post_id, parent_id, author_id, content, created_at) VALUES (2, 1, 1, 3, 'Reply', 2);
+	`)
+	raw.Close()
+	if err != nil {
+		t.Fatalf("unexpected error filling database: %v", err)
+	}
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error migrating database: %v", err)
+	}
+	defer db.Close()
+	comments, err := db.Comments(1)
+	if err != nil || len(comments) != 2 {
+		t.Fatalf("expected 2 comments after migration, got %+v and error %v", comments, err)
+	}
+	if a, err := db.Author(3); err != nil || a.Name != "Deleted author" {
+		t.Errorf("expected a placeholder for the missing author, got %+v and error %v", a, err)
+	}
+	err = db.DeleteAuthor(storage.Author{ID: 2})
+	if !errors.Is(err, storage.ErrEntryInUse) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryInUse, err)
+	}
+
+	// Replies still go with the comment they answer.
+	err = db.DeleteComment(storage.Comment{ID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error deleting comment: %v", err)
+	}
+	if comments, _ := db.Comments(1); len(comments) != 0 {
+		t.Errorf("expected replies to be deleted, got %+v", comments)
+	}
+}
+
+func init() {
+	log.SetOutput(io.Discard)
+}
@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// tagList scans the JSON array of tag names selected by postColumns.
+type tagList []string
+
+func (l *tagList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("unexpected tag list %T", src)
+	}
+	var tags []string
+	err := json.Unmarshal(data, &tags)
+	if err != nil {
+		return err
+	}
+	*l = storage.NormalizeTags(tags)
+	return nil
+}
+
+// setTags replaces the tags of the post, creating missing ones.
+func setTags(ctx context.Context, tx *sql.Tx, postID int, tags []string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM post_tags WHERE post_id = ?
+	`, postID)
+	if err != nil {
+		return err
+	}
+	for _, name := range tags {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tags (name) VALUES (?)
+			ON CONFLICT (name) DO NOTHING
+		`, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO post_tags (post_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?
+		`, postID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Tags() ([]storage.Tag, error) {
+	rows, err := s.db.QueryContext(context.Background(), `
+		SELECT t.name, COUNT(pt.post_id)
+		FROM tags AS t
+		LEFT JOIN post_tags AS pt
+		ON pt.tag_id = t.id
+		GROUP BY t.name
+		ORDER BY t.name
+	`)
+	if err != nil {
+		log.Errorf("error requesting tags: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []storage.Tag
+	for rows.Next() {
+		var t storage.Tag
+		err := rows.Scan(&t.Name, &t.Posts)
+		if err != nil {
+			log.Errorf("error requesting tags: %v", err)
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *Store) AddTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	_, err := s.db.ExecContext(context.Background(), `
+		INSERT INTO tags (name)
+		VALUES (?)
+	`,
+		tag.Name,
+	)
+	if constraint(err, sqlite3.ErrConstraintUnique) {
+		log.Errorf("error adding tag: tag %q already exists", tag.Name)
+		return storage.ErrEntryExists
+	}
+	if err != nil {
+		log.Errorf("error adding tag: %v", err)
+		return err
+	}
+
+	log.Infof("tag %q added successfully", tag.Name)
+	return nil
+}
+
+// DeleteTag removes the tag. Tags of existing posts are kept
+// by the foreign key, which is reported as storage.ErrEntryInUse.
+func (s *Store) DeleteTag(tag storage.Tag) error {
+	tag.Name = storage.NormalizeTag(tag.Name)
+	result, err := s.db.ExecContext(context.Background(), `
+		DELETE FROM tags
+		WHERE name = ?
+	`,
+		tag.Name,
+	)
+	if constraint(err, sqlite3.ErrConstraintForeignKey) {
+		log.Errorf("error deleting tag: tag %q has posts", tag.Name)
+		return storage.ErrEntryInUse
+	}
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Errorf("error deleting tag: %v", err)
+		return err
+	}
+	if n == 0 {
+		log.Errorf("error deleting tag: tag %q not found", tag.Name)
+		return storage.ErrEntryNotExist
+	}
+
+	log.Infof("tag %q deleted successfully", tag.Name)
+	return nil
+}
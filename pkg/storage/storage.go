@@ -1,9 +1,15 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 var (
 	ErrEntryNotExist = fmt.Errorf("entry does not exist")
+	ErrEntryExists   = fmt.Errorf("entry already exists")
+	ErrEntryInUse    = fmt.Errorf("entry is in use")
 
 	ErrConnectDB       = fmt.Errorf("unable to establish DB connection")
 	ErrDBNotResponding = fmt.Errorf("DB not responding")
@@ -18,12 +24,123 @@ type Post struct {
 	AuthorName  string `bson:"author_name"`
 	CreatedAt   int64  `bson:"created_at"`
 	PublishedAt int64  `bson:"published_at"`
+
+	// Метки публикации в нижнем регистре по алфавиту.
+	Tags []string `bson:"tags"`
+}
+
+// Author - автор публикаций.
+type Author struct {
+	ID   int    `bson:"id"`
+	Name string `bson:"name"`
+}
+
+// Tag - метка (рубрика) публикаций.
+type Tag struct {
+	Name  string `bson:"name"`
+	Posts int    `bson:"posts"` // число публикаций с меткой
+}
+
+// Comment - комментарий к публикации. Ответ на комментарий
+// указывает его в ParentID, образуя ветку обсуждения.
+type Comment struct {
+	ID        int    `bson:"id"`
+	PostID    int    `bson:"post_id"`
+	ParentID  int    `bson:"parent_id"` // комментарий, на который дан ответ; 0 - нет
+	AuthorID  int    `bson:"author_id"`
+	Content   string `bson:"content"`
+	CreatedAt int64  `bson:"created_at"`
+	UpdatedAt int64  `bson:"updated_at"` // время изменения; 0 - не изменялся
+}
+
+// NormalizeTag приводит имя метки к нижнему регистру
+// и убирает пробелы по краям.
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// NormalizeTags нормализует метки, убирает пустые и повторы
+// и упорядочивает их. Пустой список равен nil.
+func NormalizeTags(tags []string) []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = NormalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// HasTags сообщает, есть ли у публикации все метки tags.
+func (p Post) HasTags(tags []string) bool {
+	for _, t := range tags {
+		found := false
+		for _, pt := range p.Tags {
+			if pt == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter задаёт условия выборки публикаций. Выборка упорядочена
+// от новых публикаций к старым: по убыванию PublishedAt, затем ID.
+type Filter struct {
+	AuthorID int      // публикации автора; 0 - всех авторов
+	Tags     []string // публикации со всеми указанными метками
+
+	// Только публикации, опубликованные не позднее указанного
+	// момента (Unix-время); 0 - все публикации.
+	PublishedUntil int64
+
+	Offset int // число пропускаемых публикаций
+	Limit  int // максимальное число публикаций; 0 - без ограничения
+}
+
+// Match проверяет, удовлетворяет ли публикация условиям фильтра.
+// Смещение и ограничение числа публикаций не учитываются.
+func (f Filter) Match(p Post) bool {
+	if f.AuthorID != 0 && p.AuthorID != f.AuthorID {
+		return false
+	}
+	if f.PublishedUntil != 0 && (p.PublishedAt == 0 || p.PublishedAt > f.PublishedUntil) {
+		return false
+	}
+	return p.HasTags(f.Tags)
 }
 
 // Interface задаёт контракт на работу с БД.
 type Interface interface {
 	Posts() ([]Post, error) // получение всех публикаций
+	Post(int) (Post, error) // получение публикации по ID
 	AddPost(Post) error     // создание новой публикации
 	UpdatePost(Post) error  // обновление публикации
-	DeletePost(Post) error  // удаление публикации по ID
+	DeletePost(Post) error  // удаление публикации по ID вместе с комментариями
+
+	FilterPosts(Filter) ([]Post, error) // выборка публикаций по условиям
+
+	Authors() ([]Author, error) // получение всех авторов
+	Author(int) (Author, error) // получение автора по ID
+	AddAuthor(Author) error     // создание нового автора
+	DeleteAuthor(Author) error  // удаление автора по ID
+
+	Tags() ([]Tag, error) // получение всех меток с числом публикаций
+	AddTag(Tag) error     // создание метки без публикаций
+	DeleteTag(Tag) error  // удаление метки по имени, если у неё нет публикаций
+
+	Comments(postID int) ([]Comment, error) // комментарии к публикации в порядке создания
+	Comment(int) (Comment, error)           // получение комментария по ID
+	AddComment(Comment) error               // создание комментария или ответа
+	UpdateComment(Comment) error            // изменение текста комментария
+	DeleteComment(Comment) error            // удаление комментария вместе с ответами
 }
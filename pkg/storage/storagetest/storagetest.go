@@ -0,0 +1,601 @@
+// Package storagetest содержит общие тесты реализаций storage.Interface.
+// Каждая реализация запускает их из своих тестов:
+//
+//	func TestStore(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Interface {
+//			return newEmptyStore(t)
+//		})
+//	}
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"GoNews/pkg/storage"
+)
+
+// NewStore создаёт хранилище для одного теста: без публикаций
+// и с авторами storage.TestAuthors. Освобождение ресурсов
+// регистрируется через t.Cleanup.
+type NewStore func(t *testing.T) storage.Interface
+
+// Run проверяет, что хранилище выполняет контракт storage.Interface.
+// Тесты выполняются последовательно, поэтому хранилища, созданные
+// newStore, могут использовать одну БД.
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		test func(*testing.T, storage.Interface)
+	}{
+		{"AddPost", testAddPost},
+		{"AddPost_assignsID", testAddPostAssignsID},
+		{"Post", testPost},
+		{"UpdatePost", testUpdatePost},
+		{"DeletePost", testDeletePost},
+		{"NotExist", testNotExist},
+		{"FilterPosts", testFilterPosts},
+		{"Authors", testAuthors},
+		{"Tags", testTags},
+		{"Comments", testComments},
+		{"Concurrency", testConcurrency},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func addTestPosts(t *testing.T, db storage.Interface) {
+	t.Helper()
+	for _, tp := range storage.TestPosts {
+		err := db.AddPost(tp)
+		if err != nil {
+			t.Fatalf("unexpected error adding post: %v", err)
+		}
+	}
+}
+
+func testAddPost(t *testing.T, db storage.Interface) {
+	posts, err := db.Posts()
+	if err != nil || len(posts) != 0 {
+		t.Fatalf("expected an empty store, got %d posts and error %v", len(posts), err)
+	}
+
+	addTestPosts(t, db)
+	posts, err = db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Posts are ordered by ID.
+	if !reflect.DeepEqual(posts, storage.TestPosts) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts)
+	}
+
+	// A post with a taken ID is either rejected or gets a new ID.
+	err = db.AddPost(storage.TestPosts[0])
+	if err != nil && !errors.Is(err, storage.ErrEntryExists) {
+		t.Errorf("expected error %v adding post with a taken ID, got error %v", storage.ErrEntryExists, err)
+	}
+	p, err := db.Post(storage.TestPosts[0].ID)
+	if err != nil || !reflect.DeepEqual(p, storage.TestPosts[0]) {
+		t.Errorf("expected post %+v to stay unchanged, got %+v and error %v", storage.TestPosts[0], p, err)
+	}
+}
+
+func testAddPostAssignsID(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	err := db.AddPost(storage.Post{Title: "New post", Content: "Text", AuthorID: 1, AuthorName: "Mark", CreatedAt: 1644155400})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	posts, err := db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(posts) != len(storage.TestPosts)+1 {
+		t.Fatalf("expected %d posts, got %d", len(storage.TestPosts)+1, len(posts))
+	}
+	last := posts[len(posts)-1]
+	if last.ID <= storage.TestPosts[len(storage.TestPosts)-1].ID || last.Title != "New post" {
+		t.Errorf("expected new post with a new ID, got %+v", last)
+	}
+}
+
+func testPost(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	for _, tp := range storage.TestPosts {
+		p, err := db.Post(tp.ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(p, tp) {
+			t.Errorf("expected post %+v, got %+v", tp, p)
+		}
+	}
+}
+
+func testUpdatePost(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	target := storage.TestPosts[0]
+	target.Title = "Updated title"
+	target.Content = "Updated content"
+	target.AuthorID = 3
+	target.AuthorName = "Travis"
+	target.CreatedAt = 1644155400
+	target.PublishedAt = 1644159000
+	err := db.UpdatePost(target)
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+
+	p, err := db.Post(target.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(p, target) {
+		t.Errorf("updated post do not match target post. Expected: %+v, Got: %+v", target, p)
+	}
+	// Other posts are untouched.
+	posts, err := db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := append([]storage.Post{target}, storage.TestPosts[1:]...)
+	if !reflect.DeepEqual(posts, want) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", want, posts)
+	}
+}
+
+func testDeletePost(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	for i, tp := range storage.TestPosts {
+		err := db.DeletePost(storage.Post{ID: tp.ID})
+		if err != nil {
+			t.Fatalf("unexpected error deleting post: %v", err)
+		}
+		posts, err := db.Posts()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := storage.TestPosts[i+1:]
+		if len(want) == 0 {
+			want = nil
+		}
+		if !reflect.DeepEqual(posts, want) {
+			t.Errorf("post ID:%v: expected remaining posts %+v, got %+v", tp.ID, want, posts)
+		}
+	}
+}
+
+func testNotExist(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	missing := storage.Post{ID: 999999, Title: "Title", Content: "Text", AuthorID: 1, CreatedAt: 1644155400}
+	checks := []struct {
+		name string
+		err  error
+	}{
+		{"Post", func() error { _, err := db.Post(missing.ID); return err }()},
+		{"UpdatePost", db.UpdatePost(missing)},
+		{"DeletePost", db.DeletePost(missing)},
+		{"Author", func() error { _, err := db.Author(999999); return err }()},
+		{"DeleteAuthor", db.DeleteAuthor(storage.Author{ID: 999999})},
+	}
+	for _, c := range checks {
+		if !errors.Is(c.err, storage.ErrEntryNotExist) {
+			t.Errorf("%s: expected error %v, got error %v", c.name, storage.ErrEntryNotExist, c.err)
+		}
+	}
+
+	// Failed changes leave the posts as they were.
+	posts, err := db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(posts, storage.TestPosts) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts)
+	}
+}
+
+func testFilterPosts(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+	// A draft is not published yet.
+	draft := storage.Post{ID: 6, Title: "Draft", Content: "Text", AuthorID: 1, AuthorName: "Mark", CreatedAt: 1644155400}
+	err := db.AddPost(draft)
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+
+	tp := storage.TestPosts
+	tests := []struct {
+		name   string
+		filter storage.Filter
+		want   []storage.Post
+	}{
+		{"all newest first", storage.Filter{}, []storage.Post{tp[4], tp[3], tp[2], tp[1], tp[0], draft}},
+		{"by author", storage.Filter{AuthorID: 1}, []storage.Post{tp[2], tp[0], draft}},
+		{"published until", storage.Filter{PublishedUntil: tp[1].PublishedAt}, []storage.Post{tp[1], tp[0]}},
+		{"author and published until", storage.Filter{AuthorID: 2, PublishedUntil: tp[4].PublishedAt}, []storage.Post{tp[4], tp[1]}},
+		{"page", storage.Filter{Offset: 1, Limit: 2}, []storage.Post{tp[3], tp[2]}},
+		{"offset past end", storage.Filter{Offset: 10}, nil},
+		{"unknown author", storage.Filter{AuthorID: 999999}, nil},
+	}
+	for _, tt := range tests {
+		got, err := db.FilterPosts(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func testAuthors(t *testing.T, db storage.Interface) {
+	authors, err := db.Authors()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(authors, storage.TestAuthors) {
+		t.Errorf("authors do not match expected authors. Expected: %+v, Got: %+v", storage.TestAuthors, authors)
+	}
+
+	// A new author gets a new ID.
+	err = db.AddAuthor(storage.Author{Name: "Alice"})
+	if err != nil {
+		t.Fatalf("unexpected error adding author: %v", err)
+	}
+	authors, err = db.Authors()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(authors) != len(storage.TestAuthors)+1 {
+		t.Fatalf("expected %d authors, got %+v", len(storage.TestAuthors)+1, authors)
+	}
+	alice := authors[len(authors)-1]
+	if alice.Name != "Alice" || alice.ID <= storage.TestAuthors[len(storage.TestAuthors)-1].ID {
+		t.Errorf("expected new author with a new ID, got %+v", alice)
+	}
+	a, err := db.Author(alice.ID)
+	if err != nil || a != alice {
+		t.Errorf("expected author %+v, got %+v and error %v", alice, a, err)
+	}
+
+	// Authors of posts cannot be removed.
+	addTestPosts(t, db)
+	err = db.DeleteAuthor(storage.TestAuthors[0])
+	if !errors.Is(err, storage.ErrEntryInUse) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryInUse, err)
+	}
+
+	err = db.DeleteAuthor(alice)
+	if err != nil {
+		t.Fatalf("unexpected error deleting author: %v", err)
+	}
+	if _, err := db.Author(alice.ID); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
+	}
+
+	// Neither can authors of comments, until the comments are gone.
+	err = db.AddAuthor(storage.Author{Name: "Bob"})
+	if err != nil {
+		t.Fatalf("unexpected error adding author: %v", err)
+	}
+	authors, _ = db.Authors()
+	bob := authors[len(authors)-1]
+	c := addComment(t, db, storage.Comment{PostID: storage.TestPosts[0].ID, AuthorID: bob.ID, Content: "Hi", CreatedAt: 1644155400})
+	err = db.DeleteAuthor(bob)
+	if !errors.Is(err, storage.ErrEntryInUse) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryInUse, err)
+	}
+	err = db.DeleteComment(c)
+	if err != nil {
+		t.Fatalf("unexpected error deleting comment: %v", err)
+	}
+	err = db.DeleteAuthor(bob)
+	if err != nil {
+		t.Errorf("unexpected error deleting author: %v", err)
+	}
+}
+
+func testTags(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+	tp := storage.TestPosts
+
+	// Tags of a post are normalized and created with it.
+	tagged := tp[0]
+	tagged.Tags = []string{"Politics", " economy ", "politics"}
+	err := db.UpdatePost(tagged)
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	tagged.Tags = []string{"economy", "politics"}
+	p, err := db.Post(tagged.ID)
+	if err != nil || !reflect.DeepEqual(p, tagged) {
+		t.Errorf("expected post %+v, got %+v and error %v", tagged, p, err)
+	}
+	other := tp[3]
+	other.Tags = []string{"politics"}
+	err = db.UpdatePost(other)
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	err = db.AddTag(storage.Tag{Name: "sport"})
+	if err != nil {
+		t.Fatalf("unexpected error adding tag: %v", err)
+	}
+	if err := db.AddTag(storage.Tag{Name: "sport"}); !errors.Is(err, storage.ErrEntryExists) {
+		t.Errorf("expected error %v adding a tag twice, got error %v", storage.ErrEntryExists, err)
+	}
+
+	tags, err := db.Tags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []storage.Tag{{Name: "economy", Posts: 1}, {Name: "politics", Posts: 2}, {Name: "sport", Posts: 0}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tags %+v, got %+v", want, tags)
+	}
+
+	// A filter by tags matches posts with all of them.
+	filters := []struct {
+		name   string
+		filter storage.Filter
+		want   []storage.Post
+	}{
+		{"one tag", storage.Filter{Tags: []string{"politics"}}, []storage.Post{other, tagged}},
+		{"all tags", storage.Filter{Tags: []string{"economy", "politics"}}, []storage.Post{tagged}},
+		{"tag and author", storage.Filter{Tags: []string{"politics"}, AuthorID: other.AuthorID}, []storage.Post{other}},
+		{"tag page", storage.Filter{Tags: []string{"politics"}, Offset: 1, Limit: 1}, []storage.Post{tagged}},
+		{"unused tag", storage.Filter{Tags: []string{"sport"}}, nil},
+	}
+	for _, tt := range filters {
+		got, err := db.FilterPosts(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+
+	// Tags of posts cannot be removed; unused ones can.
+	err = db.DeleteTag(storage.Tag{Name: "politics"})
+	if !errors.Is(err, storage.ErrEntryInUse) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryInUse, err)
+	}
+	err = db.DeleteTag(storage.Tag{Name: "sport"})
+	if err != nil {
+		t.Fatalf("unexpected error deleting tag: %v", err)
+	}
+	if err := db.DeleteTag(storage.Tag{Name: "sport"}); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v, got error %v", storage.ErrEntryNotExist, err)
+	}
+
+	// Removing the tags from posts keeps the tags themselves.
+	tagged.Tags = nil
+	err = db.UpdatePost(tagged)
+	if err != nil {
+		t.Fatalf("unexpected error updating post: %v", err)
+	}
+	err = db.DeletePost(other)
+	if err != nil {
+		t.Fatalf("unexpected error deleting post: %v", err)
+	}
+	tags, err = db.Tags()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []storage.Tag{{Name: "economy", Posts: 0}, {Name: "politics", Posts: 0}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected tags %+v, got %+v", want, tags)
+	}
+	p, err = db.Post(tagged.ID)
+	if err != nil || p.Tags != nil {
+		t.Errorf("expected a post without tags, got %+v and error %v", p, err)
+	}
+}
+
+// addComment adds the comment and returns it with the ID
+// assigned by the store: the latest comment of the post.
+func addComment(t *testing.T, db storage.Interface, c storage.Comment) storage.Comment {
+	t.Helper()
+	err := db.AddComment(c)
+	if err != nil {
+		t.Fatalf("unexpected error adding comment: %v", err)
+	}
+	comments, err := db.Comments(c.PostID)
+	if err != nil || len(comments) == 0 {
+		t.Fatalf("expected comments of post %d, got %+v and error %v", c.PostID, comments, err)
+	}
+	got := comments[len(comments)-1]
+	c.ID = got.ID
+	if c.ID <= 0 || !reflect.DeepEqual(got, c) {
+		t.Fatalf("expected comment %+v with a new ID, got %+v", c, got)
+	}
+	return c
+}
+
+func testComments(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+	post, other := storage.TestPosts[0], storage.TestPosts[1]
+
+	comments, err := db.Comments(post.ID)
+	if err != nil || len(comments) != 0 {
+		t.Fatalf("expected no comments, got %+v and error %v", comments, err)
+	}
+
+	first := addComment(t, db, storage.Comment{PostID: post.ID, AuthorID: 1, Content: "First", CreatedAt: 1644155400})
+	reply := addComment(t, db, storage.Comment{PostID: post.ID, ParentID: first.ID, AuthorID: 2, Content: "Reply", CreatedAt: 1644155460})
+	nested := addComment(t, db, storage.Comment{PostID: post.ID, ParentID: reply.ID, AuthorID: 1, Content: "Nested", CreatedAt: 1644155520})
+	second := addComment(t, db, storage.Comment{PostID: post.ID, AuthorID: 3, Content: "Second", CreatedAt: 1644155580})
+	elsewhere := addComment(t, db, storage.Comment{PostID: other.ID, AuthorID: 2, Content: "Elsewhere", CreatedAt: 1644155640})
+
+	// Comments of a post come in the order they were added.
+	comments, err = db.Comments(post.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []storage.Comment{first, reply, nested, second}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("expected comments %+v, got %+v", want, comments)
+	}
+	c, err := db.Comment(reply.ID)
+	if err != nil || !reflect.DeepEqual(c, reply) {
+		t.Errorf("expected comment %+v, got %+v and error %v", reply, c, err)
+	}
+
+	// Comments need an existing post and author, and replies
+	// an existing comment of the same post.
+	bad := []struct {
+		name    string
+		comment storage.Comment
+	}{
+		{"missing post", storage.Comment{PostID: 999999, AuthorID: 1, Content: "Text", CreatedAt: 1644155400}},
+		{"missing author", storage.Comment{PostID: post.ID, AuthorID: 999999, Content: "Text", CreatedAt: 1644155400}},
+		{"missing parent", storage.Comment{PostID: post.ID, ParentID: 999999, AuthorID: 1, Content: "Text", CreatedAt: 1644155400}},
+		{"parent of another post", storage.Comment{PostID: post.ID, ParentID: elsewhere.ID, AuthorID: 1, Content: "Text", CreatedAt: 1644155400}},
+	}
+	for _, tt := range bad {
+		if err := db.AddComment(tt.comment); !errors.Is(err, storage.ErrEntryNotExist) {
+			t.Errorf("%s: expected error %v, got error %v", tt.name, storage.ErrEntryNotExist, err)
+		}
+	}
+	if _, err := db.Comments(999999); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v for comments of a missing post, got error %v", storage.ErrEntryNotExist, err)
+	}
+
+	// An update changes only the text and the time of the change.
+	edit := reply
+	edit.Content = "Edited"
+	edit.UpdatedAt = 1644159000
+	edit.AuthorID = 3
+	edit.PostID = other.ID
+	edit.ParentID = 0
+	err = db.UpdateComment(edit)
+	if err != nil {
+		t.Fatalf("unexpected error updating comment: %v", err)
+	}
+	reply.Content = "Edited"
+	reply.UpdatedAt = 1644159000
+	c, err = db.Comment(reply.ID)
+	if err != nil || !reflect.DeepEqual(c, reply) {
+		t.Errorf("expected comment %+v, got %+v and error %v", reply, c, err)
+	}
+
+	// Deleting a comment deletes the replies to it.
+	err = db.DeleteComment(storage.Comment{ID: reply.ID})
+	if err != nil {
+		t.Fatalf("unexpected error deleting comment: %v", err)
+	}
+	comments, err = db.Comments(post.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []storage.Comment{first, second}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("expected comments %+v, got %+v", want, comments)
+	}
+
+	missing := storage.Comment{ID: nested.ID, Content: "Text"}
+	checks := []struct {
+		name string
+		err  error
+	}{
+		{"Comment", func() error { _, err := db.Comment(missing.ID); return err }()},
+		{"UpdateComment", db.UpdateComment(missing)},
+		{"DeleteComment", db.DeleteComment(missing)},
+	}
+	for _, c := range checks {
+		if !errors.Is(c.err, storage.ErrEntryNotExist) {
+			t.Errorf("%s: expected error %v, got error %v", c.name, storage.ErrEntryNotExist, c.err)
+		}
+	}
+
+	// Deleting a post deletes its comments only.
+	err = db.DeletePost(post)
+	if err != nil {
+		t.Fatalf("unexpected error deleting post: %v", err)
+	}
+	if _, err := db.Comment(first.ID); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v for a comment of a deleted post, got error %v", storage.ErrEntryNotExist, err)
+	}
+	comments, err = db.Comments(other.ID)
+	if err != nil || !reflect.DeepEqual(comments, []storage.Comment{elsewhere}) {
+		t.Errorf("expected comments %+v, got %+v and error %v", []storage.Comment{elsewhere}, comments, err)
+	}
+}
+
+func testConcurrency(t *testing.T, db storage.Interface) {
+	addTestPosts(t, db)
+
+	const workers, perWorker = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker*3)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				p := storage.Post{
+					Title:      fmt.Sprintf("Post %d-%d", w, i),
+					Content:    "Text",
+					AuthorID:   2,
+					AuthorName: "Tom",
+					CreatedAt:  1644155400,
+				}
+				if err := db.AddPost(p); err != nil {
+					errs <- fmt.Errorf("adding post: %w", err)
+				}
+				// Readers and writers of existing posts run alongside.
+				if _, err := db.Posts(); err != nil {
+					errs <- fmt.Errorf("reading posts: %w", err)
+				}
+				tp := storage.TestPosts[(w+i)%len(storage.TestPosts)]
+				if err := db.UpdatePost(tp); err != nil {
+					errs <- fmt.Errorf("updating post: %w", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	posts, err := db.Posts()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(posts) != len(storage.TestPosts)+workers*perWorker {
+		t.Fatalf("expected %d posts, got %d", len(storage.TestPosts)+workers*perWorker, len(posts))
+	}
+	// Every post got its own ID.
+	seen := make(map[int]bool)
+	for _, p := range posts {
+		if seen[p.ID] {
+			t.Errorf("duplicate post ID %d", p.ID)
+		}
+		seen[p.ID] = true
+	}
+	if !reflect.DeepEqual(posts[:len(storage.TestPosts)], storage.TestPosts) {
+		t.Errorf("posts do not match expected posts. Expected: %+v, Got: %+v", storage.TestPosts, posts[:len(storage.TestPosts)])
+	}
+}
@@ -0,0 +1,105 @@
+package storagetest
+
+import (
+	"errors"
+	"testing"
+
+	"GoNews/pkg/storage"
+)
+
+// RunTenants проверяет, что реализация storage.Tenants создаёт,
+// изолирует и удаляет хранилища арендаторов. Арендаторы acme и globex
+// не должны существовать до начала теста; тест удаляет их по окончании.
+func RunTenants(t *testing.T, tenants storage.Tenants) {
+	t.Cleanup(func() {
+		tenants.DeleteTenant("acme")
+		tenants.DeleteTenant("globex")
+	})
+
+	for _, id := range []string{"acme", "globex"} {
+		err := tenants.AddTenant(id)
+		if err != nil {
+			t.Fatalf("unexpected error adding tenant %s: %v", id, err)
+		}
+	}
+	if err := tenants.AddTenant("acme"); !errors.Is(err, storage.ErrEntryExists) {
+		t.Errorf("expected error %v adding a tenant twice, got %v", storage.ErrEntryExists, err)
+	}
+	if err := tenants.AddTenant("Acme-Corp"); !errors.Is(err, storage.ErrInvalidTenant) {
+		t.Errorf("expected error %v, got %v", storage.ErrInvalidTenant, err)
+	}
+	if _, err := tenants.Tenant("initech"); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v for an unknown tenant, got %v", storage.ErrEntryNotExist, err)
+	}
+	if ids := tenantIDs(t, tenants); !ids["acme"] || !ids["globex"] {
+		t.Errorf("expected tenants acme and globex, got %v", ids)
+	}
+
+	// Entries of one tenant are invisible to the other,
+	// and IDs are assigned independently.
+	acme := tenant(t, tenants, "acme")
+	globex := tenant(t, tenants, "globex")
+	for _, db := range []storage.Interface{acme, globex} {
+		err := db.AddAuthor(storage.Author{Name: "Mark"})
+		if err != nil {
+			t.Fatalf("unexpected error adding author: %v", err)
+		}
+	}
+	err := acme.AddPost(storage.Post{Title: "Acme news", Content: "Text", AuthorID: 1, CreatedAt: 1})
+	if err != nil {
+		t.Fatalf("unexpected error adding post: %v", err)
+	}
+	if posts, err := globex.Posts(); err != nil || len(posts) != 0 {
+		t.Errorf("expected no posts of another tenant, got %+v and error %v", posts, err)
+	}
+	if authors, _ := globex.Authors(); len(authors) != 1 || authors[0].ID != 1 {
+		t.Errorf("expected a single author with ID 1, got %+v", authors)
+	}
+	if posts, _ := acme.Posts(); len(posts) != 1 || posts[0].ID != 1 || posts[0].Title != "Acme news" {
+		t.Errorf("expected the tenant's own post, got %+v", posts)
+	}
+
+	// A deleted tenant is gone with its data.
+	err = tenants.DeleteTenant("acme")
+	if err != nil {
+		t.Fatalf("unexpected error deleting tenant: %v", err)
+	}
+	if err := tenants.DeleteTenant("acme"); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v deleting a tenant twice, got %v", storage.ErrEntryNotExist, err)
+	}
+	if _, err := tenants.Tenant("acme"); !errors.Is(err, storage.ErrEntryNotExist) {
+		t.Errorf("expected error %v for a deleted tenant, got %v", storage.ErrEntryNotExist, err)
+	}
+	if ids := tenantIDs(t, tenants); ids["acme"] || !ids["globex"] {
+		t.Errorf("expected only globex to remain, got %v", ids)
+	}
+	err = tenants.AddTenant("acme")
+	if err != nil {
+		t.Fatalf("unexpected error adding tenant again: %v", err)
+	}
+	if posts, _ := tenant(t, tenants, "acme").Posts(); len(posts) != 0 {
+		t.Errorf("expected a recreated tenant to be empty, got %+v", posts)
+	}
+}
+
+func tenant(t *testing.T, tenants storage.Tenants, id string) storage.Interface {
+	t.Helper()
+	db, err := tenants.Tenant(id)
+	if err != nil {
+		t.Fatalf("unexpected error opening tenant %s: %v", id, err)
+	}
+	return db
+}
+
+func tenantIDs(t *testing.T, tenants storage.Tenants) map[string]bool {
+	t.Helper()
+	list, err := tenants.Tenants()
+	if err != nil {
+		t.Fatalf("unexpected error listing tenants: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, id := range list {
+		ids[id] = true
+	}
+	return ids
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// ErrInvalidTenant - недопустимый идентификатор арендатора.
+var ErrInvalidTenant = fmt.Errorf("invalid tenant ID")
+
+// Tenants - хранилища арендаторов (редакций), размещённых на одном
+// сервере. Данные каждого арендатора изолированы от остальных.
+type Tenants interface {
+	Tenants() ([]string, error)          // получение идентификаторов арендаторов
+	Tenant(id string) (Interface, error) // хранилище арендатора
+	AddTenant(id string) error           // создание арендатора с пустым хранилищем
+	DeleteTenant(id string) error        // удаление арендатора вместе с его данными
+}
+
+// tenantID - допустимый идентификатор арендатора. Он становится
+// частью имени схемы, базы данных или каталога, поэтому состоит
+// только из строчных латинских букв, цифр и подчёркиваний.
+var tenantID = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// CheckTenant проверяет идентификатор арендатора.
+func CheckTenant(id string) error {
+	if !tenantID.MatchString(id) {
+		return fmt.Errorf("%w %q: must be 1 to 32 lowercase letters, digits or underscores starting with a letter", ErrInvalidTenant, id)
+	}
+	return nil
+}
+
+// WrapTenants применяет wrap к хранилищу каждого арендатора, например
+// чтобы добавить кэш или повторы. Обёрнутые хранилища создаются
+// один раз и используются до удаления арендатора.
+func WrapTenants(t Tenants, wrap func(id string, db Interface) Interface) Tenants {
+	return &wrappedTenants{inner: t, wrap: wrap, stores: make(map[string]Interface)}
+}
+
+type wrappedTenants struct {
+	inner Tenants
+	wrap  func(string, Interface) Interface
+
+	mu     sync.Mutex
+	stores map[string]Interface
+}
+
+func (w *wrappedTenants) Tenants() ([]string, error) {
+	return w.inner.Tenants()
+}
+
+func (w *wrappedTenants) AddTenant(id string) error {
+	return w.inner.AddTenant(id)
+}
+
+func (w *wrappedTenants) Tenant(id string) (Interface, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if db, ok := w.stores[id]; ok {
+		return db, nil
+	}
+	db, err := w.inner.Tenant(id)
+	if err != nil {
+		return nil, err
+	}
+	db = w.wrap(id, db)
+	w.stores[id] = db
+	return db, nil
+}
+
+func (w *wrappedTenants) DeleteTenant(id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.stores, id)
+	return w.inner.DeleteTenant(id)
+}
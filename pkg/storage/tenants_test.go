@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTenant(t *testing.T) {
+	for _, id := range []string{"acme", "a", "news_2024", "abcdefghijklmnopqrstuvwxyz012345"} {
+		if err := CheckTenant(id); err != nil {
+			t.Errorf("%q: unexpected error %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "Acme", "2news", "_acme", "acme-corp", "acme.corp", "abcdefghijklmnopqrstuvwxyz0123456"} {
+		if err := CheckTenant(id); !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("%q: expected error %v, got %v", id, ErrInvalidTenant, err)
+		}
+	}
+}
+
+// tenantMap is a minimal Tenants; it returns a new value for every
+// Tenant call, so that wrapped stores show whether they are reused.
+type tenantMap map[string]bool
+
+type tenantStore struct {
+	Interface
+	id string
+}
+
+func (m tenantMap) Tenants() ([]string, error) { return nil, nil }
+func (m tenantMap) AddTenant(id string) error  { m[id] = true; return nil }
+func (m tenantMap) DeleteTenant(id string) error {
+	delete(m, id)
+	return nil
+}
+func (m tenantMap) Tenant(id string) (Interface, error) {
+	if !m[id] {
+		return nil, ErrEntryNotExist
+	}
+	return &tenantStore{id: id}, nil
+}
+
+func TestWrapTenants(t *testing.T) {
+	wraps := 0
+	tenants := WrapTenants(tenantMap{"acme": true}, func(id string, db Interface) Interface {
+		wraps++
+		return db
+	})
+
+	a, _ := tenants.Tenant("acme")
+	b, _ := tenants.Tenant("acme")
+	if a != b || wraps != 1 {
+		t.Errorf("expected the wrapped store to be reused, got %d wraps", wraps)
+	}
+	if _, err := tenants.Tenant("globex"); !errors.Is(err, ErrEntryNotExist) {
+		t.Errorf("expected error %v, got %v", ErrEntryNotExist, err)
+	}
+
+	// A deleted and recreated tenant gets a new store.
+	tenants.DeleteTenant("acme")
+	tenants.AddTenant("acme")
+	c, _ := tenants.Tenant("acme")
+	if c == a || wraps != 2 {
+		t.Errorf("expected a new store after recreating the tenant, got %d wraps", wraps)
+	}
+}
@@ -0,0 +1,479 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+// Config задаёт параметры доставки.
+type Config struct {
+	Workers     int           // число одновременных доставок
+	MaxAttempts int           // число попыток до переноса в список недоставленных
+	Backoff     time.Duration // пауза перед второй попыткой, далее удваивается
+	MaxBackoff  time.Duration // максимальная пауза между попытками
+	Timeout     time.Duration // время ожидания ответа получателя
+	LogSize     int           // число записей журнала доставки на подписку
+	DeadLetters int           // размер списка недоставленных событий
+
+	// Разрешить доставку на локальные и внутренние адреса.
+	// По умолчанию такие получатели отклоняются.
+	AllowPrivate bool
+
+	// Файл, в котором хранятся подписки. Если не задан,
+	// подписки хранятся только в памяти.
+	File string
+}
+
+// DefaultConfig возвращает параметры доставки по умолчанию.
+func DefaultConfig() Config {
+	return Config{
+		Workers:     4,
+		MaxAttempts: 6,
+		Backoff:     time.Second,
+		MaxBackoff:  5 * time.Minute,
+		Timeout:     10 * time.Second,
+		LogSize:     100,
+		DeadLetters: 1000,
+	}
+}
+
+// Dispatcher хранит подписки и доставляет им события шины.
+type Dispatcher struct {
+	conf   Config
+	client *http.Client
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu             sync.Mutex
+	subs           map[int]Subscription
+	nextID         int
+	logs           map[int][]Delivery
+	nextDeliveryID int
+	dead           []DeadLetter
+	nextDeadID     int
+
+	jobs chan job
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// job - доставка события одной подписке.
+type job struct {
+	subID   int
+	event   storage.Event
+	attempt int
+}
+
+// New создаёт диспетчер и загружает подписки из файла, если он задан.
+func New(conf Config) (*Dispatcher, error) {
+	d := &Dispatcher{
+		conf:           conf,
+		client:         newClient(conf),
+		lookup:         net.DefaultResolver.LookupIPAddr,
+		subs:           make(map[int]Subscription),
+		nextID:         1,
+		logs:           make(map[int][]Delivery),
+		nextDeliveryID: 1,
+		nextDeadID:     1,
+		jobs:           make(chan job),
+		quit:           make(chan struct{}),
+	}
+	if conf.File != "" {
+		err := d.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Run запускает доставку событий шины.
+func (d *Dispatcher) Run(bus *storage.Bus) {
+	for i := 0; i < d.conf.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	// Подписка оформляется до возврата из Run,
+	// чтобы не пропустить следующие за ним события.
+	d.wg.Add(1)
+	go d.listen(bus, bus.Subscribe())
+}
+
+// Close останавливает доставку. Запланированные повторы отменяются.
+func (d *Dispatcher) Close() {
+	close(d.quit)
+	d.wg.Wait()
+}
+
+// listen получает события шины. Если диспетчер не успевает их
+// обработать и шина отключает его, он переподписывается
+// и получает пропущенные события из истории.
+func (d *Dispatcher) listen(bus *storage.Bus, sub *storage.Subscription) {
+	defer d.wg.Done()
+	last := sub.Last
+	for {
+		select {
+		case <-d.quit:
+			sub.Close()
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				sub = bus.Resume(last)
+				if sub.Gap {
+					log.Warnf("webhooks: events after ID %d were lost", last)
+				}
+				for _, e := range sub.Backlog {
+					d.dispatch(e)
+				}
+				last = sub.Last
+				continue
+			}
+			d.dispatch(e)
+			last = e.ID
+		}
+	}
+}
+
+// dispatch ставит событие в очередь доставки подписчикам.
+func (d *Dispatcher) dispatch(e storage.Event) {
+	d.mu.Lock()
+	var ids []int
+	for id, s := range d.subs {
+		if s.Wants(e.Type) {
+			ids = append(ids, id)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Ints(ids)
+	for _, id := range ids {
+		d.enqueue(job{subID: id, event: e, attempt: 1})
+	}
+}
+
+func (d *Dispatcher) enqueue(j job) {
+	select {
+	case d.jobs <- j:
+	case <-d.quit:
+	}
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.quit:
+			return
+		case j := <-d.jobs:
+			d.deliver(j)
+		}
+	}
+}
+
+// deliver выполняет попытку доставки и при неудаче планирует повтор
+// или переносит событие в список недоставленных.
+func (d *Dispatcher) deliver(j job) {
+	d.mu.Lock()
+	sub, ok := d.subs[j.subID]
+	d.mu.Unlock()
+	if !ok {
+		// Подписку удалили, пока событие ждало доставки.
+		return
+	}
+
+	start := time.Now()
+	status, err := d.send(sub, j.event)
+	rec := Delivery{
+		SubscriptionID: sub.ID,
+		EventID:        j.event.ID,
+		Event:          j.event.Type,
+		Attempt:        j.attempt,
+		StatusCode:     status,
+		Time:           start.Unix(),
+		DurationMS:     time.Since(start).Milliseconds(),
+	}
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	d.record(rec)
+
+	if err == nil {
+		return
+	}
+	if retryable(status) && j.attempt < d.conf.MaxAttempts {
+		j.attempt++
+		time.AfterFunc(d.backoff(j.attempt), func() { d.enqueue(j) })
+		return
+	}
+	log.Warnf("webhooks: event %d to subscription %d failed after %d attempts: %v", j.event.ID, sub.ID, j.attempt, err)
+	d.bury(DeadLetter{
+		SubscriptionID: sub.ID,
+		Event:          j.event,
+		Attempts:       j.attempt,
+		LastError:      err.Error(),
+		Time:           time.Now().Unix(),
+	})
+}
+
+// send отправляет событие получателю и возвращает код ответа.
+func (d *Dispatcher) send(sub Subscription, e storage.Event) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.conf.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoNews-Webhook")
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(e.ID, 10))
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(sub.Secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// retryable сообщает, имеет ли смысл повторить доставку. Ошибки
+// соединения (код 0) и сервера повторяются, ошибки запроса - нет.
+func retryable(status int) bool {
+	return status == 0 || status >= 500 ||
+		status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// backoff возвращает паузу перед попыткой attempt: экспоненциально
+// растущую, со случайным разбросом, чтобы повторы не совпадали.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.conf.Backoff
+	for i := 2; i < attempt && delay < d.conf.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.conf.MaxBackoff {
+		delay = d.conf.MaxBackoff
+	}
+	return delay/2 + time.Duration(mrand.Int63n(int64(delay/2)+1))
+}
+
+// record добавляет запись в журнал доставки подписки.
+func (d *Dispatcher) record(rec Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subs[rec.SubscriptionID]; !ok {
+		return
+	}
+	rec.ID = d.nextDeliveryID
+	d.nextDeliveryID++
+	l := append(d.logs[rec.SubscriptionID], rec)
+	if len(l) > d.conf.LogSize {
+		l = l[len(l)-d.conf.LogSize:]
+	}
+	d.logs[rec.SubscriptionID] = l
+}
+
+// bury переносит событие в список недоставленных.
+func (d *Dispatcher) bury(dl DeadLetter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dl.ID = d.nextDeadID
+	d.nextDeadID++
+	d.dead = append(d.dead, dl)
+	if len(d.dead) > d.conf.DeadLetters {
+		d.dead = d.dead[len(d.dead)-d.conf.DeadLetters:]
+	}
+}
+
+// Subscriptions возвращает подписки без ключей подписи.
+func (d *Dispatcher) Subscriptions() []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		s.Secret = ""
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Add создаёт подписку. Если ключ подписи не задан, он генерируется.
+// Возвращается подписка с ключом.
+func (d *Dispatcher) Add(s Subscription) (Subscription, error) {
+	if s.Secret == "" {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		if err != nil {
+			return s, err
+		}
+		s.Secret = hex.EncodeToString(b)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s.ID = d.nextID
+	s.CreatedAt = time.Now().Unix()
+	d.subs[s.ID] = s
+	d.nextID++
+	err := d.save()
+	if err != nil {
+		delete(d.subs, s.ID)
+		return s, err
+	}
+
+	log.Infof("webhook subscription ID:%v added for %s", s.ID, s.URL)
+	return s, nil
+}
+
+// Delete удаляет подписку вместе с журналом доставки.
+func (d *Dispatcher) Delete(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.subs[id]
+	if !ok {
+		return storage.ErrEntryNotExist
+	}
+	delete(d.subs, id)
+	err := d.save()
+	if err != nil {
+		d.subs[id] = s
+		return err
+	}
+	delete(d.logs, id)
+
+	log.Infof("webhook subscription ID:%v deleted", id)
+	return nil
+}
+
+// Deliveries возвращает журнал доставки подписки от старых к новым.
+func (d *Dispatcher) Deliveries(id int) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subs[id]; !ok {
+		return nil, storage.ErrEntryNotExist
+	}
+	return append([]Delivery{}, d.logs[id]...), nil
+}
+
+// DeadLetters возвращает недоставленные события.
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter{}, d.dead...)
+}
+
+// Redeliver убирает событие из списка недоставленных
+// и заново начинает его доставку.
+func (d *Dispatcher) Redeliver(id int) error {
+	d.mu.Lock()
+	i := sort.Search(len(d.dead), func(i int) bool { return d.dead[i].ID >= id })
+	if i == len(d.dead) || d.dead[i].ID != id {
+		d.mu.Unlock()
+		return storage.ErrEntryNotExist
+	}
+	dl := d.dead[i]
+	if _, ok := d.subs[dl.SubscriptionID]; !ok {
+		d.mu.Unlock()
+		return storage.ErrEntryNotExist
+	}
+	d.dead = append(d.dead[:i], d.dead[i+1:]...)
+	d.mu.Unlock()
+
+	go d.enqueue(job{subID: dl.SubscriptionID, event: dl.Event, attempt: 1})
+	return nil
+}
+
+// subscriptionsFile - содержимое файла подписок.
+type subscriptionsFile struct {
+	NextID        int            `json:"next_id"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+func (d *Dispatcher) load() error {
+	b, err := ioutil.ReadFile(d.conf.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f subscriptionsFile
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return fmt.Errorf("webhooks file %s: %w", d.conf.File, err)
+	}
+	for _, s := range f.Subscriptions {
+		d.subs[s.ID] = s
+	}
+	if f.NextID > d.nextID {
+		d.nextID = f.NextID
+	}
+	return nil
+}
+
+// save записывает подписки в файл атомарно. Файл содержит ключи
+// подписи, поэтому доступен только владельцу.
+func (d *Dispatcher) save() error {
+	if d.conf.File == "" {
+		return nil
+	}
+	f := subscriptionsFile{NextID: d.nextID}
+	for _, s := range d.subs {
+		f.Subscriptions = append(f.Subscriptions, s)
+	}
+	sort.Slice(f.Subscriptions, func(i, j int) bool { return f.Subscriptions[i].ID < f.Subscriptions[j].ID })
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(d.conf.File), filepath.Base(d.conf.File)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.conf.File)
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"GoNews/pkg/storage"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+}
+
+func testConfig() Config {
+	conf := DefaultConfig()
+	conf.MaxAttempts = 3
+	conf.Backoff = time.Millisecond
+	conf.MaxBackoff = 4 * time.Millisecond
+	conf.Timeout = time.Second
+	// Test receivers listen on the loopback interface.
+	conf.AllowPrivate = true
+	return conf
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDispatcher_retry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	bus := storage.NewBus(10)
+	d, _ := New(testConfig())
+	d.Run(bus)
+	defer d.Close()
+	sub, _ := d.Add(Subscription{URL: srv.URL, Events: []string{storage.EventPublished}})
+
+	bus.Publish(storage.EventCreated, storage.Post{ID: 1})
+	bus.Publish(storage.EventPublished, storage.Post{ID: 1, PublishedAt: 1})
+
+	var list []Delivery
+	waitFor(t, "three attempts", func() bool {
+		list, _ = d.Deliveries(sub.ID)
+		return len(list) == 3
+	})
+	for i, rec := range list {
+		if rec.Attempt != i+1 || rec.Event != storage.EventPublished {
+			t.Errorf("unexpected delivery %+v", rec)
+		}
+	}
+	if list[0].StatusCode != http.StatusServiceUnavailable || list[0].Error == "" || list[2].StatusCode != http.StatusOK || list[2].Error != "" {
+		t.Errorf("unexpected delivery log %+v", list)
+	}
+	if dead := d.DeadLetters(); len(dead) != 0 {
+		t.Errorf("expected no dead letters, got %+v", dead)
+	}
+}
+
+func TestDispatcher_deadLetters(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	bus := storage.NewBus(10)
+	d, _ := New(testConfig())
+	d.Run(bus)
+	defer d.Close()
+	sub, _ := d.Add(Subscription{URL: srv.URL})
+
+	bus.Publish(storage.EventDeleted, storage.Post{ID: 7})
+	waitFor(t, "a dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+	dl := d.DeadLetters()[0]
+	if dl.SubscriptionID != sub.ID || dl.Attempts != 3 || dl.Event.Post.ID != 7 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("unexpected dead letter %+v after %d calls", dl, atomic.LoadInt32(&calls))
+	}
+
+	// Client errors are not retried.
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	err := d.Redeliver(dl.ID)
+	if err != nil {
+		t.Fatalf("unexpected error redelivering: %v", err)
+	}
+	waitFor(t, "another dead letter", func() bool {
+		dead := d.DeadLetters()
+		return len(dead) == 1 && dead[0].ID != dl.ID
+	})
+	if dl = d.DeadLetters()[0]; dl.Attempts != 1 || atomic.LoadInt32(&calls) != 4 {
+		t.Errorf("unexpected dead letter %+v after %d calls", dl, atomic.LoadInt32(&calls))
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	d.Redeliver(dl.ID)
+	waitFor(t, "a successful delivery", func() bool {
+		list, _ := d.Deliveries(sub.ID)
+		return len(list) == 5 && list[4].StatusCode == http.StatusOK
+	})
+	if err := d.Redeliver(dl.ID); err != storage.ErrEntryNotExist {
+		t.Errorf("expected ErrEntryNotExist, got %v", err)
+	}
+}
+
+func TestDispatcher_file(t *testing.T) {
+	conf := testConfig()
+	conf.File = filepath.Join(t.TempDir(), "webhooks.json")
+	d, err := New(conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a, _ := d.Add(Subscription{URL: "https://a.example.com"})
+	b, _ := d.Add(Subscription{URL: "https://b.example.com", Secret: "secret"})
+	d.Delete(a.ID)
+
+	fi, err := os.Stat(conf.File)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected file with mode 0600, got %v, %v", fi, err)
+	}
+
+	d, err = New(conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	subs := d.Subscriptions()
+	if len(subs) != 1 || subs[0].ID != b.ID || subs[0].URL != b.URL {
+		t.Errorf("unexpected subscriptions %+v", subs)
+	}
+	c, _ := d.Add(Subscription{URL: "https://c.example.com"})
+	if c.ID != 3 {
+		t.Errorf("expected ID 3, got %d", c.ID)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	sig := "sha256=" + Sign("secret", "1700000000", body)
+	if !Verify("secret", "1700000000", sig, body) {
+		t.Error("expected signature to be valid")
+	}
+	if Verify("secret", "1700000001", sig, body) || Verify("other", "1700000000", sig, body) {
+		t.Error("expected signature to be invalid")
+	}
+}
+
+func TestDispatcher_privateTarget(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	conf := testConfig()
+	conf.AllowPrivate = false
+	d, _ := New(conf)
+	if err := d.CheckURL(context.Background(), srv.URL); !errors.Is(err, ErrPrivateTarget) {
+		t.Errorf("expected ErrPrivateTarget, got %v", err)
+	}
+	d.lookup = func(context.Context, string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}}, nil
+	}
+	if err := d.CheckURL(context.Background(), "https://intranet.example/hook"); !errors.Is(err, ErrPrivateTarget) {
+		t.Errorf("expected ErrPrivateTarget for a name resolving to a private address, got %v", err)
+	}
+
+	// A subscription that passed the check is still refused at dial time,
+	// e.g. when its name resolves to another address later.
+	bus := storage.NewBus(10)
+	d.Run(bus)
+	defer d.Close()
+	d.Add(Subscription{URL: srv.URL})
+	bus.Publish(storage.EventCreated, storage.Post{ID: 1})
+
+	waitFor(t, "a dead letter", func() bool { return len(d.DeadLetters()) == 1 })
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("expected no requests to a loopback target, got %d", n)
+	}
+	if dl := d.DeadLetters()[0]; !strings.Contains(dl.LastError, ErrPrivateTarget.Error()) {
+		t.Errorf("expected the dial to be refused, got %q", dl.LastError)
+	}
+}
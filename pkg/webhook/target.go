@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateTarget - адрес получателя во внутренней сети.
+var ErrPrivateTarget = errors.New("webhook target is a loopback, private or link-local address")
+
+// privateIP сообщает, относится ли адрес к самому серверу
+// или к внутренней сети, куда подписки не должны обращаться.
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast()
+}
+
+// CheckURL проверяет, что адрес получателя не ведёт во внутреннюю
+// сеть. Имя узла разрешается в адреса; если этого сделать не удалось,
+// адрес проверяется ещё раз при соединении.
+func (d *Dispatcher) CheckURL(ctx context.Context, rawURL string) error {
+	if d.conf.AllowPrivate {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if privateIP(ip) {
+			return ErrPrivateTarget
+		}
+		return nil
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if privateIP(a.IP) {
+			return ErrPrivateTarget
+		}
+	}
+	return nil
+}
+
+// newClient создаёт HTTP-клиент доставки. Адрес получателя
+// проверяется при каждом соединении, в том числе после
+// перенаправлений и повторного разрешения имени.
+func newClient(conf Config) *http.Client {
+	dialer := &net.Dialer{Timeout: conf.Timeout, KeepAlive: 30 * time.Second}
+	if !conf.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return ErrPrivateTarget
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Прокси из окружения обходил бы проверку адреса.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: conf.Timeout, Transport: transport}
+}
@@ -0,0 +1,82 @@
+// Package webhook доставляет события об изменении публикаций
+// внешним системам HTTP-запросами с подписью HMAC.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"GoNews/pkg/storage"
+)
+
+// Заголовки запроса с событием.
+const (
+	HeaderEvent     = "X-GoNews-Event"     // тип события
+	HeaderDelivery  = "X-GoNews-Delivery"  // ID события
+	HeaderTimestamp = "X-GoNews-Timestamp" // время отправки, Unix
+	HeaderSignature = "X-GoNews-Signature" // sha256=<HMAC в hex>
+)
+
+// Subscription - подписка внешней системы на события публикаций.
+type Subscription struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // пустой список - все события
+	// Ключ подписи запросов. Возвращается только при создании подписки.
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Wants сообщает, подписан ли получатель на события типа typ.
+func (s Subscription) Wants(typ string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, e := range s.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery - попытка доставки события.
+type Delivery struct {
+	ID             int    `json:"id"`
+	SubscriptionID int    `json:"subscription_id"`
+	EventID        uint64 `json:"event_id"`
+	Event          string `json:"event"`
+	Attempt        int    `json:"attempt"`
+	StatusCode     int    `json:"status_code,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Time           int64  `json:"time"`
+	DurationMS     int64  `json:"duration_ms"`
+}
+
+// DeadLetter - событие, которое не удалось доставить.
+type DeadLetter struct {
+	ID             int           `json:"id"`
+	SubscriptionID int           `json:"subscription_id"`
+	Event          storage.Event `json:"event"`
+	Attempts       int           `json:"attempts"`
+	LastError      string        `json:"last_error"`
+	Time           int64         `json:"time"`
+}
+
+// Sign возвращает подпись тела запроса: HMAC-SHA256 строки
+// "<timestamp>.<body>" в шестнадцатеричном виде.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись из заголовка X-GoNews-Signature.
+// Получателю также следует отклонять запросы со старым timestamp.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	want := "sha256=" + Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(want), []byte(signature))
+}
@@ -3,7 +3,7 @@ CREATE DATABASE gonews;
 
 \c gonews;
 
-DROP TABLE IF EXISTS posts, authors;
+DROP TABLE IF EXISTS comments, post_tags, tags, posts, authors;
 
 CREATE TABLE authors (
     id BIGSERIAL PRIMARY KEY,
@@ -19,6 +19,32 @@ CREATE TABLE posts (
     published_at BIGINT DEFAULT 0
 );
 
+CREATE TABLE tags (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL
+);
+
+CREATE TABLE post_tags (
+    post_id BIGINT REFERENCES posts(id) ON DELETE CASCADE NOT NULL,
+    tag_id BIGINT REFERENCES tags(id) NOT NULL,
+    PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX post_tags_tag_id_idx ON post_tags (tag_id);
+
+CREATE TABLE comments (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT REFERENCES posts(id) ON DELETE CASCADE NOT NULL,
+    parent_id BIGINT REFERENCES comments(id) ON DELETE CASCADE,
+    author_id BIGINT REFERENCES authors(id) NOT NULL,
+    content TEXT NOT NULL,
+    created_at BIGINT NOT NULL,
+    updated_at BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX comments_post_id_idx ON comments (post_id);
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
+
 -- Add test authors
 INSERT INTO authors (name)
 VALUES